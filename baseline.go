@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// BaselineComparison compares the attestations of a run with a baseline: the
+// JSON report of a run over the whole network, such as one published for the
+// network, over the epochs both cover. Runs restricted to a subset of duties
+// can then tell how they fare against the network.
+type BaselineComparison struct {
+	Source string          `json:"source"` // Path or redacted URL of the baseline.
+	Epochs []BaselineEpoch `json:"epochs"` // Covered by both.
+
+	// Attestations are the run's over Epochs, and Baseline the baseline's.
+	Attestations AttestationStats `json:"attestations"`
+	Baseline     AttestationStats `json:"baseline"`
+}
+
+// BaselineEpoch is the attestations of an epoch, of the run and of the
+// baseline.
+type BaselineEpoch struct {
+	Epoch        phase0.Epoch     `json:"epoch"`
+	Attestations AttestationStats `json:"attestations"`
+	Baseline     AttestationStats `json:"baseline"`
+}
+
+// loadBaseline reads a baseline report from a path, or fetches it from an
+// http:// or https:// URL. The baseline must be of the network, and not
+// restricted to a subset of duties.
+func loadBaseline(ctx context.Context, source, network string) (*Report, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("request returned status %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+
+	var baseline Report
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	scope := baseline.Scope
+	switch {
+	case baseline.SchemaVersion != schemaVersion:
+		return nil, fmt.Errorf("report has schema version %d, not %d", baseline.SchemaVersion, schemaVersion)
+	case baseline.Metadata.Network != network:
+		return nil, fmt.Errorf("report is of network %s, not %s", baseline.Metadata.Network, network)
+	case len(scope.Committees) > 0 || len(scope.SlotIndices) > 0 || scope.ExcludedValidators > 0 || scope.IncludingProposers > 0:
+		return nil, errors.New("report is restricted to a subset of duties")
+	}
+	return &baseline, nil
+}
+
+// compareBaseline compares the epochs of a report with those of a baseline.
+// Epochs the baseline doesn't cover, or without assigned duties in either,
+// are left out.
+func compareBaseline(source string, epochs []EpochStats, baseline *Report) *BaselineComparison {
+	byEpoch := make(map[phase0.Epoch]AttestationStats, len(baseline.Epochs))
+	for _, e := range baseline.Epochs {
+		byEpoch[e.Epoch] = e.Attestations
+	}
+	c := &BaselineComparison{Source: redactAddress(source), Epochs: []BaselineEpoch{}}
+	for _, e := range epochs {
+		base, ok := byEpoch[e.Epoch]
+		if !ok || base.Assigned == 0 || e.Attestations.Assigned == 0 {
+			continue
+		}
+		c.Epochs = append(c.Epochs, BaselineEpoch{Epoch: e.Epoch, Attestations: e.Attestations, Baseline: base})
+		c.Attestations.add(e.Attestations)
+		c.Baseline.add(base)
+	}
+	return c
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/aquasecurity/table"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// benchCmd times the stages of the stats engine that don't depend on the
+// nodes against a synthetic chain, so that regressions show up without a
+// node or the noise of the network.
+type benchCmd struct {
+	Epochs        int     `default:"32" help:"Epochs of the synthetic chain"`
+	Validators    int     `default:"100000" help:"Active validators of the synthetic chain, split into committees like mainnet's"`
+	Participation float64 `default:"0.95" help:"Share of duties included, mostly in the next block"`
+	SkipRate      float64 `default:"0.01" help:"Share of slots without a block"`
+	Rounds        int     `default:"3" help:"Times to run the stages, keeping the fastest"`
+	Seed          int64   `default:"1" help:"Seed of the synthetic chain, to compare runs over the same one"`
+}
+
+// benchTimings are the durations of the stages of a round.
+type benchTimings struct {
+	Dedupe, Organize, Calculate time.Duration
+}
+
+func (cmd *benchCmd) Run() error {
+	switch {
+	case cmd.Epochs < 1:
+		log.Fatal("--epochs must be at least 1")
+	case cmd.Validators < int(slotsPerEpoch):
+		log.Fatalf("--validators must be at least %d, for every slot to have a committee", slotsPerEpoch)
+	case cmd.Participation < 0 || cmd.Participation > 1 || cmd.SkipRate < 0 || cmd.SkipRate >= 1:
+		log.Fatal("--participation and --skip-rate must be shares between 0 and 1")
+	case cmd.Rounds < 1:
+		log.Fatal("--rounds must be at least 1")
+	}
+
+	start := time.Now()
+	blocks := syntheticChain(cmd.Epochs, cmd.Validators, cmd.Participation, cmd.SkipRate, rand.New(rand.NewSource(cmd.Seed)))
+	log.Printf("Generated %d blocks in %s", len(blocks), time.Since(start).Round(time.Millisecond))
+
+	var best benchTimings
+	var duties int
+	for round := 0; round < cmd.Rounds; round++ {
+		var t benchTimings
+		t, duties = benchRound(blocks, phase0.Slot(cmd.Epochs)*slotsPerEpoch)
+		if round == 0 || t.Dedupe < best.Dedupe {
+			best.Dedupe = t.Dedupe
+		}
+		if round == 0 || t.Organize < best.Organize {
+			best.Organize = t.Organize
+		}
+		if round == 0 || t.Calculate < best.Calculate {
+			best.Calculate = t.Calculate
+		}
+	}
+
+	tbl := table.New(os.Stdout)
+	tbl.AddHeaders("Stage", "Time", "Throughput")
+	tbl.AddRow("Dedupe", best.Dedupe.Round(time.Microsecond).String(), fmt.Sprintf("%.0f blocks/s", float64(len(blocks))/best.Dedupe.Seconds()))
+	tbl.AddRow("Organize", best.Organize.Round(time.Microsecond).String(), fmt.Sprintf("%.0f blocks/s", float64(len(blocks))/best.Organize.Seconds()))
+	tbl.AddRow("Calculate", best.Calculate.Round(time.Microsecond).String(), fmt.Sprintf("%.0f duties/s", float64(duties)/best.Calculate.Seconds()))
+	tbl.Render()
+	return nil
+}
+
+// benchRound indexes, organizes and calculates the participation of the
+// duties of a chain over its first slots, the way runs do, and returns the
+// time each stage took and the number of duties calculated.
+func benchRound(blocks []blockWithRoot, slots phase0.Slot) (benchTimings, int) {
+	var t benchTimings
+	start := time.Now()
+	chain := newChainIndex([][]blockWithRoot{blocks})
+	t.Dedupe = time.Since(start)
+
+	start = time.Now()
+	slotCommitteeParticipations := newSlotParticipations(int(slots))
+	for _, bl := range chain.Blocks() {
+		addParticipations(slotCommitteeParticipations, 0, bl)
+	}
+	t.Organize = time.Since(start)
+
+	start = time.Now()
+	var attestations AttestationStats
+	var missed MissedStats
+	for i, committees := range slotCommitteeParticipations {
+		slot := phase0.Slot(i)
+		next, ok := chain.Next(slot)
+		if !ok {
+			continue
+		}
+		for _, participations := range committees {
+			for _, p := range participations {
+				if p.Included {
+					attestations.add(includedDuty(chain, slot, next.Message.Slot, p.InclusionSlot))
+					continue
+				}
+				attestations.add(AttestationStats{Assigned: 1, RewardWeight: attestationRewardWeight(slot, 0)})
+				if _, ok := chain.Block(slot + 1); ok {
+					missed.AttesterFault++
+				} else {
+					missed.ProposerFault++
+				}
+			}
+		}
+	}
+	t.Calculate = time.Since(start)
+	return t, attestations.Assigned
+}
+
+// syntheticChain generates a chain over a number of epochs, and the slots
+// after them that include their last attestations. Validators are split into
+// committees of at least 128, like mainnet's, of which each block includes an
+// aggregate of the votes included at its slot. Most votes are included at
+// the next slot, and the rest within a few.
+func syntheticChain(epochs, validators int, participation, skipRate float64, r *rand.Rand) []blockWithRoot {
+	committeesPerSlot := validators / int(slotsPerEpoch) / 128
+	if committeesPerSlot < 1 {
+		committeesPerSlot = 1
+	}
+	if committeesPerSlot > maxCommitteesPerSlot {
+		committeesPerSlot = maxCommitteesPerSlot
+	}
+	committeeSize := validators / int(slotsPerEpoch) / committeesPerSlot
+
+	slots := phase0.Slot(epochs) * slotsPerEpoch
+	// Votes by the slot they're included at, or later if it has no block.
+	pending := map[phase0.Slot][]*phase0.Attestation{}
+	var blocks []blockWithRoot
+	var parent phase0.Root
+	for slot := phase0.Slot(1); slot <= slots+slotsPerEpoch; slot++ {
+		if slot < slots {
+			for index := 0; index < committeesPerSlot; index++ {
+				bits := map[phase0.Slot]bitfield.Bitlist{}
+				for position := 0; position < committeeSize; position++ {
+					if r.Float64() >= participation {
+						continue
+					}
+					inclusion := slot + 1
+					if r.Float64() < 0.1 {
+						inclusion += phase0.Slot(1 + r.Intn(3))
+					}
+					if bits[inclusion] == nil {
+						bits[inclusion] = bitfield.NewBitlist(uint64(committeeSize))
+					}
+					bits[inclusion].SetBitAt(uint64(position), true)
+				}
+				for inclusion, b := range bits {
+					pending[inclusion] = append(pending[inclusion], &phase0.Attestation{
+						AggregationBits: b,
+						Data:            &phase0.AttestationData{Slot: slot, Index: phase0.CommitteeIndex(index)},
+					})
+				}
+			}
+		}
+		if slot < slots && r.Float64() < skipRate {
+			pending[slot+1] = append(pending[slot+1], pending[slot]...)
+			delete(pending, slot)
+			continue
+		}
+		var root phase0.Root
+		binary.LittleEndian.PutUint64(root[:], uint64(slot))
+		blocks = append(blocks, blockWithRoot{
+			Root: root,
+			SignedBeaconBlock: &bellatrix.SignedBeaconBlock{
+				Message: &bellatrix.BeaconBlock{
+					Slot:       slot,
+					ParentRoot: parent,
+					Body:       &bellatrix.BeaconBlockBody{Attestations: pending[slot]},
+				},
+			},
+		})
+		delete(pending, slot)
+		parent = root
+	}
+	return blocks
+}
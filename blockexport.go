@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// blockExport reads blocks from a local export of a client's database: a
+// directory of SSZ-encoded signed blocks, one per slot, named by the slot,
+// such as 4000000.ssz. Heavy historical runs can then read their blocks from
+// disk rather than fetch them, though duties and committees still come from
+// the nodes.
+//
+// Slots without a file within the export's first and last slot are empty.
+type blockExport struct {
+	dir         string
+	first, last phase0.Slot
+	forkEpochs  map[spec.DataVersion]phase0.Epoch
+}
+
+// openBlockExport opens an export, taking the fork each block is encoded in
+// from the fork epochs of the spec.
+func openBlockExport(dir string, config map[string]string) (*blockExport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	e := &blockExport{dir: dir, forkEpochs: map[spec.DataVersion]phase0.Epoch{}}
+	blocks := 0
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".ssz")
+		slot, err := strconv.ParseUint(name, 10, 64)
+		if entry.IsDir() || name == entry.Name() || err != nil {
+			continue
+		}
+		if blocks == 0 || phase0.Slot(slot) < e.first {
+			e.first = phase0.Slot(slot)
+		}
+		if blocks == 0 || phase0.Slot(slot) > e.last {
+			e.last = phase0.Slot(slot)
+		}
+		blocks++
+	}
+	if blocks == 0 {
+		return nil, fmt.Errorf("%s has no blocks named like <slot>.ssz", dir)
+	}
+	for version, key := range map[spec.DataVersion]string{
+		spec.DataVersionAltair:    "ALTAIR_FORK_EPOCH",
+		spec.DataVersionBellatrix: "BELLATRIX_FORK_EPOCH",
+		spec.DataVersionCapella:   "CAPELLA_FORK_EPOCH",
+		spec.DataVersionDeneb:     "DENEB_FORK_EPOCH",
+	} {
+		v, ok := config[key]
+		if !ok {
+			continue
+		}
+		epoch, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", key, v)
+		}
+		e.forkEpochs[version] = phase0.Epoch(epoch)
+	}
+	return e, nil
+}
+
+// version returns the fork blocks at a slot are encoded in.
+func (e *blockExport) version(slot phase0.Slot) spec.DataVersion {
+	epoch := phase0.Epoch(slot / slotsPerEpoch)
+	version := spec.DataVersionPhase0
+	for _, v := range []spec.DataVersion{spec.DataVersionAltair, spec.DataVersionBellatrix, spec.DataVersionCapella, spec.DataVersionDeneb} {
+		forkEpoch, ok := e.forkEpochs[v]
+		if !ok || forkEpoch > epoch {
+			break
+		}
+		version = v
+	}
+	return version
+}
+
+// Block reads the block at a slot, encoded like a node's block response so
+// that it's decoded and cached like a fetched one. It returns nil data if the
+// slot is empty, and an error if the export doesn't cover the slot.
+func (e *blockExport) Block(slot phase0.Slot) ([]byte, error) {
+	if slot < e.first || slot > e.last {
+		return nil, fmt.Errorf("the export covers slots %d—%d only", e.first, e.last)
+	}
+	data, err := os.ReadFile(filepath.Join(e.dir, fmt.Sprintf("%d.ssz", slot)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	version := e.version(slot)
+	var block interface{ UnmarshalSSZ([]byte) error }
+	switch version {
+	case spec.DataVersionPhase0:
+		block = &phase0.SignedBeaconBlock{}
+	case spec.DataVersionAltair:
+		block = &altair.SignedBeaconBlock{}
+	case spec.DataVersionBellatrix:
+		block = &bellatrix.SignedBeaconBlock{}
+	case spec.DataVersionCapella:
+		block = &capella.SignedBeaconBlock{}
+	case spec.DataVersionDeneb:
+		block = &deneb.SignedBeaconBlock{}
+	default:
+		return nil, fmt.Errorf("unhandled block version %s", version)
+	}
+	if err := block.UnmarshalSSZ(data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s block at slot %d: %w", version, slot, err)
+	}
+	return json.Marshal(struct {
+		Version string      `json:"version"`
+		Data    interface{} `json:"data"`
+	}{version.String(), block})
+}
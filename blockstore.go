@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// blockStore holds the blocks fetched for a run by slot, and the slots that
+// couldn't be fetched. It's safe for concurrent use, so fetches insert
+// into it as they complete, and it's read in slot order without sorting.
+//
+// With a memory bound, the store evicts its earliest blocks to stay within
+// it. Evicted slots are missing just like failed ones, so that the epochs
+// that depend on them are left out rather than computed without them.
+type blockStore struct {
+	from     phase0.Slot
+	maxBytes int64 // 0 for no bound.
+
+	mu        sync.Mutex
+	blocks    []*blockWithRoot // By slot from the first.
+	sizes     []int32
+	bytes     int64
+	oldest    int // Position of the earliest block held, to evict from.
+	missing   map[phase0.Slot]bool
+	evictions int
+}
+
+// newBlockStore returns a store for the blocks of sorted spans of slots,
+// holding at most maxBytes of blocks, or any amount if it's 0.
+func newBlockStore(spans [][2]phase0.Slot, maxBytes int64) *blockStore {
+	var from phase0.Slot
+	n := 0
+	if len(spans) > 0 {
+		from = spans[0][0]
+		n = int(spans[len(spans)-1][1]-from) + 1
+	}
+	return &blockStore{
+		from:     from,
+		maxBytes: maxBytes,
+		blocks:   make([]*blockWithRoot, n),
+		sizes:    make([]int32, n),
+		missing:  map[phase0.Slot]bool{},
+	}
+}
+
+// Insert adds a block, evicting the earliest blocks if it goes over the
+// memory bound. The block itself may be evicted if it's the earliest.
+func (s *blockStore) Insert(bl blockWithRoot) {
+	i := int(bl.Message.Slot - s.from)
+	size := bl.SizeSSZ() // Roughly what the block holds on to, as its payload is dropped.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.blocks[i] != nil {
+		s.bytes -= int64(s.sizes[i])
+	}
+	s.blocks[i] = &bl
+	s.sizes[i] = int32(size)
+	s.bytes += int64(size)
+	if i < s.oldest {
+		s.oldest = i
+	}
+	for s.maxBytes > 0 && s.bytes > s.maxBytes {
+		for s.blocks[s.oldest] == nil {
+			s.oldest++
+		}
+		s.bytes -= int64(s.sizes[s.oldest])
+		s.blocks[s.oldest] = nil
+		s.missing[s.from+phase0.Slot(s.oldest)] = true
+		s.evictions++
+	}
+}
+
+// Fail records a slot whose block couldn't be fetched or can't be used,
+// dropping any block held for it.
+func (s *blockStore) Fail(slot phase0.Slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missing[slot] = true
+	if i := int(slot - s.from); slot >= s.from && i < len(s.blocks) && s.blocks[i] != nil {
+		s.bytes -= int64(s.sizes[i])
+		s.blocks[i] = nil
+	}
+}
+
+// Missing returns the slots that failed to fetch or were evicted, sorted.
+func (s *blockStore) Missing() []phase0.Slot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slots := make([]phase0.Slot, 0, len(s.missing))
+	for slot := range s.missing {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots
+}
+
+// Evictions returns the number of blocks evicted to stay within the bound.
+func (s *blockStore) Evictions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictions
+}
+
+// Len returns the number of blocks held.
+func (s *blockStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, bl := range s.blocks {
+		if bl != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Range returns the blocks held from one slot to another, sorted by slot.
+func (s *blockStore) Range(from, to phase0.Slot) []blockWithRoot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from < s.from {
+		from = s.from
+	}
+	var blocks []blockWithRoot
+	for slot := from; slot <= to && int(slot-s.from) < len(s.blocks); slot++ {
+		if bl := s.blocks[slot-s.from]; bl != nil {
+			blocks = append(blocks, *bl)
+		}
+	}
+	return blocks
+}
+
+// Blocks returns every block held, sorted by slot.
+func (s *blockStore) Blocks() []blockWithRoot {
+	return s.Range(s.from, s.from+phase0.Slot(len(s.blocks)))
+}
+
+// Spans returns the blocks held from each span of slots.
+func (s *blockStore) Spans(spans [][2]phase0.Slot) [][]blockWithRoot {
+	split := make([][]blockWithRoot, len(spans))
+	for i, span := range spans {
+		split[i] = s.Range(span[0], span[1])
+	}
+	return split
+}
+
+// Canonical indexes the canonical chain of the blocks held from each span of
+// consecutive slots, discarding orphans.
+func (s *blockStore) Canonical(spans [][2]phase0.Slot) *chainIndex {
+	return newChainIndex(s.Spans(spans))
+}
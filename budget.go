@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fetchBudget caps the requests a run makes to the nodes, and the bytes it
+// downloads from them, so that runs against hosted nodes stay within the
+// quota of their plan. Once a cap is reached, fetches are cancelled as at a
+// deadline, and the epochs not fully fetched are left out as incomplete.
+// Requests in flight still count, so a run may exceed a cap by about a
+// window of fetches.
+//
+// A nil fetchBudget is never spent.
+type fetchBudget struct {
+	nodes       []*nodeClient
+	maxRequests int64
+	maxBytes    int64
+	cancel      context.CancelFunc
+
+	mu    sync.Mutex
+	spent string
+}
+
+// newFetchBudget returns a budget of the requests and MiB to spend on the
+// nodes, counting those made so far, which cancels fetches once spent. It
+// returns nil if neither is capped.
+func newFetchBudget(nodes []*nodeClient, maxRequests, maxMiB int, cancel context.CancelFunc) *fetchBudget {
+	if maxRequests <= 0 && maxMiB <= 0 {
+		return nil
+	}
+	return &fetchBudget{nodes: nodes, maxRequests: int64(maxRequests), maxBytes: int64(maxMiB) << 20, cancel: cancel}
+}
+
+// Check cancels the fetches if a cap has been reached.
+func (b *fetchBudget) Check() {
+	if b == nil {
+		return
+	}
+	var requests, bytes int64
+	for _, n := range b.nodes {
+		requests += n.requests.Load()
+		bytes += n.bytes.Load()
+	}
+	var spent string
+	switch {
+	case b.maxRequests > 0 && requests >= b.maxRequests:
+		spent = fmt.Sprintf("%d requests", b.maxRequests)
+	case b.maxBytes > 0 && bytes >= b.maxBytes:
+		spent = fmt.Sprintf("%d MiB", b.maxBytes>>20)
+	default:
+		return
+	}
+	b.mu.Lock()
+	if b.spent == "" {
+		b.spent = spent
+	}
+	b.mu.Unlock()
+	b.cancel()
+}
+
+// Spent returns the cap that was reached, such as "500 MiB", or an empty
+// string if none was.
+func (b *fetchBudget) Spent() string {
+	if b == nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent
+}
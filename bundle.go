@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundleFile is a file of a bundle, with its data, or the path to read it
+// from if data is nil.
+type bundleFile struct {
+	Name string
+	Path string
+	Data []byte
+}
+
+// bundleCompression returns the compression of a bundle by the extension of
+// its path: zstd for .tar.zst, gzip for .tar.gz, or none for .tar.
+func bundleCompression(path string) (string, error) {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".tar.zst") || strings.HasSuffix(name, ".tzst"):
+		return "zstd", nil
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		return "gzip", nil
+	case strings.HasSuffix(name, ".tar"):
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported bundle extension of %s (expected .tar.zst, .tar.gz or .tar)", path)
+	}
+}
+
+// writeBundle writes files to a tar archive at path, compressed by its
+// extension, so that the outputs of a run can be attached as one file.
+// Files are named by their base names, numbered if they'd collide.
+func writeBundle(path string, files []bundleFile) error {
+	compression, err := bundleCompression(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var w io.WriteCloser = nopWriteCloser{f}
+	switch compression {
+	case "zstd":
+		if w, err = zstd.NewWriter(f); err != nil {
+			f.Close()
+			return err
+		}
+	case "gzip":
+		w = gzip.NewWriter(f)
+	}
+	tw := tar.NewWriter(w)
+	if err := writeBundleFiles(tw, files); err != nil {
+		f.Close()
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeBundleFiles(tw *tar.Writer, files []bundleFile) error {
+	now := time.Now()
+	names := map[string]bool{}
+	for _, file := range files {
+		data := file.Data
+		if data == nil {
+			var err error
+			if data, err = os.ReadFile(file.Path); err != nil {
+				return err
+			}
+		}
+		name := file.Name
+		for i := 2; names[name]; i++ {
+			ext := filepath.Ext(file.Name)
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(file.Name, ext), i, ext)
+		}
+		names[name] = true
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+// cacheVersion is part of every cache key. Bump it whenever the way epoch
+// results are computed changes.
+const cacheVersion = 10
+
+// epochCache stores the results of finalized epochs on disk, so that runs
+// over overlapping ranges only compute the epochs they don't share.
+//
+// Results are keyed by epoch, by the root of the last block of the epoch's
+// inclusion window and by the inputs that affect them, such as filters.
+// The block pins every block before it that the result was derived from,
+// and the epoch is finalized, so the empty slots after it can't change
+// either. If the root changes, the cached result is simply never looked up
+// again.
+type epochCache struct {
+	dir    string
+	inputs string
+}
+
+func newEpochCache(dir, network string, inputs ...interface{}) (*epochCache, error) {
+	dir = filepath.Join(dir, network)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d;%d", cacheVersion, schemaVersion)
+	for _, input := range inputs {
+		fmt.Fprintf(h, ";%v", input)
+	}
+	return &epochCache{dir: dir, inputs: hex.EncodeToString(h.Sum(nil))[:16]}, nil
+}
+
+// cacheable reports whether the epoch's inclusion window is finalized, so
+// that its result can no longer change. Epoch 0 is never cached.
+func cacheable(epoch, finalized phase0.Epoch) bool {
+	return epoch > 0 && epoch+2 <= finalized
+}
+
+// anchorSlot returns the last slot of the epoch's inclusion window, whose
+// block, or the latest before it, anchors the epoch's result.
+func anchorSlot(epoch phase0.Epoch) phase0.Slot {
+	return phase0.Slot(epoch+2)*slotsPerEpoch - 1
+}
+
+// Lookup fetches the anchors of the cacheable epochs in the range, at once
+// through the scheduler, and returns the cached results among them. Epochs
+// without an anchor, because no node served a block of their inclusion
+// window, are neither looked up nor cached.
+func (c *epochCache) Lookup(
+	ctx context.Context,
+	sched *scheduler,
+	fromEpoch, toEpoch phase0.Epoch,
+) (results map[phase0.Epoch]epochResult, anchors map[phase0.Epoch]phase0.Root, err error) {
+	var finality *apiv1.Finality
+	err = sched.Do(categoryDuties, func(node *nodeClient) error {
+		var err error
+		finality, err = node.Finality(ctx, "head")
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch finality: %w", err)
+	}
+	results = map[phase0.Epoch]epochResult{}
+	anchors = map[phase0.Epoch]phase0.Root{}
+	var (
+		g  multierror.Group
+		mu sync.Mutex
+	)
+	for epoch := fromEpoch; epoch <= toEpoch && cacheable(epoch, finality.Finalized.Epoch); epoch++ {
+		epoch := epoch
+		g.Go(func() error {
+			anchor, ok, err := anchorRoot(ctx, sched, epoch)
+			if err != nil || !ok {
+				return err
+			}
+			b, err := os.ReadFile(c.path(epoch, anchor))
+			found := err == nil
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			var result epochResult
+			if found {
+				if err := json.Unmarshal(b, &result); err != nil {
+					return fmt.Errorf("corrupt cache entry for epoch %d: %w", epoch, err)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			anchors[epoch] = anchor
+			if found {
+				results[epoch] = result
+			}
+			return nil
+		})
+	}
+	if err := g.Wait().ErrorOrNil(); err != nil {
+		return nil, nil, err
+	}
+	return results, anchors, nil
+}
+
+// anchorRoot fetches the root of the block at the anchor slot of an epoch,
+// or of the latest block before it within the epoch's inclusion window.
+// Block headers are cheap to serve, unlike the states of past slots.
+func anchorRoot(ctx context.Context, sched *scheduler, epoch phase0.Epoch) (phase0.Root, bool, error) {
+	for slot := anchorSlot(epoch); slot >= phase0.Slot(epoch)*slotsPerEpoch; slot-- {
+		var header *apiv1.BeaconBlockHeader
+		err := sched.Do(categoryDuties, func(node *nodeClient) error {
+			var err error
+			header, err = node.BlockHeader(ctx, fmt.Sprint(slot))
+			return err
+		})
+		if err != nil {
+			return phase0.Root{}, false, fmt.Errorf("failed to fetch block header at slot %d: %w", slot, err)
+		}
+		if header != nil {
+			return header.Root, true, nil
+		}
+	}
+	return phase0.Root{}, false, nil
+}
+
+// Put stores the result of an epoch, replacing entries of the same epoch
+// and inputs whose anchor has changed.
+func (c *epochCache) Put(epoch phase0.Epoch, anchor phase0.Root, result epochResult) error {
+	stale, err := filepath.Glob(filepath.Join(c.dir, fmt.Sprintf("%d-*-%s.json", epoch, c.inputs)))
+	if err != nil {
+		return err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(epoch, anchor), b, 0o644)
+}
+
+func (c *epochCache) path(epoch phase0.Epoch, anchor phase0.Root) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%d-%x-%s.json", epoch, anchor[:8], c.inputs))
+}
+
+// cacheChain identifies the chain the data of a cache directory is of, since
+// devnets and relaunched testnets share the names of their networks.
+type cacheChain struct {
+	GenesisTime           int64  `json:"genesis_time"`
+	GenesisValidatorsRoot string `json:"genesis_validators_root"`
+	GenesisForkVersion    string `json:"genesis_fork_version"`
+	SlotsPerEpoch         uint64 `json:"slots_per_epoch"`
+}
+
+func (c cacheChain) String() string {
+	return fmt.Sprintf("genesis validators root %s and fork version %s at %s, with %d slots per epoch",
+		c.GenesisValidatorsRoot, c.GenesisForkVersion, time.Unix(c.GenesisTime, 0).UTC().Format(time.RFC3339), c.SlotsPerEpoch)
+}
+
+// checkCacheChain verifies that the cache directory of a network holds data
+// of the chain of the nodes, so that results and blocks of different chains
+// are never mixed. The directory is claimed for the chain on first use.
+func checkCacheChain(dir, network string, genesis *apiv1.Genesis) error {
+	dir = filepath.Join(dir, network)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	chain := cacheChain{
+		GenesisTime:           genesis.GenesisTime.Unix(),
+		GenesisValidatorsRoot: fmt.Sprintf("%#x", genesis.GenesisValidatorsRoot),
+		GenesisForkVersion:    fmt.Sprintf("%#x", genesis.GenesisForkVersion),
+		SlotsPerEpoch:         uint64(slotsPerEpoch),
+	}
+	path := filepath.Join(dir, "chain.json")
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		b, err := json.MarshalIndent(chain, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, b, 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	var cached cacheChain
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if cached != chain {
+		return fmt.Errorf("%s holds data of another %s chain (%s, not %s), so pass another --cache-dir or clear it",
+			dir, network, cached, chain)
+	}
+	return nil
+}
+
+// blockCache stores fetched blocks on disk by root, so that re-runs over the
+// same range only fetch the headers of its slots, which are tiny, and the
+// blocks they don't have yet. A root always names the same block, so
+// entries never go stale, whichever epochs were cached.
+type blockCache struct {
+	dir  string
+	hits atomic.Int64
+}
+
+func newBlockCache(dir, network string) (*blockCache, error) {
+	dir = filepath.Join(dir, network, "blocks")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &blockCache{dir: dir}, nil
+}
+
+// Get returns the response a block was fetched with, if it's cached. An
+// entry that doesn't decode to a block of the root, such as one corrupted on
+// disk, is deleted and treated as a miss, so that the block is fetched again.
+func (c *blockCache) Get(root phase0.Root) ([]byte, bool) {
+	path := c.path(root)
+	data, err := readGzip(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			os.Remove(path)
+		}
+		return nil, false
+	}
+	if bl, err := decodeBlock(data); err != nil || bl.Root != root {
+		os.Remove(path)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return data, true
+}
+
+// readGzip reads a gzipped file.
+func readGzip(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Put stores the response a block was fetched with, unless it's already
+// cached. Entries are written to a temporary file first, so that a run
+// that's interrupted doesn't leave a truncated entry behind.
+func (c *blockCache) Put(root phase0.Root, data []byte) error {
+	if c == nil {
+		return nil
+	}
+	path := c.path(root)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := gzip.NewWriter(f)
+	if _, err := w.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Hits returns the number of blocks read from the cache.
+func (c *blockCache) Hits() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.hits.Load()
+}
+
+// path shards entries by the first byte of their root, to keep directories
+// small.
+func (c *blockCache) path(root phase0.Root) string {
+	name := hex.EncodeToString(root[:])
+	return filepath.Join(c.dir, name[:2], name+".json.gz")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// chainIndex indexes the canonical blocks of the fetched spans of slots by
+// slot and by root, so that the stats passes look blocks up rather than scan
+// for them.
+type chainIndex struct {
+	blocks []blockWithRoot     // Sorted by slot.
+	bySlot map[phase0.Slot]int // Position within blocks.
+	byRoot map[phase0.Root]int // Position within blocks.
+}
+
+// newChainIndex indexes the blocks fetched from each span of consecutive
+// slots, discarding orphans. Blocks of each span must be sorted by slot.
+func newChainIndex(spans [][]blockWithRoot) *chainIndex {
+	c := &chainIndex{}
+	for _, spanBlocks := range spans {
+		c.blocks = append(c.blocks, discardOrphans(spanBlocks)...)
+	}
+	c.bySlot = make(map[phase0.Slot]int, len(c.blocks))
+	c.byRoot = make(map[phase0.Root]int, len(c.blocks))
+	for i, bl := range c.blocks {
+		c.bySlot[bl.Message.Slot] = i
+		c.byRoot[bl.Root] = i
+	}
+	return c
+}
+
+// Blocks returns the canonical blocks, sorted by slot.
+func (c *chainIndex) Blocks() []blockWithRoot {
+	return c.blocks
+}
+
+// Block returns the canonical block at a slot, if there is one.
+func (c *chainIndex) Block(slot phase0.Slot) (blockWithRoot, bool) {
+	i, ok := c.bySlot[slot]
+	if !ok {
+		return blockWithRoot{}, false
+	}
+	return c.blocks[i], true
+}
+
+// Root returns the root of the canonical block at a slot, or the zero root
+// if there is none.
+func (c *chainIndex) Root(slot phase0.Slot) phase0.Root {
+	bl, _ := c.Block(slot)
+	return bl.Root
+}
+
+// IsCanonical reports whether a block root is of a canonical block.
+func (c *chainIndex) IsCanonical(root phase0.Root) bool {
+	_, ok := c.byRoot[root]
+	return ok
+}
+
+// Next returns the first canonical block after a slot, if one was fetched.
+func (c *chainIndex) Next(slot phase0.Slot) (blockWithRoot, bool) {
+	i := sort.Search(len(c.blocks), func(i int) bool { return c.blocks[i].Message.Slot > slot })
+	if i == len(c.blocks) {
+		return blockWithRoot{}, false
+	}
+	return c.blocks[i], true
+}
+
+// BlocksBetween returns the number of canonical blocks after one slot up to
+// and including another, given that both slots have blocks.
+func (c *chainIndex) BlocksBetween(from, to phase0.Slot) int {
+	return c.bySlot[to] - c.bySlot[from]
+}
+
+// discardOrphans returns the blocks of the chain the last block builds on,
+// following parent roots back from it, sorted by slot. Every other block is
+// an orphan, even one that another orphan builds on. Blocks must be sorted
+// by slot and fetched from consecutive slots.
+func discardOrphans(messyBlocks []blockWithRoot) []blockWithRoot {
+	if len(messyBlocks) == 0 {
+		return nil
+	}
+	byRoot := make(map[phase0.Root]int, len(messyBlocks))
+	for i, bl := range messyBlocks {
+		byRoot[bl.Root] = i
+	}
+	var blocks []blockWithRoot
+	for i := len(messyBlocks) - 1; ; {
+		blocks = append(blocks, messyBlocks[i])
+		parent, ok := byRoot[messyBlocks[i].Message.ParentRoot]
+		if !ok || parent >= i {
+			break
+		}
+		i = parent
+	}
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+const unknownClient = "Unknown"
+
+// clientGraffiti maps graffiti markers to consensus clients. Besides full
+// names, clients following the client-version graffiti convention append
+// their Engine API client code and a short commit hash, such as "GE1a2bLH3c4d".
+var clientGraffiti = []struct {
+	client  string
+	markers []string
+	code    string
+}{
+	{"Lighthouse", []string{"lighthouse"}, "LH"},
+	{"Prysm", []string{"prysm"}, "PM"},
+	{"Teku", []string{"teku"}, "TK"},
+	{"Nimbus", []string{"nimbus"}, "NB"},
+	{"Lodestar", []string{"lodestar"}, "LS"},
+	{"Grandine", []string{"grandine"}, "GR"},
+}
+
+// graffitiClient guesses the consensus client that produced a block from its
+// graffiti, returning unknownClient if there's no recognizable marker.
+func graffitiClient(graffiti [32]byte) string {
+	s := string(bytes.TrimRight(graffiti[:], "\x00"))
+	lower := strings.ToLower(s)
+	for _, c := range clientGraffiti {
+		for _, marker := range c.markers {
+			if strings.Contains(lower, marker) {
+				return c.client
+			}
+		}
+	}
+	for _, c := range clientGraffiti {
+		if hasVersionCode(s, c.code) {
+			return c.client
+		}
+	}
+	return unknownClient
+}
+
+// hasVersionCode reports whether s carries code in the client-version graffiti
+// format, where each client's two-letter code is followed by four hex digits.
+func hasVersionCode(s, code string) bool {
+	for i := strings.Index(s, code); i >= 0; {
+		rest := s[i+len(code):]
+		if len(rest) >= 4 && isHex(rest[:4]) {
+			return true
+		}
+		next := strings.Index(rest, code)
+		if next < 0 {
+			break
+		}
+		i += len(code) + next
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// versionClient returns the consensus client named by a node's version
+// string, such as "Lighthouse/v4.5.0-441fc16/x86_64-linux", or unknownClient.
+func versionClient(version string) string {
+	lower := strings.ToLower(version)
+	for _, c := range clientGraffiti {
+		for _, marker := range c.markers {
+			if strings.HasPrefix(lower, marker) {
+				return c.client
+			}
+		}
+	}
+	return unknownClient
+}
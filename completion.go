@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// completionCmd prints a shell completion script, generated from the
+// commands and flags of the CLI so that it never goes stale.
+type completionCmd struct {
+	Shell string `arg:"" enum:"bash,zsh,fish" help:"Shell to complete in: bash, zsh or fish"`
+}
+
+// completionNode is a command to complete the flags and subcommands of, by
+// its path of command names, which is empty for the top level.
+type completionNode struct {
+	path     []string
+	commands []*kong.Node
+	flags    []*kong.Flag
+}
+
+func (cmd *completionCmd) Run(ctx *kong.Context) error {
+	nodes := completionNodes(ctx.Model.Node, nil)
+	name := ctx.Model.Name
+	var script string
+	switch cmd.Shell {
+	case "bash":
+		script = bashCompletion(name, nodes)
+	case "zsh":
+		// zsh runs the bash script through its bash compatibility.
+		script = "autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(name, nodes)
+	case "fish":
+		script = fishCompletion(name, nodes)
+	}
+	_, err := os.Stdout.WriteString(script)
+	return err
+}
+
+// completionNodes lists a command and its subcommands. The flags of the
+// default command are completed at the top level too, since it runs without
+// being named.
+func completionNodes(node *kong.Node, path []string) []completionNode {
+	n := completionNode{path: path}
+	seen := map[string]bool{}
+	addFlags := func(node *kong.Node) {
+		for _, group := range node.AllFlags(true) {
+			for _, flag := range group {
+				if !seen[flag.Name] {
+					seen[flag.Name] = true
+					n.flags = append(n.flags, flag)
+				}
+			}
+		}
+	}
+	addFlags(node)
+	if node.DefaultCmd != nil {
+		addFlags(node.DefaultCmd)
+	}
+	sort.Slice(n.flags, func(i, j int) bool { return n.flags[i].Name < n.flags[j].Name })
+	nodes := []completionNode{n}
+	for _, child := range node.Children {
+		if child.Type != kong.CommandNode || child.Hidden {
+			continue
+		}
+		nodes[0].commands = append(nodes[0].commands, child)
+		nodes = append(nodes, completionNodes(child, append(append([]string{}, path...), child.Name))...)
+	}
+	return nodes
+}
+
+func bashCompletion(name string, nodes []completionNode) string {
+	function := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s\n", name)
+	fmt.Fprintf(&b, "%s() {\n", function)
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} path=\"\" word words\n")
+	b.WriteString("\tfor word in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do\n")
+	b.WriteString("\t\tcase \"$path $word\" in\n")
+	for _, n := range nodes[1:] {
+		fmt.Fprintf(&b, "\t\t%q) path=\"$path $word\" ;;\n", " "+strings.Join(n.path, " "))
+	}
+	b.WriteString("\t\tesac\n\tdone\n")
+
+	// Values of flags are completed from their enums, or as files.
+	b.WriteString("\tcase \"$path:$prev\" in\n")
+	for _, n := range nodes {
+		for _, flag := range n.flags {
+			if flag.IsBool() {
+				continue
+			}
+			pattern := fmt.Sprintf("%q", pathPrefix(n.path)+":--"+flag.Name)
+			if flag.Short != 0 {
+				pattern += fmt.Sprintf("|%q", pathPrefix(n.path)+":-"+string(flag.Short))
+			}
+			if flag.Enum != "" {
+				fmt.Fprintf(&b, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", pattern, enumWords(flag))
+			} else {
+				fmt.Fprintf(&b, "\t%s) return ;;\n", pattern)
+			}
+		}
+	}
+	b.WriteString("\tesac\n")
+
+	b.WriteString("\tcase \"$path\" in\n")
+	for _, n := range nodes {
+		var words []string
+		for _, command := range n.commands {
+			words = append(words, command.Name)
+		}
+		for _, flag := range n.flags {
+			words = append(words, "--"+flag.Name)
+		}
+		fmt.Fprintf(&b, "\t%q) words=%q ;;\n", pathPrefix(n.path), strings.Join(words, " "))
+	}
+	b.WriteString("\tesac\n")
+	b.WriteString("\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n}\n")
+	fmt.Fprintf(&b, "complete -o default -F %s %s\n", function, name)
+	return b.String()
+}
+
+func fishCompletion(name string, nodes []completionNode) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s\n", name)
+	for _, n := range nodes {
+		// Commands and flags are offered once their parent command is given.
+		condition := "__fish_use_subcommand"
+		if len(n.path) > 0 {
+			condition = "__fish_seen_subcommand_from " + n.path[len(n.path)-1]
+		}
+		var subcommands []string
+		for _, command := range n.commands {
+			subcommands = append(subcommands, command.Name)
+		}
+		commandCondition := condition
+		if len(n.path) > 0 && len(subcommands) > 0 {
+			commandCondition += "; and not __fish_seen_subcommand_from " + strings.Join(subcommands, " ")
+		}
+		for _, command := range n.commands {
+			fmt.Fprintf(&b, "complete -c %s -n %s -f -a %s -d %s\n", name, fishQuote(commandCondition), command.Name, fishQuote(command.Help))
+		}
+		for _, flag := range n.flags {
+			fmt.Fprintf(&b, "complete -c %s -n %s -l %s", name, fishQuote(condition), flag.Name)
+			if flag.Short != 0 {
+				fmt.Fprintf(&b, " -s %c", flag.Short)
+			}
+			switch {
+			case flag.Enum != "":
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(enumWords(flag)))
+			case !flag.IsBool():
+				b.WriteString(" -r")
+			}
+			fmt.Fprintf(&b, " -d %s\n", fishQuote(flag.Help))
+		}
+	}
+	return b.String()
+}
+
+// pathPrefix joins a command path the way the bash script accumulates it.
+func pathPrefix(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return " " + strings.Join(path, " ")
+}
+
+// enumWords lists the values of an enum flag, separated by spaces.
+func enumWords(flag *kong.Flag) string {
+	values := strings.Split(flag.Enum, ",")
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(values, " ")
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Resolutions of attestation duties, as recorded by --debug-dump.
+const (
+	resolutionIncluded       = "included"
+	resolutionOtherProposer  = "included-by-other-proposer"
+	resolutionPending        = "pending"
+	resolutionMissedAttester = "missed-attester-fault"
+	resolutionMissedProposer = "missed-proposer-fault"
+	resolutionExcluded       = "excluded"
+)
+
+// debugDump writes the intermediate data a run computes its stats from to
+// a directory, so that suspicious numbers can be traced to the blocks and
+// duties behind them: the canonical chain index, the participation of every
+// committee position, and how each duty within the filters was resolved.
+//
+// A nil debugDump dumps nothing.
+type debugDump struct {
+	dir    string
+	duties recordWriter
+	err    error // First error writing duties, reported by Close.
+}
+
+// debugChainBlock is a block of the canonical chain index.
+type debugChainBlock struct {
+	Slot          int64  `parquet:"name=slot, type=INT64, convertedtype=UINT_64"`
+	BlockRoot     string `parquet:"name=block_root, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ParentRoot    string `parquet:"name=parent_root, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProposerIndex int64  `parquet:"name=proposer_index, type=INT64, convertedtype=UINT_64"`
+	Attestations  int32  `parquet:"name=attestations, type=INT32, convertedtype=UINT_32"`
+}
+
+// debugDuty is how an attestation duty was resolved. The validator is -1
+// if the committees weren't fetched, and the delays are 0 unless the duty
+// counts as included.
+type debugDuty struct {
+	Slot           int64  `parquet:"name=slot, type=INT64, convertedtype=UINT_64"`
+	Committee      int32  `parquet:"name=committee, type=INT32, convertedtype=UINT_32"`
+	Position       int32  `parquet:"name=position, type=INT32, convertedtype=UINT_32"`
+	Validator      int64  `parquet:"name=validator, type=INT64"`
+	Resolution     string `parquet:"name=resolution, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InclusionSlot  int64  `parquet:"name=inclusion_slot, type=INT64, convertedtype=UINT_64"`
+	InclusionDelay int32  `parquet:"name=inclusion_delay, type=INT32, convertedtype=UINT_32"`
+	EffectiveDelay int32  `parquet:"name=effective_delay, type=INT32, convertedtype=UINT_32"`
+	RawDelay       int32  `parquet:"name=raw_delay, type=INT32, convertedtype=UINT_32"`
+}
+
+// newDebugDump creates the directory, if need be, and starts the dump.
+func newDebugDump(dir string) (*debugDump, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &debugDump{dir: dir}
+	var err error
+	if d.duties, err = newRecordWriter(d.path("duties.csv"), debugDuty{}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *debugDump) path(name string) string {
+	return filepath.Join(d.dir, name)
+}
+
+// Duty records how a duty was resolved.
+func (d *debugDump) Duty(
+	slot phase0.Slot, committee, position int,
+	validator phase0.ValidatorIndex, known bool,
+	resolution string, p AttesterParticipation, duty AttestationStats,
+) {
+	if d == nil || d.err != nil {
+		return
+	}
+	record := debugDuty{
+		Slot:           int64(slot),
+		Committee:      int32(committee),
+		Position:       int32(position),
+		Validator:      -1,
+		Resolution:     resolution,
+		InclusionDelay: int32(duty.InclusionDelay),
+		EffectiveDelay: int32(duty.EffectiveDelay),
+		RawDelay:       int32(duty.RawDelay),
+	}
+	if known {
+		record.Validator = int64(validator)
+	}
+	if p.Included {
+		record.InclusionSlot = int64(p.InclusionSlot)
+	}
+	d.err = d.duties.Write(record)
+}
+
+// Close writes the chain index and participations, and finishes the dump.
+// It returns the files written.
+func (d *debugDump) Close(
+	blocks []blockWithRoot,
+	fromSlot phase0.Slot,
+	slotCommitteeParticipations [][]CommitteeParticipation,
+	blockRoot func(phase0.Slot) phase0.Root,
+) ([]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	if err := d.duties.Close(); d.err == nil {
+		d.err = err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	chain, err := newRecordWriter(d.path("chain.csv"), debugChainBlock{})
+	if err != nil {
+		return nil, err
+	}
+	for _, bl := range blocks {
+		err := chain.Write(debugChainBlock{
+			Slot:          int64(bl.Message.Slot),
+			BlockRoot:     bl.Root.String(),
+			ParentRoot:    bl.Message.ParentRoot.String(),
+			ProposerIndex: int64(bl.Message.ProposerIndex),
+			Attestations:  int32(len(bl.Message.Body.Attestations)),
+		})
+		if err != nil {
+			chain.Close()
+			return nil, err
+		}
+	}
+	if err := chain.Close(); err != nil {
+		return nil, err
+	}
+	// Every position is dumped, including those the filters leave out.
+	err = writeRawAttestations(d.path("participations.csv"), fromSlot, slotCommitteeParticipations, blockRoot,
+		func(phase0.Slot, int, int) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return []string{d.path("chain.csv"), d.path("participations.csv"), d.path("duties.csv")}, nil
+}
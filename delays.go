@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// inclusionDelays is the number of attestations of a validator, or of the
+// whole network, first included at a raw delay.
+type inclusionDelays struct {
+	Scope        string `parquet:"name=scope, type=BYTE_ARRAY, convertedtype=UTF8"` // network or validator.
+	Validator    int64  `parquet:"name=validator, type=INT64, convertedtype=UINT_64"`
+	Delay        int32  `parquet:"name=delay, type=INT32, convertedtype=UINT_32"`
+	Attestations int64  `parquet:"name=attestations, type=INT64, convertedtype=UINT_64"`
+}
+
+// delayDistribution counts the executed attestations of a set of validators,
+// and of the network to compare them against, by raw inclusion delay: the
+// slots from each attestation's own to the block that first included it.
+// Missed attestations have no delay, and are left to attestation rates.
+//
+// A nil delayDistribution counts nothing.
+type delayDistribution struct {
+	set        map[phase0.ValidatorIndex]bool
+	network    map[int]int
+	validators map[phase0.ValidatorIndex]map[int]int
+}
+
+func newDelayDistribution(set map[phase0.ValidatorIndex]bool) *delayDistribution {
+	return &delayDistribution{set: set, network: map[int]int{}, validators: map[phase0.ValidatorIndex]map[int]int{}}
+}
+
+// Add adds a duty, of a validator if known.
+func (d *delayDistribution) Add(validator phase0.ValidatorIndex, known bool, duty AttestationStats) {
+	if d == nil || duty.Executed == 0 {
+		return
+	}
+	d.network[duty.RawDelay]++
+	if !known || !d.set[validator] {
+		return
+	}
+	delays := d.validators[validator]
+	if delays == nil {
+		delays = map[int]int{}
+		d.validators[validator] = delays
+	}
+	delays[duty.RawDelay]++
+}
+
+// Write writes the network's distribution followed by each validator's, by
+// index, each by delay.
+func (d *delayDistribution) Write(path string) error {
+	w, err := newRecordWriter(path, inclusionDelays{})
+	if err != nil {
+		return err
+	}
+	write := func(scope string, validator phase0.ValidatorIndex, delays map[int]int) error {
+		sorted := make([]int, 0, len(delays))
+		for delay := range delays {
+			sorted = append(sorted, delay)
+		}
+		sort.Ints(sorted)
+		for _, delay := range sorted {
+			record := inclusionDelays{
+				Scope:        scope,
+				Validator:    int64(validator),
+				Delay:        int32(delay),
+				Attestations: int64(delays[delay]),
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write("network", 0, d.network); err != nil {
+		w.Close()
+		return err
+	}
+	validators := make([]phase0.ValidatorIndex, 0, len(d.validators))
+	for validator := range d.validators {
+		validators = append(validators, validator)
+	}
+	sort.Slice(validators, func(i, j int) bool { return validators[i] < validators[j] })
+	for _, validator := range validators {
+		if err := write("validator", validator, d.validators[validator]); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// DoubleBlock is a slot for which two blocks were seen: the canonical one,
+// and a sibling that lost. When both are by the same proposer, it's an
+// equivocation, which is slashable.
+type DoubleBlock struct {
+	Slot          phase0.Slot           `json:"slot"`
+	ProposerIndex phase0.ValidatorIndex `json:"proposer_index"`
+	CanonicalRoot string                `json:"canonical_root"`
+
+	OrphanedProposerIndex phase0.ValidatorIndex `json:"orphaned_proposer_index"`
+	OrphanedRoot          string                `json:"orphaned_root"`
+
+	// Detected is "chain" when a node served the sibling in place of the
+	// canonical block, or "votes" when attesters voted for the sibling.
+	Detected string `json:"detected"`
+}
+
+// Equivocation reports whether both blocks are by the same proposer.
+func (d DoubleBlock) Equivocation() bool {
+	return d.ProposerIndex == d.OrphanedProposerIndex
+}
+
+// Ways of handling a slot for which a node served a block the canonical chain
+// doesn't build on.
+const (
+	doubleBlocksResolve = "resolve" // Replace it with the canonical block.
+	doubleBlocksExclude = "exclude" // Leave the epochs that depend on the slot out.
+	doubleBlocksFail    = "fail"    // Abort the run.
+)
+
+// resolveDoubleBlocks follows the chain back from the last block of each span
+// of slots, checking that every block held is the parent of the next one.
+// Where a held block isn't, the node served a block the chain doesn't build
+// on, so the canonical block is fetched by root from the child's parent root
+// and handled as given, along with canonical blocks the nodes didn't serve
+// at all. Orphans at slots the chain skips are left for newChainIndex.
+//
+// The last block of each span is taken to be canonical, since nothing
+// builds on it yet.
+func resolveDoubleBlocks(ctx context.Context, sched *scheduler, store *blockStore, spans [][2]phase0.Slot, handling string) ([]DoubleBlock, error) {
+	var doubles []DoubleBlock
+	for _, span := range spans {
+		blocks := store.Range(span[0], span[1])
+		if len(blocks) < 2 {
+			continue
+		}
+		want, child := blocks[len(blocks)-1].Message.ParentRoot, blocks[len(blocks)-1].Message.Slot
+		var wanted *blockWithRoot // Canonical block of the wanted root, once fetched.
+		for i := len(blocks) - 2; i >= 0; i-- {
+			bl := blocks[i]
+			if bl.Root == want {
+				want, child, wanted = bl.Message.ParentRoot, bl.Message.Slot, nil
+				continue
+			}
+			if wanted == nil {
+				var err error
+				wanted, err = fetchBlockByRoot(ctx, sched, want)
+				if err != nil {
+					return nil, fmt.Errorf("failed to fetch block %s: %w", want, err)
+				}
+				if wanted == nil {
+					log.Printf("Block at slot %d isn't the parent of the next block, whose parent %s no node has", bl.Message.Slot, want)
+					break
+				}
+				if wanted.Root != want || wanted.Message.Slot >= child {
+					// A parent can only be before its child.
+					log.Printf("Leaving out slot %d, since the block served for %s has root %s at slot %d, so it can't be the parent of slot %d",
+						bl.Message.Slot, want, wanted.Root, wanted.Message.Slot, child)
+					store.Fail(bl.Message.Slot)
+					break
+				}
+			}
+			if wanted.Message.Slot < bl.Message.Slot {
+				// An orphan at a slot the chain skips.
+				continue
+			}
+			slot := wanted.Message.Slot
+			problem := fmt.Sprintf("a node served a block at slot %d that the canonical chain doesn't build on", slot)
+			if slot == bl.Message.Slot {
+				doubles = append(doubles, DoubleBlock{
+					Slot:                  slot,
+					ProposerIndex:         wanted.Message.ProposerIndex,
+					CanonicalRoot:         wanted.Root.String(),
+					OrphanedProposerIndex: bl.Message.ProposerIndex,
+					OrphanedRoot:          bl.Root.String(),
+					Detected:              "chain",
+				})
+			} else {
+				// The canonical block is at a slot a node reported as empty,
+				// so look at this block again against its parent.
+				problem = fmt.Sprintf("a node served no block at slot %d, where the canonical chain has one", slot)
+				i++
+			}
+			switch handling {
+			case doubleBlocksFail:
+				return nil, errors.New(problem)
+			case doubleBlocksExclude:
+				log.Printf("Leaving out slot %d, since %s", slot, problem)
+				store.Fail(slot)
+			default: // doubleBlocksResolve
+				log.Printf("Using the canonical block %s at slot %d, since %s", wanted.Root, slot, problem)
+				store.Insert(*wanted)
+			}
+			want, child, wanted = wanted.Message.ParentRoot, wanted.Message.Slot, nil
+		}
+	}
+	sort.Slice(doubles, func(i, j int) bool { return doubles[i].Slot < doubles[j].Slot })
+	return doubles, nil
+}
+
+// fetchBlockByRoot fetches a block by root from the first node that has it,
+// or returns nil if none does.
+func fetchBlockByRoot(ctx context.Context, sched *scheduler, root phase0.Root) (*blockWithRoot, error) {
+	for i := range sched.nodes {
+		var data []byte
+		err := sched.DoOn(i, categoryBlocks, func(node *nodeClient) error {
+			var err error
+			data, err = node.SignedBeaconBlockData(ctx, root.String())
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			bl, err := decodeBlock(data)
+			if err != nil {
+				return nil, err
+			}
+			return &bl, nil
+		}
+	}
+	return nil, nil
+}
+
+// reorgDoubleBlocks returns the reorgs whose orphan lost to a canonical
+// block at its own slot.
+func reorgDoubleBlocks(reorgs []Reorg) []DoubleBlock {
+	var doubles []DoubleBlock
+	for _, r := range reorgs {
+		if r.CanonicalSlot != r.Slot {
+			continue
+		}
+		doubles = append(doubles, DoubleBlock{
+			Slot:                  r.Slot,
+			ProposerIndex:         r.CanonicalProposerIndex,
+			CanonicalRoot:         r.CanonicalRoot,
+			OrphanedProposerIndex: r.ProposerIndex,
+			OrphanedRoot:          r.Root,
+			Detected:              "votes",
+		})
+	}
+	return doubles
+}
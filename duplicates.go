@@ -0,0 +1,74 @@
+package main
+
+import "github.com/attestantio/go-eth2-client/spec/phase0"
+
+// DuplicateStats counts aggregates included again after blocks already
+// included some of their votes, which wastes block space that other
+// attestations could have used, as a sign of inefficient aggregation or
+// packing.
+type DuplicateStats struct {
+	Aggregates int `json:"aggregates"` // Aggregates included.
+
+	// Duplicates counts aggregates with the same data as an earlier one
+	// and overlapping bits, and Redundant how many of them added no vote.
+	Duplicates int `json:"duplicates"`
+	Redundant  int `json:"redundant"`
+
+	// Votes counts the votes of duplicates included again.
+	Votes int `json:"votes"`
+}
+
+func (s *DuplicateStats) add(o DuplicateStats) {
+	s.Aggregates += o.Aggregates
+	s.Duplicates += o.Duplicates
+	s.Redundant += o.Redundant
+	s.Votes += o.Votes
+}
+
+// Rate returns the percentage of included aggregates that were duplicates.
+func (s DuplicateStats) Rate() float64 {
+	return float64(s.Duplicates) / float64(s.Aggregates) * 100
+}
+
+// attestationDataKey identifies attestation data, whose checkpoints are
+// pointers.
+type attestationDataKey struct {
+	Slot            phase0.Slot
+	Index           phase0.CommitteeIndex
+	BeaconBlockRoot phase0.Root
+	Source, Target  phase0.Checkpoint
+}
+
+// duplicateTracker tracks the votes included for each attestation data.
+type duplicateTracker map[attestationDataKey][]bool
+
+// Add counts an aggregate, which must be included after the aggregates
+// added before it.
+func (t duplicateTracker) Add(att *phase0.Attestation) DuplicateStats {
+	key := attestationDataKey{att.Data.Slot, att.Data.Index, att.Data.BeaconBlockRoot, *att.Data.Source, *att.Data.Target}
+	included := t[key]
+	if included == nil {
+		included = make([]bool, att.AggregationBits.Len())
+		t[key] = included
+	}
+	stats := DuplicateStats{Aggregates: 1}
+	added := 0
+	for _, i := range att.AggregationBits.BitIndices() {
+		if i >= len(included) {
+			continue // A committee size no other aggregate agrees on.
+		}
+		if included[i] {
+			stats.Votes++
+		} else {
+			included[i] = true
+			added++
+		}
+	}
+	if stats.Votes > 0 {
+		stats.Duplicates = 1
+		if added == 0 {
+			stats.Redundant = 1
+		}
+	}
+	return stats
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+// dutiesExportBatch is the number of epochs whose committees are fetched at
+// once, before they're written in order.
+const dutiesExportBatch = 16
+
+// dutiesCmd works with validator duties on their own, for other pipelines.
+type dutiesCmd struct {
+	Export dutiesExportCmd `cmd:"" help:"Write the attestation committee assignments of a range of epochs to a .parquet or .csv file"`
+}
+
+// dutiesExportCmd writes every attestation duty of a range of epochs: the
+// committee position each validator was assigned to.
+type dutiesExportCmd struct {
+	Node        []string `required:"" help:"Comma-separated Beacon node addresses, each optionally weighted, such as http://localhost:5052?weight=4,http://localhost:3500"`
+	Epochs      string   `required:"" help:"Epoch, or range of epochs such as 1000-1010, or 1000- to end at the latest finalized epoch"`
+	Out         string   `required:"" help:"File to write, such as duties.parquet or duties.csv"`
+	Concurrency int      `short:"c" default:"4" help:"Per-node concurrency limit, scaled by each node's weight"`
+
+	HTTPProxy   string `help:"Proxy URL for requests to Beacon nodes (defaults to the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	TLSInsecure bool   `help:"Skip verification of Beacon node TLS certificates"`
+	CACert      string `type:"existingfile" help:"PEM bundle of additional CA certificates to trust for Beacon node TLS"`
+}
+
+// dutyAssignment is a validator's position in a committee.
+type dutyAssignment struct {
+	Epoch     int64 `parquet:"name=epoch, type=INT64, convertedtype=UINT_64"`
+	Slot      int64 `parquet:"name=slot, type=INT64, convertedtype=UINT_64"`
+	Committee int32 `parquet:"name=committee, type=INT32, convertedtype=UINT_32"`
+	Position  int32 `parquet:"name=position, type=INT32, convertedtype=UINT_32"`
+	Validator int64 `parquet:"name=validator_index, type=INT64, convertedtype=UINT_64"`
+}
+
+func (cmd *dutiesExportCmd) Run() error {
+	ctx := context.Background()
+	if cmd.Concurrency < 1 {
+		log.Fatalf("Invalid concurrency %d", cmd.Concurrency)
+	}
+	transport, err := newTransport(transportConfig{
+		Proxy:        cmd.HTTPProxy,
+		MaxIdleConns: 64,
+		IdleTimeout:  time.Minute,
+		TLSInsecure:  cmd.TLSInsecure,
+		CACert:       cmd.CACert,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	nodes, err := newNodeClients(cmd.Node, transport)
+	if err != nil {
+		log.Fatal(err)
+	}
+	spec, err := nodes[0].Spec(ctx)
+	if err != nil {
+		log.Fatalf("Failed to fetch spec from %s: %s", nodes[0].Name(), err)
+	}
+	if err := setPreset(spec); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkNetwork(ctx, nodes, spec["CONFIG_NAME"]); err != nil {
+		log.Fatal(err)
+	}
+	fromEpoch, toEpoch, err := resolveEpochRange(ctx, nodes[0], cmd.Epochs)
+	if err != nil {
+		log.Fatalf("Invalid epochs %q: %s", cmd.Epochs, err)
+	}
+	sched := newScheduler(nodes, func(node *nodeClient) *limiter {
+		limit := int(math.Round(float64(cmd.Concurrency) * node.weight))
+		if limit < 1 {
+			limit = 1
+		}
+		return newLimiter(limit)
+	}, nil)
+
+	w, err := newRecordWriter(cmd.Out, dutyAssignment{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	assignments := 0
+	for start := fromEpoch; start <= toEpoch; start += dutiesExportBatch {
+		end := start + dutiesExportBatch - 1
+		if end > toEpoch {
+			end = toEpoch
+		}
+		// Fetch a batch of epochs at once, then write them in order.
+		batch := make([][]*apiv1.BeaconCommittee, end-start+1)
+		var g multierror.Group
+		for epoch := start; epoch <= end; epoch++ {
+			epoch := epoch
+			g.Go(func() error {
+				return sched.Do(categoryCommittees, func(node *nodeClient) error {
+					committees, err := node.BeaconCommittees(ctx, epoch)
+					if err != nil {
+						return fmt.Errorf("failed to fetch committees for epoch %d: %w", epoch, err)
+					}
+					batch[epoch-start] = committees
+					return nil
+				})
+			})
+		}
+		if err := g.Wait().ErrorOrNil(); err != nil {
+			w.Close()
+			log.Fatal(err)
+		}
+		for i, committees := range batch {
+			epoch := start + phase0.Epoch(i)
+			for _, c := range committees {
+				for position, validator := range c.Validators {
+					err := w.Write(dutyAssignment{
+						Epoch:     int64(epoch),
+						Slot:      int64(c.Slot),
+						Committee: int32(c.Index),
+						Position:  int32(position),
+						Validator: int64(validator),
+					})
+					if err != nil {
+						w.Close()
+						log.Fatal(err)
+					}
+					assignments++
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d assignments of epochs %d—%d to %s", assignments, fromEpoch, toEpoch, cmd.Out)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import "github.com/attestantio/go-eth2-client/spec/phase0"
+
+// effectivenessModels names the supported definitions of attestation
+// effectiveness, in the order they're shown side by side:
+//
+//   - reciprocal-delay: the reciprocal of the average inclusion delay of
+//     executed attestations, counting delays from the earliest block that
+//     could have included them.
+//   - effective-delay: like reciprocal-delay, but counting only the slots
+//     with canonical blocks, so that attesters aren't held to account for
+//     skipped slots.
+//   - attestant: Attestant's model, averaging the earliest possible over the
+//     actual inclusion distance of every attestation, with misses counting
+//     as 0.
+//   - reward: the net reward earned as a share of the maximum, with Altair's
+//     weights for timely source, target and head votes. It assumes that
+//     included votes are correct and ignores the scaling of rewards by
+//     overall participation.
+var effectivenessModels = []string{"reciprocal-delay", "effective-delay", "attestant", "reward"}
+
+// Altair's reward weights of attestation votes. The inclusion distances
+// within which they're timely depend on the preset.
+const (
+	timelySourceWeight   = 14
+	timelyTargetWeight   = 26
+	timelyHeadWeight     = 14
+	maxAttestationWeight = timelySourceWeight + timelyTargetWeight + timelyHeadWeight
+)
+
+// attestationRewardWeight returns the net reward weight of an attestation
+// at a slot included at the given distance from it, or of a missed
+// attestation if distance is 0. Late source and target votes are penalized
+// by their weight, while late head votes merely go unrewarded.
+func attestationRewardWeight(slot, distance phase0.Slot) int {
+	weight := 0
+	if distance > 0 && distance <= timelySourceDistance {
+		weight += timelySourceWeight
+	} else {
+		weight -= timelySourceWeight
+	}
+	if distance > 0 && (distance <= timelyTargetDistance || extendedInclusion(slot)) {
+		weight += timelyTargetWeight
+	} else {
+		weight -= timelyTargetWeight
+	}
+	if distance == timelyHeadDistance {
+		weight += timelyHeadWeight
+	}
+	return weight
+}
+
+// EffectiveDelayEffectiveness returns the reciprocal of the average
+// effective inclusion delay, as a percentage.
+func (s AttestationStats) EffectiveDelayEffectiveness() float64 {
+	return 1 / s.AverageEffectiveDelay() * 100
+}
+
+// AttestantEffectiveness returns the average ratio of the earliest possible
+// to the actual inclusion distance, as a percentage.
+func (s AttestationStats) AttestantEffectiveness() float64 {
+	return s.InclusionScore / float64(s.Assigned) * 100
+}
+
+// RewardEffectiveness returns the net attestation reward weight as a
+// percentage of the maximum.
+func (s AttestationStats) RewardEffectiveness() float64 {
+	return float64(s.RewardWeight) / float64(s.Assigned*maxAttestationWeight) * 100
+}
+
+// EffectivenessOf returns the effectiveness under the named model, as a percentage.
+func (s AttestationStats) EffectivenessOf(model string) float64 {
+	switch model {
+	case "effective-delay":
+		return s.EffectiveDelayEffectiveness()
+	case "attestant":
+		return s.AttestantEffectiveness()
+	case "reward":
+		return s.RewardEffectiveness()
+	default:
+		return s.Effectiveness()
+	}
+}
+
+// effectivenessHeaders returns a table header for each model.
+func effectivenessHeaders(models []string) []string {
+	headers := make([]string, len(models))
+	for i, model := range models {
+		switch model {
+		case "effective-delay":
+			headers[i] = "Effective-Delay Effectiveness"
+		case "attestant":
+			headers[i] = "Attestant Effectiveness"
+		case "reward":
+			headers[i] = "Reward Effectiveness"
+		default:
+			headers[i] = "Effectiveness"
+		}
+	}
+	return headers
+}
+
+// effectivenessCells returns a table cell for each model.
+func effectivenessCells(models []string, stats AttestationStats) []string {
+	cells := make([]string, len(models))
+	for i, model := range models {
+		cells[i] = percent(stats.EffectivenessOf(model))
+	}
+	return cells
+}
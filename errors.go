@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// ErrorReport summarizes what went wrong in a run, so that automation can
+// decide whether to rerun it without parsing logs.
+type ErrorReport struct {
+	SchemaVersion int    `json:"schema_version"`
+	Status        string `json:"status"`          // ok, partial or failed.
+	Error         string `json:"error,omitempty"` // Why the run failed, if it did.
+
+	// Retries counts requests that were sent again after a failure.
+	Retries          int            `json:"retries"`
+	FailedSlots      []FailedSlot   `json:"failed_slots"`
+	IncompleteEpochs []phase0.Epoch `json:"incomplete_epochs"`
+	Nodes            []NodeErrors   `json:"nodes"`
+}
+
+// FailedSlot is a slot whose block couldn't be fetched from any node.
+type FailedSlot struct {
+	Slot     phase0.Slot `json:"slot"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error"` // The last error.
+}
+
+// NodeErrors counts the failed requests to a node by category: timeout,
+// connection, http_4xx, http_5xx or other.
+type NodeErrors struct {
+	Address  string         `json:"address"`
+	Name     string         `json:"name,omitempty"`
+	Requests int64          `json:"requests"`
+	Errors   map[string]int `json:"errors"`
+}
+
+// errorReporter collects the errors of a run and writes them as an
+// ErrorReport. Its methods are no-ops on a nil errorReporter, so that runs
+// without an error report needn't check.
+type errorReporter struct {
+	path string
+
+	mu          sync.Mutex
+	nodes       []*nodeClient
+	nodeErrors  map[*nodeClient]map[string]int
+	retries     int
+	failedSlots []FailedSlot
+	incomplete  []phase0.Epoch
+}
+
+func newErrorReporter(path string) *errorReporter {
+	return &errorReporter{path: path, nodeErrors: map[*nodeClient]map[string]int{}}
+}
+
+// SetNodes sets the nodes of the run.
+func (r *errorReporter) SetNodes(nodes []*nodeClient) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.nodes = nodes
+	r.mu.Unlock()
+}
+
+// RequestFailed records a failed request to a node.
+func (r *errorReporter) RequestFailed(node *nodeClient, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nodeErrors[node] == nil {
+		r.nodeErrors[node] = map[string]int{}
+	}
+	r.nodeErrors[node][errorCategory(err)]++
+}
+
+// Retried records a request sent again after a failure.
+func (r *errorReporter) Retried() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.retries++
+	r.mu.Unlock()
+}
+
+// SlotFailed records a slot whose block couldn't be fetched.
+func (r *errorReporter) SlotFailed(slot phase0.Slot, attempts int, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.failedSlots = append(r.failedSlots, FailedSlot{slot, attempts, err.Error()})
+	r.mu.Unlock()
+}
+
+// SetIncomplete records the epochs left out of the stats.
+func (r *errorReporter) SetIncomplete(epochs []phase0.Epoch) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.incomplete = epochs
+	r.mu.Unlock()
+}
+
+// Write writes the error report, with the error that failed the run, if any.
+func (r *errorReporter) Write(runErr error) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := ErrorReport{
+		SchemaVersion:    schemaVersion,
+		Status:           "ok",
+		Retries:          r.retries,
+		FailedSlots:      append([]FailedSlot{}, r.failedSlots...),
+		IncompleteEpochs: append([]phase0.Epoch{}, r.incomplete...),
+		Nodes:            []NodeErrors{},
+	}
+	switch {
+	case runErr != nil:
+		report.Status = "failed"
+		report.Error = runErr.Error()
+	case len(report.FailedSlots) > 0 || len(report.IncompleteEpochs) > 0:
+		report.Status = "partial"
+	}
+	sort.Slice(report.FailedSlots, func(i, j int) bool { return report.FailedSlots[i].Slot < report.FailedSlots[j].Slot })
+	for _, n := range r.nodes {
+		errs := map[string]int{}
+		for category, count := range r.nodeErrors[n] {
+			errs[category] = count
+		}
+		report.Nodes = append(report.Nodes, NodeErrors{redactAddress(n.address), n.name, n.requests.Load(), errs})
+	}
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Fatal writes the error report of a failed run, then logs the error and
+// exits like log.Fatal.
+func (r *errorReporter) Fatal(v ...interface{}) {
+	r.fatal(fmt.Sprint(v...))
+}
+
+// Fatalf is like Fatal, with a format string.
+func (r *errorReporter) Fatalf(format string, v ...interface{}) {
+	r.fatal(fmt.Sprintf(format, v...))
+}
+
+func (r *errorReporter) fatal(msg string) {
+	if err := r.Write(errors.New(msg)); err != nil {
+		log.Printf("Failed to write error report: %s", err)
+	}
+	log.Fatal(msg)
+}
+
+// errorCategory classifies a request error.
+func errorCategory(err error) string {
+	var statusErr *httpStatusError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode/100 == 4:
+		return "http_4xx"
+	case errors.As(err, &statusErr):
+		return "http_5xx"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &opErr):
+		return "connection"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressEventInterval is how often progress events are emitted while a
+// phase runs, besides when it starts and finishes.
+const progressEventInterval = time.Second
+
+// Event is a line of the events stream.
+type Event struct {
+	Type string    `json:"type"` // progress, epoch, incomplete or done.
+	Time time.Time `json:"time"`
+
+	Progress *ProgressEvent `json:"progress,omitempty"`
+
+	// Epoch is set for epoch events, as each epoch's stats are complete.
+	// Cached is set for epochs taken from the cache.
+	Epoch  *EpochStats `json:"epoch,omitempty"`
+	Cached bool        `json:"cached,omitempty"`
+
+	Incomplete *IncompleteEpoch `json:"incomplete,omitempty"`
+
+	// Incompletes is set for the done event, to the number of epochs left
+	// out as incomplete.
+	Incompletes int `json:"incompletes,omitempty"`
+}
+
+// ProgressEvent is the progress of a phase of the run.
+type ProgressEvent struct {
+	Phase    string `json:"phase"`
+	Done     int    `json:"done"`
+	Total    int    `json:"total,omitempty"` // Unset if unknown.
+	Unit     string `json:"unit"`
+	Finished bool   `json:"finished,omitempty"`
+}
+
+// eventStream writes the progress and results of a run as they come, as
+// newline-delimited JSON events, so that orchestrators can follow a run
+// rather than wait for its report. It stops writing after the first error.
+//
+// A nil eventStream writes nothing.
+type eventStream struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+	err error
+}
+
+// newEventStream opens a stream to a Unix socket, given as unix:///path, or
+// to stdout, given as "-".
+func newEventStream(target string) (*eventStream, error) {
+	var w io.WriteCloser
+	switch {
+	case target == "-":
+		w = nopWriteCloser{os.Stdout}
+	case strings.HasPrefix(target, "unix://"):
+		conn, err := net.Dial("unix", strings.TrimPrefix(target, "unix://"))
+		if err != nil {
+			return nil, err
+		}
+		w = conn
+	default:
+		return nil, fmt.Errorf("unsupported events target %q, expected unix:///path", target)
+	}
+	return &eventStream{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (s *eventStream) emit(e Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	if s.err = s.enc.Encode(e); s.err != nil {
+		log.Printf("Stopped writing events: %s", s.err)
+	}
+}
+
+// Progress emits the progress of a phase.
+func (s *eventStream) Progress(p ProgressEvent) {
+	s.emit(Event{Type: "progress", Progress: &p})
+}
+
+// Epoch emits the stats of an epoch.
+func (s *eventStream) Epoch(stats EpochStats, cached bool) {
+	s.emit(Event{Type: "epoch", Epoch: &stats, Cached: cached})
+}
+
+// Incomplete emits an epoch left out as incomplete.
+func (s *eventStream) Incomplete(e IncompleteEpoch) {
+	s.emit(Event{Type: "incomplete", Incomplete: &e})
+}
+
+// Done emits the end of the run, and closes the stream.
+func (s *eventStream) Done(incompletes int) {
+	if s == nil {
+		return
+	}
+	s.emit(Event{Type: "done", Incompletes: incompletes})
+	if err := s.w.Close(); err != nil {
+		log.Printf("Failed to close events stream: %s", err)
+	}
+}
+
+// nopWriteCloser keeps stdout open when a stream to it is closed.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math/big"
+
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Deneb's blob fee parameters, from which the blob base fee of a payload is
+// derived (EIP-4844).
+const (
+	minBaseFeePerBlobGas      = 1
+	blobBaseFeeUpdateFraction = 3338477
+)
+
+// executionSummary keeps the few execution payload fields the report needs,
+// so that the rest of the payload can be freed while blocks are collected.
+type executionSummary struct {
+	GasUsed   uint64
+	GasLimit  uint64
+	BaseFee   uint64 // In wei.
+	BlockHash phase0.Hash32
+	ExtraData string // Empty unless printable.
+
+	// Blob gas fields, from Deneb on. Payloads before it have no blob base
+	// fee, while later ones pay at least minBaseFeePerBlobGas.
+	BlobGasUsed   uint64
+	ExcessBlobGas uint64
+	BlobBaseFee   uint64 // In wei.
+}
+
+func newExecutionSummary(payload *bellatrix.ExecutionPayload) executionSummary {
+	if payload == nil {
+		return executionSummary{}
+	}
+	// The base fee is a little-endian uint256.
+	var be [32]byte
+	for i, b := range payload.BaseFeePerGas {
+		be[len(be)-1-i] = b
+	}
+	baseFee := new(big.Int).SetBytes(be[:])
+	summary := executionSummary{
+		GasUsed:   payload.GasUsed,
+		GasLimit:  payload.GasLimit,
+		BaseFee:   baseFee.Uint64(),
+		BlockHash: payload.BlockHash,
+		ExtraData: printableText(payload.ExtraData),
+	}
+	if !baseFee.IsUint64() {
+		summary.BaseFee = ^uint64(0)
+	}
+	return summary
+}
+
+// withBlobGas adds the blob gas fields of a Deneb payload to its summary.
+func (e executionSummary) withBlobGas(payload *deneb.ExecutionPayload) executionSummary {
+	if payload == nil {
+		return e
+	}
+	e.BlobGasUsed = payload.BlobGasUsed
+	e.ExcessBlobGas = payload.ExcessBlobGas
+	e.BlobBaseFee = blobBaseFee(payload.ExcessBlobGas)
+	return e
+}
+
+// blobBaseFee implements get_base_fee_per_blob_gas from EIP-4844, which
+// approximates minBaseFeePerBlobGas * e**(excess / blobBaseFeeUpdateFraction)
+// with fake_exponential. Fees beyond a uint64 are capped.
+func blobBaseFee(excessBlobGas uint64) uint64 {
+	factor := big.NewInt(minBaseFeePerBlobGas)
+	numerator := new(big.Int).SetUint64(excessBlobGas)
+	denominator := big.NewInt(blobBaseFeeUpdateFraction)
+
+	output := new(big.Int)
+	accum := new(big.Int).Mul(factor, denominator)
+	for i := int64(1); accum.Sign() > 0; i++ {
+		output.Add(output, accum)
+		accum.Mul(accum, numerator)
+		accum.Div(accum, new(big.Int).Mul(denominator, big.NewInt(i)))
+	}
+	output.Div(output, denominator)
+	if !output.IsUint64() {
+		return ^uint64(0)
+	}
+	return output.Uint64()
+}
+
+// ExecutionStats aggregates the execution payloads of an epoch's canonical
+// blocks, since attestation health often tracks execution-layer load.
+type ExecutionStats struct {
+	Payloads int    `json:"payloads"` // Blocks with a non-empty payload; pre-merge blocks have none.
+	GasUsed  uint64 `json:"gas_used"`
+	GasLimit uint64 `json:"gas_limit"`
+	BaseFee  uint64 `json:"base_fee"` // Sum of base fees per gas, in wei.
+
+	// BlobPayloads counts the payloads with blob gas fields, from Deneb on,
+	// whose blob gas the other blob fields sum up.
+	BlobPayloads  int    `json:"blob_payloads"`
+	BlobGasUsed   uint64 `json:"blob_gas_used"`
+	ExcessBlobGas uint64 `json:"excess_blob_gas"`
+	BlobBaseFee   uint64 `json:"blob_base_fee"` // Sum of blob base fees per blob gas, in wei.
+
+	// RelayPayloads counts the payloads delivered by the given relays, by
+	// builder pubkey in Builders.
+	RelayPayloads int            `json:"relay_payloads,omitempty"`
+	Builders      map[string]int `json:"builders,omitempty"`
+}
+
+func (s *ExecutionStats) add(e executionSummary) {
+	if e.GasLimit == 0 {
+		return
+	}
+	s.Payloads++
+	s.GasUsed += e.GasUsed
+	s.GasLimit += e.GasLimit
+	s.BaseFee += e.BaseFee
+	if e.BlobBaseFee > 0 {
+		s.BlobPayloads++
+		s.BlobGasUsed += e.BlobGasUsed
+		s.ExcessBlobGas += e.ExcessBlobGas
+		s.BlobBaseFee += e.BlobBaseFee
+	}
+}
+
+// addRelayed counts a payload delivered by a relay from a builder.
+func (s *ExecutionStats) addRelayed(builder string) {
+	if s.Builders == nil {
+		s.Builders = map[string]int{}
+	}
+	s.RelayPayloads++
+	s.Builders[builder]++
+}
+
+// MEVAdoption returns the percentage of payloads delivered by the given relays.
+func (s ExecutionStats) MEVAdoption() float64 {
+	return float64(s.RelayPayloads) / float64(s.Payloads) * 100
+}
+
+// Utilization returns the percentage of the gas limit that was used.
+func (s ExecutionStats) Utilization() float64 {
+	return float64(s.GasUsed) / float64(s.GasLimit) * 100
+}
+
+// AverageBaseFee returns the average base fee per gas, in gwei.
+func (s ExecutionStats) AverageBaseFee() float64 {
+	return float64(s.BaseFee) / float64(s.Payloads) / 1e9
+}
+
+// AverageBlobBaseFee returns the average blob base fee per blob gas, in wei,
+// of the payloads from Deneb on.
+func (s ExecutionStats) AverageBlobBaseFee() float64 {
+	return float64(s.BlobBaseFee) / float64(s.BlobPayloads)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Thresholds of the periodic miss patterns flakinessDetector looks for: over
+// at least flakyMinCycles cycles of a period, every phase of the cycle must
+// be missed at least flakyMissedRate of the time, or included at least
+// flakyIncludedRate of the time, with some phases of each.
+const (
+	flakyMinCycles    = 3
+	flakyMissedRate   = 0.9
+	flakyIncludedRate = 0.9
+)
+
+// FlakyValidator is a validator that alternates between included and missed
+// duties in a periodic pattern, as when a backup takes over on a schedule
+// without the validator's keys.
+type FlakyValidator struct {
+	Validator    phase0.ValidatorIndex `json:"validator"`
+	Attestations AttestationStats      `json:"attestations"`
+
+	// Period is the shortest cycle, in epochs, of the pattern, and
+	// MissedPhases the epochs modulo Period that duties were missed in.
+	Period       int   `json:"period"`
+	MissedPhases []int `json:"missed_phases"`
+}
+
+// FlakinessStats holds the validators of a set that missed duties in a
+// periodic pattern.
+type FlakinessStats struct {
+	Validators int              `json:"validators"` // Of the set with duties.
+	Flaky      []FlakyValidator `json:"flaky"`      // By index.
+}
+
+// flakinessDetector tracks the duties of a set of validators by epoch, to
+// find those whose misses follow a period.
+//
+// A nil flakinessDetector tracks nothing.
+type flakinessDetector struct {
+	set    map[phase0.ValidatorIndex]bool
+	duties map[phase0.ValidatorIndex]map[phase0.Epoch]AttestationStats
+}
+
+func newFlakinessDetector(set map[phase0.ValidatorIndex]bool) *flakinessDetector {
+	return &flakinessDetector{set: set, duties: map[phase0.ValidatorIndex]map[phase0.Epoch]AttestationStats{}}
+}
+
+// Add adds a duty of a validator at a slot.
+func (d *flakinessDetector) Add(validator phase0.ValidatorIndex, slot phase0.Slot, duty AttestationStats) {
+	if d == nil || !d.set[validator] || duty.Assigned == 0 {
+		return
+	}
+	epochs := d.duties[validator]
+	if epochs == nil {
+		epochs = map[phase0.Epoch]AttestationStats{}
+		d.duties[validator] = epochs
+	}
+	stats := epochs[phase0.Epoch(slot/slotsPerEpoch)]
+	stats.add(duty)
+	epochs[phase0.Epoch(slot/slotsPerEpoch)] = stats
+}
+
+// Stats finds the flaky validators of the set. It returns nil for a nil
+// *flakinessDetector.
+func (d *flakinessDetector) Stats() *FlakinessStats {
+	if d == nil {
+		return nil
+	}
+	stats := &FlakinessStats{Validators: len(d.duties), Flaky: []FlakyValidator{}}
+	for validator, epochs := range d.duties {
+		if period, missed := periodicMisses(epochs); period > 0 {
+			flaky := FlakyValidator{Validator: validator, Period: period, MissedPhases: missed}
+			for _, duty := range epochs {
+				flaky.Attestations.add(duty)
+			}
+			stats.Flaky = append(stats.Flaky, flaky)
+		}
+	}
+	sort.Slice(stats.Flaky, func(i, j int) bool { return stats.Flaky[i].Validator < stats.Flaky[j].Validator })
+	return stats
+}
+
+// periodicMisses returns the shortest period whose phases split the epochs
+// into ones whose duties were mostly missed and ones whose duties were mostly
+// included, along with the missed phases, or 0 if there's no such period.
+func periodicMisses(epochs map[phase0.Epoch]AttestationStats) (int, []int) {
+	var first, last phase0.Epoch
+	seen := false
+	for epoch := range epochs {
+		if !seen || epoch < first {
+			first = epoch
+		}
+		if !seen || epoch > last {
+			last = epoch
+		}
+		seen = true
+	}
+	span := int(last-first) + 1
+	for period := 2; period*flakyMinCycles <= span; period++ {
+		assigned := make([]int, period)
+		executed := make([]int, period)
+		for epoch, duty := range epochs {
+			phase := int(epoch % phase0.Epoch(period))
+			assigned[phase] += duty.Assigned
+			executed[phase] += duty.Executed
+		}
+		var missed []int
+		included := 0
+		periodic := true
+		for phase := 0; phase < period && periodic; phase++ {
+			rate := float64(executed[phase]) / float64(assigned[phase])
+			switch {
+			case assigned[phase] < flakyMinCycles:
+				periodic = false
+			case 1-rate >= flakyMissedRate:
+				missed = append(missed, phase)
+			case rate >= flakyIncludedRate:
+				included++
+			default:
+				periodic = false
+			}
+		}
+		if periodic && len(missed) > 0 && included > 0 {
+			return period, missed
+		}
+	}
+	return 0, nil
+}
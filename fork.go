@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// fork is a network upgrade, activated at an epoch.
+type fork struct {
+	Name  string
+	Epoch phase0.Epoch
+}
+
+// forkSchedule reads the forks from the chain configuration's *_FORK_EPOCH
+// values, sorted by epoch. Forks activated at the same epoch, as on testnets
+// that start at a later fork, are joined into one.
+func forkSchedule(spec map[string]string) []fork {
+	var forks []fork
+	for key, value := range spec {
+		name := strings.TrimSuffix(key, "_FORK_EPOCH")
+		if name == key {
+			continue
+		}
+		epoch, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		forks = append(forks, fork{strings.ToLower(name), phase0.Epoch(epoch)})
+	}
+	sort.Slice(forks, func(i, j int) bool {
+		if forks[i].Epoch != forks[j].Epoch {
+			return forks[i].Epoch < forks[j].Epoch
+		}
+		return forks[i].Name < forks[j].Name
+	})
+	var merged []fork
+	for _, f := range forks {
+		if n := len(merged); n > 0 && merged[n-1].Epoch == f.Epoch {
+			merged[n-1].Name += "+" + f.Name
+			continue
+		}
+		merged = append(merged, f)
+	}
+	return merged
+}
+
+// ForkStats compares attestations before and after a fork activated within
+// the range, since forks are when clients are most likely to misbehave.
+type ForkStats struct {
+	Name   string           `json:"name"`
+	Epoch  phase0.Epoch     `json:"epoch"`
+	Before AttestationStats `json:"before"` // From the start of the range or the previous fork.
+	After  AttestationStats `json:"after"`  // Up to the end of the range or the next fork.
+
+	// PValue is the two-sided p-value of the difference in rates, under a
+	// two-proportion z-test.
+	PValue float64 `json:"p_value"`
+}
+
+// RateDelta returns the difference in rate after the fork, in percentage points.
+func (f ForkStats) RateDelta() float64 {
+	return f.After.Rate() - f.Before.Rate()
+}
+
+// Significant reports whether the difference in rates is statistically significant.
+func (f ForkStats) Significant() bool {
+	return f.PValue < significanceLevel
+}
+
+// newForkStats compares the epochs around each fork activated after the
+// first of them and by the last, annotating the epochs forks activate at.
+// Epochs must be sorted.
+func newForkStats(forks []fork, epochs []EpochStats) []ForkStats {
+	if len(epochs) == 0 {
+		return nil
+	}
+	from, to := epochs[0].Epoch, epochs[len(epochs)-1].Epoch
+	var within []fork
+	for _, f := range forks {
+		if f.Epoch > from && f.Epoch <= to {
+			within = append(within, f)
+		}
+	}
+	var stats []ForkStats
+	for i, f := range within {
+		s := ForkStats{Name: f.Name, Epoch: f.Epoch}
+		for j := range epochs {
+			e := &epochs[j]
+			switch {
+			case e.Epoch == f.Epoch:
+				e.Fork = f.Name
+				s.After.add(e.Attestations)
+			case e.Epoch < f.Epoch && (i == 0 || e.Epoch >= within[i-1].Epoch):
+				s.Before.add(e.Attestations)
+			case e.Epoch > f.Epoch && (i == len(within)-1 || e.Epoch < within[i+1].Epoch):
+				s.After.add(e.Attestations)
+			}
+		}
+		s.PValue = rateDifferencePValue(s.Before, s.After)
+		stats = append(stats, s)
+	}
+	return stats
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// GroupStats holds the attestations of a group of validators, such as the
+// validators of a staking entity.
+type GroupStats struct {
+	Name         string           `json:"name"`
+	Validators   int              `json:"validators"`    // Validators active in the range.
+	ActiveEpochs int              `json:"active_epochs"` // Epochs the validators were active in, summed.
+	Attestations AttestationStats `json:"attestations"`
+}
+
+// DutiesPerActiveEpoch returns the average attestation duties of a
+// validator per epoch it was active in.
+func (s GroupStats) DutiesPerActiveEpoch() float64 {
+	return float64(s.Attestations.Assigned) / float64(s.ActiveEpochs)
+}
+
+// validatorGroups aggregates attestations by a label of each validator.
+// Validators without a label aren't aggregated.
+type validatorGroups struct {
+	labels map[phase0.ValidatorIndex]string
+	groups map[string]*GroupStats
+}
+
+func newValidatorGroups(labels map[phase0.ValidatorIndex]string) *validatorGroups {
+	return &validatorGroups{
+		labels: labels,
+		groups: map[string]*GroupStats{},
+	}
+}
+
+// group returns the stats of a label, creating them if needed.
+func (g *validatorGroups) group(label string) *GroupStats {
+	group := g.groups[label]
+	if group == nil {
+		group = &GroupStats{Name: label}
+		g.groups[label] = group
+	}
+	return group
+}
+
+// merge adds the stats of groups from another run. Validators active in
+// both runs can't be told apart, so each group's validators are the most
+// of either run.
+func (g *validatorGroups) merge(groups []GroupStats) {
+	for _, o := range groups {
+		group := g.group(o.Name)
+		if o.Validators > group.Validators {
+			group.Validators = o.Validators
+		}
+		group.ActiveEpochs += o.ActiveEpochs
+		group.Attestations.add(o.Attestations)
+	}
+}
+
+// Add adds a duty of the validator to its group. It does nothing on a nil
+// *validatorGroups, so that optional breakdowns don't need checks.
+func (g *validatorGroups) Add(validator phase0.ValidatorIndex, duty AttestationStats) {
+	if g == nil {
+		return
+	}
+	label, ok := g.labels[validator]
+	if !ok {
+		return
+	}
+	g.group(label).Attestations.add(duty)
+}
+
+// AddActivity counts the epochs each labelled validator was active in, out
+// of the given epochs, from its activation and exit epochs. Validators join
+// and leave throughout long ranges, so the active epochs, rather than the
+// length of the range, are what per-validator duties are measured against.
+// It does nothing on a nil *validatorGroups.
+func (g *validatorGroups) AddActivity(validators []*apiv1.Validator, epochs []phase0.Epoch) {
+	if g == nil {
+		return
+	}
+	for _, v := range validators {
+		label, ok := g.labels[v.Index]
+		if !ok {
+			continue
+		}
+		active := 0
+		for _, epoch := range epochs {
+			if v.Validator.ActivationEpoch <= epoch && epoch < v.Validator.ExitEpoch {
+				active++
+			}
+		}
+		if active == 0 {
+			continue
+		}
+		group := g.group(label)
+		group.Validators++
+		group.ActiveEpochs += active
+	}
+}
+
+// Validators returns the labelled validators. It returns nil for a nil
+// *validatorGroups.
+func (g *validatorGroups) Validators() []phase0.ValidatorIndex {
+	if g == nil {
+		return nil
+	}
+	indices := make([]phase0.ValidatorIndex, 0, len(g.labels))
+	for index := range g.labels {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
+}
+
+// List returns the groups, largest first. It returns nil for a nil *validatorGroups.
+func (g *validatorGroups) List() []GroupStats {
+	if g == nil {
+		return nil
+	}
+	list := make([]GroupStats, 0, len(g.groups))
+	for _, group := range g.groups {
+		list = append(list, *group)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Validators != list[j].Validators {
+			return list[i].Validators > list[j].Validators
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// cohortLabels labels validators by how long before an epoch they were
+// activated: less than a month, one to six months, or over six months.
+// Validators activated after the epoch count as less than a month old.
+func cohortLabels(validators []*apiv1.Validator, epoch, epochsPerMonth phase0.Epoch) map[phase0.ValidatorIndex]string {
+	labels := make(map[phase0.ValidatorIndex]string, len(validators))
+	for _, v := range validators {
+		var age phase0.Epoch
+		if v.Validator.ActivationEpoch < epoch {
+			age = epoch - v.Validator.ActivationEpoch
+		}
+		switch {
+		case age < epochsPerMonth:
+			labels[v.Index] = "<1 month"
+		case age <= 6*epochsPerMonth:
+			labels[v.Index] = "1–6 months"
+		default:
+			labels[v.Index] = ">6 months"
+		}
+	}
+	return labels
+}
+
+// withdrawalLabels labels the validators whose execution (0x01) or
+// compounding (0x02) withdrawal credentials pay out to one of addresses with
+// that address, lowercased. Validators with BLS withdrawal credentials can't
+// be attributed to an address, and are counted as unattributed instead.
+func withdrawalLabels(validators []*apiv1.Validator, addresses []string) (labels map[phase0.ValidatorIndex]string, unattributed int, err error) {
+	wanted := map[string]bool{}
+	for _, address := range addresses {
+		b, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(address), "0x"))
+		if err != nil || len(b) != 20 || !strings.HasPrefix(strings.ToLower(address), "0x") {
+			return nil, 0, fmt.Errorf("%q isn't a 0x-prefixed 20-byte address", address)
+		}
+		wanted[strings.ToLower(address)] = true
+	}
+	labels = map[phase0.ValidatorIndex]string{}
+	for _, v := range validators {
+		credentials := v.Validator.WithdrawalCredentials
+		if len(credentials) != 32 {
+			continue
+		}
+		switch credentials[0] {
+		case 0x01, 0x02:
+			if address := "0x" + hex.EncodeToString(credentials[12:]); wanted[address] {
+				labels[v.Index] = address
+			}
+		default:
+			unattributed++
+		}
+	}
+	return labels, unattributed, nil
+}
+
+// readValidatorLabels reads a CSV file whose first column is a validator
+// index, labelling each validator with the first non-empty column among
+// columns. A header row and lines starting with '#' are skipped.
+func readValidatorLabels(path string, columns ...int) (map[phase0.ValidatorIndex]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[phase0.ValidatorIndex]string, len(records))
+	for i, record := range records {
+		index, err := strconv.ParseUint(strings.TrimSpace(record[0]), 10, 64)
+		if err != nil {
+			if i == 0 {
+				continue // Header.
+			}
+			return nil, fmt.Errorf("line %d: malformed validator index %q", i+1, record[0])
+		}
+		for _, column := range columns {
+			if column < len(record) && strings.TrimSpace(record[column]) != "" {
+				labels[phase0.ValidatorIndex(index)] = strings.TrimSpace(record[column])
+				break
+			}
+		}
+	}
+	return labels, nil
+}
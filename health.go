@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HealthWeights are the weights of the metrics blended into the network
+// health score.
+type HealthWeights struct {
+	Participation float64 `json:"participation"` // Attestation rate.
+	Effectiveness float64 `json:"effectiveness"` // Under the first effectiveness model shown.
+	Proposals     float64 `json:"proposals"`     // Proposal rate.
+	Sync          float64 `json:"sync"`          // Sync committee participation.
+}
+
+// parseHealthWeights parses weights such as "participation=2,sync=0.5".
+// Metrics left out weigh 0.
+func parseHealthWeights(s string) (HealthWeights, error) {
+	var w HealthWeights
+	fields := map[string]*float64{
+		"participation": &w.Participation,
+		"effectiveness": &w.Effectiveness,
+		"proposals":     &w.Proposals,
+		"sync":          &w.Sync,
+	}
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		field := fields[name]
+		if !ok || field == nil {
+			return HealthWeights{}, fmt.Errorf("%q isn't a weight of participation, effectiveness, proposals or sync, such as sync=0.5", part)
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) {
+			return HealthWeights{}, fmt.Errorf("weight %q of %s isn't a non-negative number", value, name)
+		}
+		*field = weight
+	}
+	if w.Participation+w.Effectiveness+w.Proposals+w.Sync == 0 {
+		return HealthWeights{}, errors.New("all weights are 0")
+	}
+	return w, nil
+}
+
+// Score blends percentages of the metrics into a weighted average. Metrics
+// without data, such as sync participation before Altair, are left out and
+// the rest weighted up, so it's NaN only if none has data.
+func (w HealthWeights) Score(participation, effectiveness, proposals, sync float64) float64 {
+	var sum, total float64
+	for _, m := range []struct{ weight, value float64 }{
+		{w.Participation, participation},
+		{w.Effectiveness, effectiveness},
+		{w.Proposals, proposals},
+		{w.Sync, sync},
+	} {
+		if m.weight == 0 || math.IsNaN(m.value) || math.IsInf(m.value, 0) {
+			continue
+		}
+		sum += m.weight * m.value
+		total += m.weight
+	}
+	return sum / total
+}
+
+// SyncAggregateStats counts the sync committee positions of the sync
+// aggregates of canonical blocks, and how many of them participated.
+type SyncAggregateStats struct {
+	Positions    int `json:"positions"`
+	Participants int `json:"participants"`
+}
+
+func (s *SyncAggregateStats) add(o SyncAggregateStats) {
+	s.Positions += o.Positions
+	s.Participants += o.Participants
+}
+
+// Rate returns the percentage of positions that participated.
+func (s SyncAggregateStats) Rate() float64 {
+	return float64(s.Participants) / float64(s.Positions) * 100
+}
+
+// epochTotals sums the attestations, proposals, sync aggregates, packing,
+// duplicates, reorg-affected duties and orphaned-only votes of the report's
+// epochs.
+func (r *Report) epochTotals() EpochStats {
+	var total EpochStats
+	for _, e := range r.Epochs {
+		total.Attestations.add(e.Attestations)
+		total.Duties += e.Duties
+		total.Blocks += e.Blocks
+		total.SyncAggregates.add(e.SyncAggregates)
+		total.Packing.add(e.Packing)
+		total.Duplicates.add(e.Duplicates)
+		total.ReorgAffected.add(e.ReorgAffected)
+		total.OrphanedOnly += e.OrphanedOnly
+	}
+	return total
+}
+
+// scoreHealth sets the health scores of the report's epochs and of the
+// range, with effectiveness under the first model shown.
+func (r *Report) scoreHealth() {
+	weights, model := r.Metadata.HealthWeights, r.Metadata.EffectivenessModels[0]
+	score := func(e EpochStats) *float64 {
+		s := weights.Score(e.Attestations.Rate(), e.Attestations.EffectivenessOf(model), e.ProposalRate(), e.SyncAggregates.Rate())
+		if math.IsNaN(s) {
+			return nil
+		}
+		return &s
+	}
+	for i := range r.Epochs {
+		r.Epochs[i].HealthScore = score(r.Epochs[i])
+	}
+	r.HealthScore = score(r.epochTotals())
+}
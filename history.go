@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+// checkHistory finds how far back each node serves blocks, from the start of
+// the range up to the head. Nodes that were checkpoint synced without
+// backfilling, or that prune old blocks, answer 404 for blocks before their
+// history, which would otherwise be counted as missed proposals.
+//
+// Blocks before a node's history are fetched from the other nodes. If no node
+// serves the start of the range, it returns the first epoch that one does, to
+// trim the range to.
+func checkHistory(ctx context.Context, sched *scheduler, fromEpoch, toEpoch phase0.Epoch, head phase0.Slot) (phase0.Epoch, error) {
+	from, to := phase0.Slot(fromEpoch)*slotsPerEpoch, phase0.Slot(toEpoch+1)*slotsPerEpoch-1
+	if to > head {
+		to = head
+	}
+	var g multierror.Group
+	for i, n := range sched.nodes {
+		i, n := i, n
+		g.Go(func() error {
+			// The search's requests are sequential, so it takes up one of
+			// the node's slots throughout.
+			var start phase0.Slot
+			err := sched.DoOn(i, categoryDuties, func(node *nodeClient) error {
+				var err error
+				start, err = historyStart(ctx, node, from, to)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to check the history of %s: %w", n.Name(), err)
+			}
+			n.historyStart = start
+			return nil
+		})
+	}
+	if err := g.Wait().ErrorOrNil(); err != nil {
+		return 0, err
+	}
+	start := sched.nodes[0].historyStart
+	for _, n := range sched.nodes[1:] {
+		if n.historyStart < start {
+			start = n.historyStart
+		}
+	}
+	for _, n := range sched.nodes {
+		if n.historyStart == start {
+			continue
+		}
+		if n.historyStart > to {
+			log.Printf("Warning: node %s doesn't serve any blocks of the range, so it's only used for other requests", n.Name())
+		} else {
+			log.Printf("Warning: node %s only serves blocks from slot %d on, so older blocks are fetched from other nodes", n.Name(), n.historyStart)
+		}
+	}
+
+	if start == from {
+		return fromEpoch, nil
+	}
+	// Trim to the first epoch whose blocks are all served.
+	epoch := phase0.Epoch((start + slotsPerEpoch - 1) / slotsPerEpoch)
+	if epoch > toEpoch {
+		return 0, fmt.Errorf("no node serves the blocks of epochs %d-%d, since their history is pruned; try an archive node", fromEpoch, toEpoch)
+	}
+	log.Printf("Warning: no node serves blocks before slot %d, so the range is trimmed to start at epoch %d", start, epoch)
+	return epoch, nil
+}
+
+// historyStart binary searches for the first slot from which the node serves
+// every block up to the given slot. It returns from if the node serves the
+// whole range, and to+1 if it serves none of it.
+func historyStart(ctx context.Context, node *nodeClient, from, to phase0.Slot) (phase0.Slot, error) {
+	ok, err := servesFrom(ctx, node, from)
+	if err != nil || ok {
+		return from, err
+	}
+	lo, hi := from, to+1
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := servesFrom(ctx, node, mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
+
+// servesFrom reports whether the node serves the chain from a slot on, by
+// checking that it serves the first block at or after the slot as well as its
+// parent, which precedes the slot. The first block is looked for within an
+// epoch, since an epoch without blocks looks the same as a pruned one.
+func servesFrom(ctx context.Context, node *nodeClient, slot phase0.Slot) (bool, error) {
+	for s := slot; s < slot+slotsPerEpoch; s++ {
+		header, err := node.BlockHeader(ctx, fmt.Sprint(s))
+		if err != nil {
+			return false, err
+		}
+		if header == nil {
+			continue
+		}
+		parentRoot := header.Header.Message.ParentRoot
+		if parentRoot == (phase0.Root{}) {
+			return true, nil // Genesis.
+		}
+		parent, err := node.BlockHeader(ctx, fmt.Sprintf("%#x", parentRoot))
+		return parent != nil, err
+	}
+	return false, nil
+}
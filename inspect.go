@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+// inspectCmd prints everything known about a single slot, or the inclusion
+// of every attester of an epoch, for investigating anomalies flagged by a run.
+type inspectCmd struct {
+	Node       string `required:"" help:"Beacon node address, such as http://localhost:5052"`
+	Slot       string `help:"Slot to inspect"`
+	Epoch      string `help:"Epoch whose committees to inspect"`
+	Committees []int  `help:"With --epoch, comma-separated committee indices to restrict the output to, such as 0,1,2"`
+	Validators []int  `help:"With --epoch, comma-separated validator indices to list the duties of, instead of whole committees"`
+
+	HTTPProxy   string `help:"Proxy URL for requests to the Beacon node (defaults to the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	TLSInsecure bool   `help:"Skip verification of the Beacon node's TLS certificate"`
+	CACert      string `type:"existingfile" help:"PEM bundle of additional CA certificates to trust for Beacon node TLS"`
+}
+
+func (cmd *inspectCmd) Run() error {
+	ctx := context.Background()
+	if (cmd.Slot == "") == (cmd.Epoch == "") {
+		log.Fatal("Pass either --slot or --epoch to choose what to inspect.")
+	}
+	transport, err := newTransport(transportConfig{
+		Proxy:        cmd.HTTPProxy,
+		MaxIdleConns: 64,
+		IdleTimeout:  time.Minute,
+		TLSInsecure:  cmd.TLSInsecure,
+		CACert:       cmd.CACert,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	node := newNodeClient(cmd.Node, transport)
+	spec, err := node.Spec(ctx)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %s", cmd.Node, err)
+	}
+	if err := setPreset(spec); err != nil {
+		log.Fatal(err)
+	}
+	genesis, err := node.Genesis(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	secondsPerSlot, err := strconv.Atoi(spec["SECONDS_PER_SLOT"])
+	if err != nil {
+		log.Fatalf("Invalid SECONDS_PER_SLOT %q", spec["SECONDS_PER_SLOT"])
+	}
+	head, err := node.HeadSlot(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slotTime := func(slot phase0.Slot) time.Time {
+		return genesis.GenesisTime.Add(time.Duration(slot) * time.Duration(secondsPerSlot) * time.Second).UTC()
+	}
+	if cmd.Epoch != "" {
+		return cmd.inspectEpoch(ctx, node, head, slotTime)
+	}
+
+	n, err := strconv.ParseUint(cmd.Slot, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid slot %q", cmd.Slot)
+	}
+	slot := phase0.Slot(n)
+	if slot > head {
+		log.Fatalf("Slot %d hasn't happened yet (head is at slot %d)", slot, head)
+	}
+	inspection := slotInspection{
+		Slot: slot,
+		Time: slotTime(slot),
+	}
+	duties, err := node.ProposerDuties(ctx, phase0.Epoch(slot/slotsPerEpoch))
+	if err != nil {
+		log.Fatalf("Failed to fetch proposer duties: %s", err)
+	}
+	for _, duty := range duties {
+		if duty.Slot == slot {
+			inspection.Proposer = duty.ValidatorIndex
+		}
+	}
+
+	// Fetch the slot's block and the blocks that could include its attestations.
+	blocks, err := fetchInspectedBlocks(ctx, node, slot, inclusionWindowEnd(slot), head)
+	if err != nil {
+		log.Fatal(err)
+	}
+	inspection.Block = blocks[0]
+	for _, bl := range blocks[1:] {
+		if bl == nil {
+			continue
+		}
+		for _, att := range bl.Message.Body.Attestations {
+			if att.Data.Slot == slot {
+				inspection.Inclusions = append(inspection.Inclusions, inclusion{bl.Message.Slot, att})
+			}
+		}
+	}
+	inspection.Render(os.Stdout)
+	return nil
+}
+
+// inspectEpoch prints the inclusion of every attester of an epoch, committee
+// by committee, or the duties of the chosen validators.
+func (cmd *inspectCmd) inspectEpoch(ctx context.Context, node *nodeClient, head phase0.Slot, slotTime func(phase0.Slot) time.Time) error {
+	n, err := strconv.ParseUint(cmd.Epoch, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid epoch %q", cmd.Epoch)
+	}
+	epoch := phase0.Epoch(n)
+	fromSlot, toSlot := phase0.Slot(epoch)*slotsPerEpoch, phase0.Slot(epoch+1)*slotsPerEpoch-1
+	if fromSlot > head {
+		log.Fatalf("Epoch %d hasn't started yet (head is at slot %d)", epoch, head)
+	}
+	committees, err := node.BeaconCommittees(ctx, epoch)
+	if err != nil {
+		log.Fatalf("Failed to fetch committees: %s", err)
+	}
+	blocks, err := fetchInspectedBlocks(ctx, node, fromSlot, inclusionWindowEnd(toSlot), head)
+	if err != nil {
+		log.Fatal(err)
+	}
+	participations := newSlotParticipations(int(slotsPerEpoch))
+	for _, bl := range blocks {
+		if bl != nil && addParticipations(participations, fromSlot, *bl) > 0 {
+			log.Printf("Ignoring malformed attestations of block at slot %d", bl.Message.Slot)
+		}
+	}
+
+	inspection := epochInspection{
+		Epoch:      epoch,
+		Time:       slotTime(fromSlot),
+		Validators: len(cmd.Validators) > 0,
+	}
+	committeeFilter := map[phase0.CommitteeIndex]bool{}
+	for _, index := range cmd.Committees {
+		committeeFilter[phase0.CommitteeIndex(index)] = true
+	}
+	validatorFilter := map[phase0.ValidatorIndex]bool{}
+	for _, index := range cmd.Validators {
+		validatorFilter[phase0.ValidatorIndex(index)] = true
+	}
+	for _, c := range committees {
+		if c.Slot < fromSlot || c.Slot > toSlot || int(c.Index) >= maxCommitteesPerSlot {
+			continue
+		}
+		if len(committeeFilter) > 0 && !committeeFilter[c.Index] {
+			continue
+		}
+		committee := inspectedCommittee{Slot: c.Slot, Index: c.Index}
+		included := participations[c.Slot-fromSlot][c.Index]
+		for position, validator := range c.Validators {
+			if len(validatorFilter) > 0 && !validatorFilter[validator] {
+				continue
+			}
+			duty := inspectedDuty{Validator: validator, Position: position}
+			switch {
+			case position < len(included) && included[position].Included:
+				duty.Distance = included[position].InclusionSlot - c.Slot
+			case inclusionWindowEnd(c.Slot) > head:
+				duty.Pending = true
+			}
+			committee.Duties = append(committee.Duties, duty)
+		}
+		if len(committee.Duties) > 0 {
+			inspection.Committees = append(inspection.Committees, committee)
+		}
+	}
+	sort.Slice(inspection.Committees, func(i, j int) bool {
+		a, b := inspection.Committees[i], inspection.Committees[j]
+		return a.Slot < b.Slot || a.Slot == b.Slot && a.Index < b.Index
+	})
+	inspection.Render(os.Stdout)
+	return nil
+}
+
+// fetchInspectedBlocks fetches the blocks from one slot to another, capped
+// at the head, leaving nil for skipped slots.
+func fetchInspectedBlocks(ctx context.Context, node *nodeClient, from, to, head phase0.Slot) ([]*blockWithRoot, error) {
+	if to > head {
+		to = head
+	}
+	blocks := make([]*blockWithRoot, to-from+1)
+	var g multierror.Group
+	for s := from; s <= to; s++ {
+		s := s
+		g.Go(func() error {
+			data, err := node.SignedBeaconBlockData(ctx, fmt.Sprint(s))
+			if err != nil || data == nil {
+				return err
+			}
+			bl, err := decodeBlock(data)
+			if err != nil {
+				return err
+			}
+			blocks[s-from] = &bl
+			return nil
+		})
+	}
+	return blocks, g.Wait().ErrorOrNil()
+}
+
+// epochInspection is the inclusion of the attesters of an epoch.
+type epochInspection struct {
+	Epoch      phase0.Epoch
+	Time       time.Time
+	Validators bool // Whether only chosen validators are listed.
+	Committees []inspectedCommittee
+}
+
+type inspectedCommittee struct {
+	Slot   phase0.Slot
+	Index  phase0.CommitteeIndex
+	Duties []inspectedDuty
+}
+
+// inspectedDuty is the attestation duty of a validator, which was included
+// at Distance slots after its own, or missed if Distance is 0.
+type inspectedDuty struct {
+	Validator phase0.ValidatorIndex
+	Position  int
+	Distance  phase0.Slot
+	Pending   bool // Missing, but its inclusion window extends past the head.
+}
+
+// String returns ✅ with the inclusion distance, ❌ if missed, or ⏳ if pending.
+func (d inspectedDuty) String() string {
+	switch {
+	case d.Distance > 0:
+		return fmt.Sprintf("✅%d", d.Distance)
+	case d.Pending:
+		return "⏳"
+	default:
+		return "❌"
+	}
+}
+
+// Render prints a line of duties per committee, or a table of the chosen
+// validators' duties.
+func (e epochInspection) Render(w io.Writer) {
+	fmt.Fprintf(w, "Epoch %d, %s\n", e.Epoch, e.Time.Format(time.RFC3339))
+	fmt.Fprintf(w, "✅ included at the given distance, ❌ missed, ⏳ pending\n")
+	fmt.Fprintln(w)
+	if e.Validators {
+		tbl := table.New(w)
+		tbl.AddHeaders("Validator", "Slot", "Committee", "Position", "Inclusion")
+		for _, c := range e.Committees {
+			for _, d := range c.Duties {
+				tbl.AddRow(fmt.Sprint(d.Validator), fmt.Sprint(c.Slot), fmt.Sprint(c.Index), fmt.Sprint(d.Position), d.String())
+			}
+		}
+		tbl.Render()
+		return
+	}
+	for _, c := range e.Committees {
+		included := 0
+		cells := make([]string, len(c.Duties))
+		for i, d := range c.Duties {
+			if d.Distance > 0 {
+				included++
+			}
+			cells[i] = d.String()
+		}
+		fmt.Fprintf(w, "Slot %d, committee %d: %d of %d included\n", c.Slot, c.Index, included, len(c.Duties))
+		fmt.Fprintln(w, strings.Join(cells, " "))
+	}
+}
+
+// slotInspection is what's known about a slot.
+type slotInspection struct {
+	Slot       phase0.Slot
+	Time       time.Time
+	Proposer   phase0.ValidatorIndex // Per the proposer duties.
+	Block      *blockWithRoot        // Nil if the slot was skipped.
+	Inclusions []inclusion           // Attestations for the slot in later blocks.
+}
+
+// inclusion is an attestation aggregate and the slot of the block that
+// included it.
+type inclusion struct {
+	Slot        phase0.Slot
+	Attestation *phase0.Attestation
+}
+
+func (s slotInspection) Render(w io.Writer) {
+	fmt.Fprintf(w, "Slot %d (epoch %d, index %d), %s\n", s.Slot, s.Slot/slotsPerEpoch, s.Slot%slotsPerEpoch, s.Time.Format(time.RFC3339))
+	if s.Block == nil {
+		fmt.Fprintf(w, "No block: skipped by proposer %d\n", s.Proposer)
+	} else {
+		bl := s.Block.Message
+		graffiti := string(bytes.TrimRight(bl.Body.Graffiti[:], "\x00"))
+		fmt.Fprintf(w, "Block root: %s\n", s.Block.Root)
+		fmt.Fprintf(w, "Parent root: %s\n", bl.ParentRoot)
+		fmt.Fprintf(w, "Proposer: %d\n", bl.ProposerIndex)
+		if bl.ProposerIndex != s.Proposer {
+			fmt.Fprintf(w, "  but the duty belongs to %d\n", s.Proposer)
+		}
+		fmt.Fprintf(w, "Graffiti: %q (%s)\n", graffiti, graffitiClient(bl.Body.Graffiti))
+		if sync := bl.Body.SyncAggregate; sync != nil {
+			bits := sync.SyncCommitteeBits
+			fmt.Fprintf(w, "Sync aggregate: %d of %d (%s)\n", bits.Count(), bits.Len(),
+				percent(float64(bits.Count())/float64(bits.Len())*100))
+		}
+		fmt.Fprintf(w, "Execution: %d gas used of %d, base fee %d wei\n",
+			s.Block.Execution.GasUsed, s.Block.Execution.GasLimit, s.Block.Execution.BaseFee)
+
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Included attestations\n")
+		tbl := table.New(w)
+		tbl.AddHeaders("Attested Slot", "Committee", "Attesters", "Distance", "Target", "Head")
+		for _, att := range bl.Body.Attestations {
+			tbl.AddRow(
+				fmt.Sprint(att.Data.Slot),
+				fmt.Sprint(att.Data.Index),
+				fmt.Sprintf("%d of %d", att.AggregationBits.Count(), att.AggregationBits.Len()),
+				fmt.Sprint(s.Slot-att.Data.Slot),
+				fmt.Sprint(att.Data.Target.Epoch),
+				shortRoot(att.Data.BeaconBlockRoot),
+			)
+		}
+		tbl.Render()
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Attestations for slot %d\n", s.Slot)
+	tbl := table.New(w)
+	tbl.AddHeaders("Inclusion Slot", "Committee", "Attesters", "New Attesters", "Head")
+	seen := map[phase0.CommitteeIndex][]bool{}
+	for _, inc := range s.Inclusions {
+		att := inc.Attestation
+		committee := seen[att.Data.Index]
+		if committee == nil {
+			committee = make([]bool, att.AggregationBits.Len())
+			seen[att.Data.Index] = committee
+		}
+		fresh := 0
+		for _, i := range att.AggregationBits.BitIndices() {
+			if i < len(committee) && !committee[i] {
+				committee[i] = true
+				fresh++
+			}
+		}
+		tbl.AddRow(
+			fmt.Sprint(inc.Slot),
+			fmt.Sprint(att.Data.Index),
+			fmt.Sprintf("%d of %d", att.AggregationBits.Count(), att.AggregationBits.Len()),
+			fmt.Sprint(fresh),
+			shortRoot(att.Data.BeaconBlockRoot),
+		)
+	}
+	tbl.Render()
+}
+
+// shortRoot abbreviates a root to fit in a table cell.
+func shortRoot(root phase0.Root) string {
+	return root.String()[:10] + "…"
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// domainBeaconProposer is the domain type of block signatures.
+var domainBeaconProposer = phase0.DomainType{0x00, 0x00, 0x00, 0x00}
+
+// verifyChain checks that every block is the parent of the next one. Since
+// blocks are fetched from several nodes, a node serving bogus blocks breaks
+// the chain instead of slipping them in between genuine ones.
+//
+// Blocks must be sorted by slot and include every block in their span.
+func verifyChain(blocks []blockWithRoot) error {
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Message.ParentRoot != blocks[i-1].Root {
+			return fmt.Errorf(
+				"block at slot %d has parent root %s, but the block at slot %d has root %s",
+				blocks[i].Message.Slot, blocks[i].Message.ParentRoot, blocks[i-1].Message.Slot, blocks[i-1].Root,
+			)
+		}
+	}
+	return nil
+}
+
+// verifyCheckpoint checks the root of a block against the root every node
+// reports for its slot. Checking the newest block anchors the whole chain
+// checked by verifyChain.
+func verifyCheckpoint(ctx context.Context, sched *scheduler, bl blockWithRoot) error {
+	for i, node := range sched.nodes {
+		var root phase0.Root
+		err := sched.DoOn(i, categoryDuties, func(node *nodeClient) error {
+			var err error
+			root, err = node.BlockRoot(ctx, fmt.Sprint(bl.Message.Slot))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch block root at slot %d from %s: %w", bl.Message.Slot, redactAddress(node.address), err)
+		}
+		if root != bl.Root {
+			return fmt.Errorf(
+				"%s reports block root %s at slot %d, but the fetched block has root %s",
+				redactAddress(node.address), root, bl.Message.Slot, bl.Root,
+			)
+		}
+	}
+	return nil
+}
+
+// verifyProposerSignatures checks the signature of every block against the
+// public key of its proposer, as of the head state.
+func verifyProposerSignatures(
+	ctx context.Context,
+	sched *scheduler,
+	blocks []blockWithRoot,
+	spec map[string]string,
+	genesisValidatorsRoot phase0.Root,
+) error {
+	if err := bls.Init(bls.BLS12_381); err != nil {
+		return err
+	}
+	if err := bls.SetETHmode(bls.EthModeDraft07); err != nil {
+		return err
+	}
+
+	// Fetch the proposers' public keys.
+	var indices []phase0.ValidatorIndex
+	seen := map[phase0.ValidatorIndex]bool{}
+	for _, bl := range blocks {
+		if !seen[bl.Message.ProposerIndex] {
+			seen[bl.Message.ProposerIndex] = true
+			indices = append(indices, bl.Message.ProposerIndex)
+		}
+	}
+	var validators []*apiv1.Validator
+	err := sched.Do(categoryDuties, func(node *nodeClient) error {
+		var err error
+		validators, err = node.Validators(ctx, "head", indices)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch proposers: %w", err)
+	}
+	pubkeys := make(map[phase0.ValidatorIndex]*bls.PublicKey, len(validators))
+	for _, v := range validators {
+		// Copy keys and signatures out of their structs before passing them
+		// to cgo, which rejects pointers into memory holding Go pointers.
+		key := v.Validator.PublicKey
+		var pubkey bls.PublicKey
+		if err := pubkey.Deserialize(key[:]); err != nil {
+			return fmt.Errorf("malformed public key of validator %d: %w", v.Index, err)
+		}
+		pubkeys[v.Index] = &pubkey
+	}
+
+	// Compute the domain of each fork up front.
+	domains := map[phase0.Epoch]phase0.Domain{}
+	for _, bl := range blocks {
+		epoch := phase0.Epoch(bl.Message.Slot / slotsPerEpoch)
+		if _, ok := domains[epoch]; ok {
+			continue
+		}
+		version, err := forkVersion(spec, epoch)
+		if err != nil {
+			return err
+		}
+		domains[epoch], err = computeDomain(domainBeaconProposer, version, genesisValidatorsRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		g    multierror.Group
+		next int
+		mu   sync.Mutex
+	)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		g.Go(func() error {
+			for {
+				mu.Lock()
+				if next == len(blocks) {
+					mu.Unlock()
+					return nil
+				}
+				bl := blocks[next]
+				next++
+				mu.Unlock()
+				if bl.Message.Slot == 0 {
+					continue // The genesis block isn't signed.
+				}
+
+				pubkey, ok := pubkeys[bl.Message.ProposerIndex]
+				if !ok {
+					return fmt.Errorf("proposer %d of block at slot %d not found", bl.Message.ProposerIndex, bl.Message.Slot)
+				}
+				signingRoot, err := (&phase0.SigningData{
+					ObjectRoot: bl.Root,
+					Domain:     domains[phase0.Epoch(bl.Message.Slot/slotsPerEpoch)],
+				}).HashTreeRoot()
+				if err != nil {
+					return err
+				}
+				signature := bl.Signature
+				var sig bls.Sign
+				if err := sig.Deserialize(signature[:]); err != nil || !sig.VerifyByte(pubkey, signingRoot[:]) {
+					return fmt.Errorf("invalid proposer signature on block at slot %d", bl.Message.Slot)
+				}
+			}
+		})
+	}
+	return g.Wait().ErrorOrNil()
+}
+
+// crossClientSample is the number of canonical blocks --verify-with fetches
+// again from the other client.
+const crossClientSample = 64
+
+// verifyWithClient fetches a random sample of blocks again from a node of
+// another client implementation, and checks that their attestations are the
+// same, byte for byte, as those the blocks were fetched with. A client bug in
+// decoding or serving blocks would otherwise skew the stats unnoticed.
+// It returns the number of blocks checked.
+func verifyWithClient(ctx context.Context, other *nodeClient, blocks []blockWithRoot, rng *rand.Rand) (int, error) {
+	sample := blocks
+	if len(sample) > crossClientSample {
+		sample = make([]blockWithRoot, crossClientSample)
+		for i, j := range rng.Perm(len(blocks))[:crossClientSample] {
+			sample[i] = blocks[j]
+		}
+	}
+	var g multierror.Group
+	for _, bl := range sample {
+		bl := bl
+		g.Go(func() error {
+			data, err := other.SignedBeaconBlockData(ctx, bl.Root.String())
+			if err != nil {
+				return fmt.Errorf("failed to fetch block at slot %d from %s: %w", bl.Message.Slot, other.Name(), err)
+			}
+			if data == nil {
+				return fmt.Errorf("%s doesn't have block %s at slot %d", other.Name(), bl.Root, bl.Message.Slot)
+			}
+			theirs, err := decodeBlock(data)
+			if err != nil {
+				return fmt.Errorf("failed to decode block at slot %d from %s: %w", bl.Message.Slot, other.Name(), err)
+			}
+			ours, others := bl.Message.Body.Attestations, theirs.Message.Body.Attestations
+			if len(ours) != len(others) {
+				return fmt.Errorf("block at slot %d has %d attestations, but %d from %s", bl.Message.Slot, len(ours), len(others), other.Name())
+			}
+			for i := range ours {
+				a, err := ours[i].MarshalSSZ()
+				if err != nil {
+					return err
+				}
+				b, err := others[i].MarshalSSZ()
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(a, b) {
+					return fmt.Errorf("attestation %d of block at slot %d differs from %s", i, bl.Message.Slot, other.Name())
+				}
+			}
+			return nil
+		})
+	}
+	return len(sample), g.Wait().ErrorOrNil()
+}
+
+// forkVersion returns the version of the fork active at an epoch, according
+// to the fork epochs and versions in the spec.
+func forkVersion(spec map[string]string, epoch phase0.Epoch) (phase0.Version, error) {
+	name := "GENESIS_FORK_VERSION"
+	for _, fork := range []string{"ALTAIR", "BELLATRIX", "CAPELLA", "DENEB"} {
+		forkEpoch, err := strconv.ParseUint(spec[fork+"_FORK_EPOCH"], 10, 64)
+		if err != nil || phase0.Epoch(forkEpoch) > epoch {
+			break
+		}
+		name = fork + "_FORK_VERSION"
+	}
+	var version phase0.Version
+	b, err := hex.DecodeString(strings.TrimPrefix(spec[name], "0x"))
+	if err != nil || len(b) != len(version) {
+		return phase0.Version{}, fmt.Errorf("invalid %s %q", name, spec[name])
+	}
+	copy(version[:], b)
+	return version, nil
+}
+
+// computeDomain implements compute_domain from the consensus specs.
+func computeDomain(domainType phase0.DomainType, version phase0.Version, genesisValidatorsRoot phase0.Root) (phase0.Domain, error) {
+	forkDataRoot, err := (&phase0.ForkData{
+		CurrentVersion:        version,
+		GenesisValidatorsRoot: genesisValidatorsRoot,
+	}).HashTreeRoot()
+	if err != nil {
+		return phase0.Domain{}, err
+	}
+	var domain phase0.Domain
+	copy(domain[:], domainType[:])
+	copy(domain[len(domainType):], forkDataRoot[:])
+	return domain, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	autoConcurrencyStart = 4
+	autoConcurrencyMax   = 256
+
+	// autoMaxErrorRate is the error rate within a window above which the
+	// limit is backed off.
+	autoMaxErrorRate = 0.05
+
+	// autoMaxLatencyFactor is how much slower than the fastest window's
+	// average a window may be before the limit is considered saturated.
+	autoMaxLatencyFactor = 2
+)
+
+// limiter bounds the number of concurrent requests to a single node.
+//
+// Requests of each category are capped at their share of the limit, and
+// blocks go first: other requests only take a freed slot while no blocks
+// are waiting, or if none of their category are in flight, so that they
+// still make progress.
+//
+// In auto mode, it starts low and ramps up in windows of completed requests
+// for as long as the average latency and error rate hold, then backs off to
+// the last good limit and settles.
+type limiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	inflight int
+
+	inflightByCategory [numRequestCategories]int
+	waitingBlocks      int
+	waiting            int
+
+	auto        bool
+	settled     bool
+	window      int
+	errors      int
+	latency     time.Duration
+	bestLatency time.Duration
+	lastGood    int
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func newAutoLimiter() *limiter {
+	l := newLimiter(autoConcurrencyStart)
+	l.auto = true
+	l.lastGood = autoConcurrencyStart
+	return l
+}
+
+// Acquire blocks until a request of the category may be sent.
+func (l *limiter) Acquire(category requestCategory) {
+	l.mu.Lock()
+	l.waiting++
+	if category == categoryBlocks {
+		l.waitingBlocks++
+	}
+	for !l.admits(category) {
+		l.cond.Wait()
+	}
+	l.waiting--
+	if category == categoryBlocks {
+		l.waitingBlocks--
+	}
+	l.inflight++
+	l.inflightByCategory[category]++
+	l.mu.Unlock()
+}
+
+func (l *limiter) admits(category requestCategory) bool {
+	if l.inflight >= l.limit {
+		return false
+	}
+	inflight := l.inflightByCategory[category]
+	if category == categoryBlocks || inflight == 0 {
+		return true
+	}
+	share := int(categoryShares[category] * float64(l.limit))
+	return inflight < share && l.waitingBlocks == 0
+}
+
+// Release marks a request as done, feeding its outcome to the auto-tuner.
+func (l *limiter) Release(category requestCategory, latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	l.inflightByCategory[category]--
+	if l.auto {
+		l.observe(latency, err)
+	}
+	l.cond.Broadcast()
+}
+
+// Load returns the number of requests in flight and waiting to be admitted.
+func (l *limiter) Load() (inflight, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight, l.waiting
+}
+
+// Limit returns the current concurrency limit.
+func (l *limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *limiter) observe(latency time.Duration, err error) {
+	l.window++
+	l.latency += latency
+	if err != nil {
+		l.errors++
+	}
+	if l.window < l.limit*2 {
+		return
+	}
+
+	avgLatency := l.latency / time.Duration(l.window)
+	errorRate := float64(l.errors) / float64(l.window)
+	l.window, l.errors, l.latency = 0, 0, 0
+
+	degraded := errorRate > autoMaxErrorRate ||
+		(l.bestLatency > 0 && avgLatency > l.bestLatency*autoMaxLatencyFactor)
+	switch {
+	case degraded:
+		// Back off to the last limit that performed well and stop ramping.
+		l.limit = l.lastGood
+		if errorRate > autoMaxErrorRate && l.settled && l.limit > 1 {
+			l.limit /= 2
+			l.lastGood = l.limit
+		}
+		l.settled = true
+	case !l.settled:
+		if l.bestLatency == 0 || avgLatency < l.bestLatency {
+			l.bestLatency = avgLatency
+		}
+		l.lastGood = l.limit
+		l.limit *= 2
+		if l.limit > autoConcurrencyMax {
+			l.limit = autoConcurrencyMax
+		}
+	}
+}
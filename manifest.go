@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Manifest summarizes the inputs and outputs of a run, so that published
+// stats can be audited and reproduced.
+type Manifest struct {
+	SchemaVersion int `json:"schema_version"`
+
+	Tool       ToolInfo       `json:"tool"`
+	Network    string         `json:"network"`
+	Nodes      []ManifestNode `json:"nodes"`
+	FromEpoch  phase0.Epoch   `json:"from_epoch"`
+	ToEpoch    phase0.Epoch   `json:"to_epoch"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Timings    Timings        `json:"timings"`
+	Artifacts  []Artifact     `json:"artifacts"`
+}
+
+// ToolInfo identifies the build of this tool.
+type ToolInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// ManifestNode is a Beacon node used in the run.
+type ManifestNode struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version"`
+}
+
+// Artifact is an output file of the run.
+type Artifact struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func toolInfo() ToolInfo {
+	info := ToolInfo{Version: "(devel)", GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if build.Main.Version != "" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		if setting.Key == "vcs.revision" {
+			info.Revision = setting.Value
+		}
+	}
+	return info
+}
+
+func newArtifact(path string) (Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Path: path, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Write writes the manifest as indented JSON to path.
+func (m *Manifest) Write(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// redactAddress strips credentials and query parameters, which hosted Beacon
+// APIs often use for API keys, from a node address.
+func redactAddress(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "(invalid address)"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.String()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// mergeCmd combines the JSON reports of runs over adjacent ranges, such as
+// a backfill split across machines, into the report of a single run over
+// all of them.
+type mergeCmd struct {
+	Reports []string `arg:"" type:"existingfile" help:"JSON reports to merge, whose ranges must together cover a range without gaps or overlaps"`
+
+	JSON     string `help:"Write the merged report as JSON to the given file, or to stdout instead of the tables if '-'"`
+	Template string `type:"existingfile" help:"Render the merged report with a Go text/template file instead of the default tables"`
+}
+
+func (cmd *mergeCmd) Run() error {
+	reports := make([]Report, len(cmd.Reports))
+	for i, path := range cmd.Reports {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &reports[i]); err != nil {
+			log.Fatalf("Invalid report %s: %s", path, err)
+		}
+	}
+	merged, err := mergeReports(cmd.Reports, reports)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	switch {
+	case cmd.JSON == "-":
+		err = merged.WriteJSON(&out)
+	case cmd.Template != "":
+		err = merged.RenderTemplate(&out, cmd.Template)
+	default:
+		err = merged.Render(&out)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cmd.JSON != "" && cmd.JSON != "-" {
+		f, err := os.Create(cmd.JSON)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := merged.WriteJSON(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	_, err = os.Stdout.Write(out.Bytes())
+	return err
+}
+
+// mergeReports merges reports, named by their paths, into the report of a
+// single run over their ranges. The ranges must be adjacent, and the runs
+// on the same network with the same restrictions, so that every sum is
+// exact. Stats that are derived from the sums, such as health scores and
+// fork comparisons, are computed anew over the merged range. Some can't be
+// recovered exactly:
+//
+//   - Validators of groups are the most active in any one run, since the
+//     same validators are usually active throughout.
+//   - Forks are only known from the runs that had them within their range,
+//     so a fork activated at the first epoch of a run after the first is
+//     missed.
+//   - Slashable votes are only those found within a single run.
+//   - Validator percentiles and flakiness are left out, since they need
+//     every validator's duties, which reports don't carry.
+//   - Packing of the first epoch of each run misses the duties left behind
+//     from the epoch before it, and their late pickups.
+//   - Sync committee periods are left out, since their turnover compares
+//     committees, which reports don't carry.
+//   - Baseline comparisons are left out, since runs may be compared with
+//     different baselines.
+func mergeReports(paths []string, reports []Report) (Report, error) {
+	order := make([]int, len(reports))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return reports[order[i]].Scope.FromEpoch < reports[order[j]].Scope.FromEpoch })
+
+	first := reports[order[0]]
+	merged := Report{
+		SchemaVersion: schemaVersion,
+		Metadata:      first.Metadata,
+		Slots:         make([]AttestationStats, len(first.Slots)),
+		Reorgs:        []Reorg{},
+	}
+	merged.Metadata.Relays = nil
+	merged.Scope = Scope{
+		FromEpoch:              first.Scope.FromEpoch,
+		Committees:             first.Scope.Committees,
+		SlotIndices:            first.Scope.SlotIndices,
+		ExcludedValidators:     first.Scope.ExcludedValidators,
+		IncludingProposers:     first.Scope.IncludingProposers,
+		ExcludingReorgedDuties: first.Scope.ExcludingReorgedDuties,
+		Trimmed:                first.Scope.Trimmed,
+		RequestedFromEpoch:     first.Scope.RequestedFromEpoch,
+	}
+	relays := map[string]bool{}
+	nodes := map[string]*NodeStats{}
+	builders := builderStats{}
+	entities, regions, asns, cohorts := newValidatorGroups(nil), newValidatorGroups(nil), newValidatorGroups(nil), newValidatorGroups(nil)
+	withdrawals := newValidatorGroups(nil)
+	var forks []fork
+	temporal := false
+	for n, i := range order {
+		r, path := reports[i], paths[i]
+		switch {
+		case r.SchemaVersion != schemaVersion:
+			return Report{}, fmt.Errorf("%s has schema version %d, not %d", path, r.SchemaVersion, schemaVersion)
+		case r.Metadata.Network != first.Metadata.Network:
+			return Report{}, fmt.Errorf("%s is on %s, not %s", path, r.Metadata.Network, first.Metadata.Network)
+		case r.Sample != nil:
+			return Report{}, fmt.Errorf("%s is of a sampled run, whose estimates can't be merged", path)
+		case len(r.Slots) != len(first.Slots):
+			return Report{}, fmt.Errorf("%s has %d slots per epoch, not %d", path, len(r.Slots), len(first.Slots))
+		case !reflect.DeepEqual(r.Scope.Committees, first.Scope.Committees) ||
+			!reflect.DeepEqual(r.Scope.SlotIndices, first.Scope.SlotIndices) ||
+			r.Scope.ExcludedValidators != first.Scope.ExcludedValidators ||
+			r.Scope.IncludingProposers != first.Scope.IncludingProposers ||
+			r.Scope.ExcludingReorgedDuties != first.Scope.ExcludingReorgedDuties:
+			return Report{}, fmt.Errorf("%s is restricted to other committees, slot indices, validators or duties than %s", path, paths[order[0]])
+		}
+		if n > 0 {
+			prev := reports[order[n-1]]
+			switch {
+			case r.Scope.FromEpoch <= prev.Scope.ToEpoch:
+				return Report{}, fmt.Errorf("%s overlaps %s at epochs %d—%d", path, paths[order[n-1]], r.Scope.FromEpoch, prev.Scope.ToEpoch)
+			case r.Scope.FromEpoch > prev.Scope.ToEpoch+1:
+				return Report{}, fmt.Errorf("epochs %d—%d between %s and %s are missing", prev.Scope.ToEpoch+1, r.Scope.FromEpoch-1, paths[order[n-1]], path)
+			}
+		}
+
+		merged.Metadata.EndTime = r.Metadata.EndTime
+		if n == 0 && len(r.Metadata.Labels) > 0 {
+			merged.Metadata.Labels = map[string]string{}
+			for name, value := range r.Metadata.Labels {
+				merged.Metadata.Labels[name] = value
+			}
+		}
+		// Labels are kept where the runs agree.
+		for name, value := range merged.Metadata.Labels {
+			if r.Metadata.Labels[name] != value {
+				delete(merged.Metadata.Labels, name)
+			}
+		}
+		if r.Metadata.StartedAt.Before(merged.Metadata.StartedAt) {
+			merged.Metadata.StartedAt = r.Metadata.StartedAt
+		}
+		for _, relay := range r.Metadata.Relays {
+			if !relays[relay] {
+				relays[relay] = true
+				merged.Metadata.Relays = append(merged.Metadata.Relays, relay)
+			}
+		}
+		merged.Scope.ToEpoch = r.Scope.ToEpoch
+		merged.Scope.Slots += r.Scope.Slots
+		merged.Scope.Partial = merged.Scope.Partial || r.Scope.Partial
+		if r.Scope.HeadSlot > merged.Scope.HeadSlot {
+			merged.Scope.HeadSlot = r.Scope.HeadSlot
+		}
+
+		for _, e := range r.Epochs {
+			e.Fork = "" // Annotated anew below.
+			merged.Epochs = append(merged.Epochs, e)
+		}
+		merged.Attestations.add(r.Attestations)
+		for j := range r.Slots {
+			merged.Slots[j].add(r.Slots[j])
+		}
+		merged.Missed.AttesterFault += r.Missed.AttesterFault
+		merged.Missed.ProposerFault += r.Missed.ProposerFault
+		merged.Scope.Blocks += r.Scope.Blocks
+		merged.addClients(r.Clients)
+		merged.Reorgs = append(merged.Reorgs, r.Reorgs...)
+		merged.DoubleBlocks = append(merged.DoubleBlocks, r.DoubleBlocks...)
+		merged.SlashableVotes = append(merged.SlashableVotes, r.SlashableVotes...)
+		merged.SyncCommittee = append(merged.SyncCommittee, r.SyncCommittee...)
+		merged.StateChecks = append(merged.StateChecks, r.StateChecks...)
+		merged.Incomplete = append(merged.Incomplete, r.Incomplete...)
+		for _, f := range r.Forks {
+			forks = append(forks, fork{f.Name, f.Epoch})
+		}
+		temporal = temporal || len(r.HoursOfDay) > 0
+
+		merged.Timings.FetchBlocks += r.Timings.FetchBlocks
+		merged.Timings.SortBlocks += r.Timings.SortBlocks
+		merged.Timings.OrganizeParticipations += r.Timings.OrganizeParticipations
+		merged.Timings.CalculateParticipation += r.Timings.CalculateParticipation
+		merged.Timings.DownloadedBytes += r.Timings.DownloadedBytes
+		for _, node := range r.Nodes {
+			if nodes[node.Address] == nil {
+				nodes[node.Address] = &NodeStats{Address: node.Address, Name: node.Name}
+			}
+			nodes[node.Address].Requests += node.Requests
+			nodes[node.Address].Bytes += node.Bytes
+		}
+		for _, b := range r.Builders {
+			if builders[b.Pubkey] == nil {
+				builders[b.Pubkey] = &BuilderStats{Pubkey: b.Pubkey}
+			}
+			builders[b.Pubkey].Name = b.Name
+			builders[b.Pubkey].Blocks += b.Blocks
+		}
+		entities.merge(r.Entities)
+		regions.merge(r.Regions)
+		asns.merge(r.ASNs)
+		cohorts.merge(r.Cohorts)
+		withdrawals.merge(r.Withdrawals)
+		// Withdrawal credentials are read at the head, so the count of the
+		// run over the latest epochs is kept.
+		merged.UnattributedWithdrawals = r.UnattributedWithdrawals
+	}
+
+	for _, i := range order {
+		for _, node := range reports[i].Nodes {
+			if stats := nodes[node.Address]; stats != nil {
+				merged.Nodes = append(merged.Nodes, *stats)
+				delete(nodes, node.Address)
+			}
+		}
+	}
+	merged.Builders = builders.List()
+	merged.Entities = entities.List()
+	merged.Regions = regions.List()
+	merged.ASNs = asns.List()
+	merged.Cohorts = cohorts.List()
+	merged.Withdrawals = withdrawals.List()
+	merged.scoreHealth()
+	merged.Transition = newTransitionStats(merged.Slots)
+	merged.Forks = newForkStats(forks, merged.Epochs)
+	if temporal {
+		// Epochs are timed from the start of the range, as the preset the
+		// runs were on isn't at hand.
+		epochDuration := merged.Metadata.EndTime.Sub(merged.Metadata.StartTime) / time.Duration(merged.Scope.Epochs())
+		merged.HoursOfDay, merged.DaysOfWeek = newTimeBuckets(merged.Epochs, func(epoch phase0.Epoch) time.Time {
+			return merged.Metadata.StartTime.Add(time.Duration(epoch-merged.Scope.FromEpoch) * epochDuration)
+		})
+	}
+	return merged, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WriteTextfile writes the report's aggregate metrics in the OpenMetrics
+// text format, for node_exporter's textfile collector. The file is replaced
+// atomically, so the collector never reads a partial file.
+func (r *Report) WriteTextfile(path string) error {
+	// Run labels come first on every sample.
+	var runLabels []string
+	for name, value := range r.Metadata.Labels {
+		runLabels = append(runLabels, fmt.Sprintf(`%s="%s"`, name, labelValue(value)))
+	}
+	sort.Strings(runLabels)
+	var b bytes.Buffer
+	gauge := func(name, help string, samples ...metricSample) {
+		fmt.Fprintf(&b, "# TYPE ges_%s gauge\n# HELP ges_%s %s\n", name, name, help)
+		for _, s := range samples {
+			labels := s.labels
+			if len(runLabels) > 0 {
+				all := runLabels
+				if labels != "" {
+					all = append(append([]string{}, runLabels...), strings.Trim(labels, "{}"))
+				}
+				labels = "{" + strings.Join(all, ",") + "}"
+			}
+			fmt.Fprintf(&b, "ges_%s%s %v\n", name, labels, s.value)
+		}
+	}
+
+	gauge("from_epoch", "First epoch of the range.", metricSample{"", r.Scope.FromEpoch})
+	gauge("to_epoch", "Last epoch of the range.", metricSample{"", r.Scope.ToEpoch})
+	gauge("attestations_assigned", "Attestation duties in the range.", metricSample{"", r.Attestations.Assigned})
+	gauge("attestations_executed", "Attestation duties that were included.", metricSample{"", r.Attestations.Executed})
+	gauge("attestations_pending", "Attestation duties whose inclusion window is still open.", metricSample{"", r.Attestations.Pending})
+	gauge("attestation_rate", "Ratio of assigned attestations that were included.", metricSample{"", ratio(r.Attestations.Rate())})
+	gauge("attestation_effectiveness", "Reciprocal of the average inclusion delay.", metricSample{"", ratio(r.Attestations.Effectiveness())})
+	var models []metricSample
+	for _, model := range effectivenessModels {
+		models = append(models, metricSample{fmt.Sprintf(`{model="%s"}`, model), ratio(r.Attestations.EffectivenessOf(model))})
+	}
+	gauge("attestation_effectiveness_by_model", "Attestation effectiveness under each effectiveness model.", models...)
+	gauge("attestations_missed", "Attestations never included, by likely fault.",
+		metricSample{`{fault="attester"}`, r.Missed.AttesterFault},
+		metricSample{`{fault="proposer"}`, r.Missed.ProposerFault},
+	)
+
+	var rates, effectiveness []metricSample
+	for i, stats := range r.Slots {
+		if !r.Scope.IncludesSlotIndex(i) {
+			continue
+		}
+		labels := fmt.Sprintf(`{slot_index="%d"}`, i)
+		rates = append(rates, metricSample{labels, ratio(stats.Rate())})
+		effectiveness = append(effectiveness, metricSample{labels, ratio(stats.Effectiveness())})
+	}
+	gauge("slot_attestation_rate", "Attestation rate by slot-in-epoch index.", rates...)
+	gauge("slot_attestation_effectiveness", "Attestation effectiveness by slot-in-epoch index.", effectiveness...)
+
+	gauge("proposal_rate", "Ratio of slots with a canonical block.", metricSample{"", ratio(r.Scope.ProposalRate())})
+	if r.HealthScore != nil {
+		gauge("health_score", "Weighted blend of attestation rate, effectiveness, proposal rate and sync participation, out of 100.", metricSample{"", *r.HealthScore})
+	}
+	gauge("reorgs", "Blocks reorged out within the range.", metricSample{"", len(r.Reorgs)})
+	var clients []metricSample
+	for _, c := range r.Clients {
+		clients = append(clients, metricSample{fmt.Sprintf(`{client="%s"}`, labelValue(c.Client)), ratio(c.Delay1Rate())})
+	}
+	gauge("client_delay1_rate", "Ratio of attestations included at delay 1, by the client of the next block.", clients...)
+	b.WriteString("# EOF\n")
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+type metricSample struct {
+	labels string
+	value  interface{}
+}
+
+// ratio converts a percentage to the ratio Prometheus conventions expect.
+func ratio(percent float64) float64 {
+	return percent / 100
+}
+
+// reservedLabelNames are the label names metrics use themselves.
+var reservedLabelNames = map[string]bool{"model": true, "fault": true, "slot_index": true, "client": true}
+
+// checkLabelNames checks that run labels are valid Prometheus label names
+// that don't clash with the labels of the metrics themselves.
+func checkLabelNames(labels map[string]string) error {
+	for name := range labels {
+		valid := name != "" && !strings.HasPrefix(name, "__")
+		for i, c := range name {
+			if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+				valid = false
+			}
+		}
+		switch {
+		case !valid:
+			return fmt.Errorf("%q isn't a valid label name", name)
+		case reservedLabelNames[name]:
+			return fmt.Errorf("label %q is used by metrics", name)
+		}
+	}
+	return nil
+}
+
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
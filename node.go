@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+const nodeTimeout = 2 * time.Minute
+
+// transportConfig tunes the HTTP transport shared by all node clients.
+type transportConfig struct {
+	Proxy        string
+	MaxIdleConns int
+	IdleTimeout  time.Duration
+	TLSInsecure  bool
+	CACert       string
+}
+
+func newTransport(cfg transportConfig) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   nodeTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConns,
+		IdleConnTimeout:     cfg.IdleTimeout,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: cfg.TLSInsecure, // #nosec G402 -- opted into with --tls-insecure.
+		},
+	}
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACert)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return transport, nil
+}
+
+// nodeClient talks to a Beacon node over the standard Beacon API.
+//
+// go-eth2-client doesn't let us configure or observe its HTTP client, so
+// requests are made here, decoding into its spec types.
+type nodeClient struct {
+	address string
+	name    string // Alias given with --node name=address, if any.
+	client  *http.Client
+	version string
+	peerID  string  // Empty if the node doesn't expose its identity.
+	weight  float64 // Share of requests relative to other nodes, given with ?weight=.
+
+	// historyStart is the first slot the node serves blocks from, within
+	// the range, which is later than its start if the node is pruned.
+	historyStart phase0.Slot
+
+	requests atomic.Int64
+	bytes    atomic.Int64
+}
+
+func newNodeClient(address string, transport http.RoundTripper) *nodeClient {
+	if !strings.HasPrefix(address, "http") {
+		address = "http://" + address
+	}
+	return &nodeClient{
+		address: address,
+		weight:  1,
+		client: &http.Client{
+			Timeout:   nodeTimeout,
+			Transport: transport,
+		},
+	}
+}
+
+// newNodeClients creates clients for node addresses, each optionally aliased
+// as name=address and weighted with a weight query parameter, such as
+// http://localhost:5052?weight=4. Addresses given more than once are only
+// used once.
+func newNodeClients(flags []string, transport http.RoundTripper) ([]*nodeClient, error) {
+	var nodes []*nodeClient
+	byAddress := map[string]*nodeClient{}
+	byName := map[string]*nodeClient{}
+	for _, flag := range flags {
+		name, address := parseNodeFlag(flag)
+		node := newNodeClient(address, transport)
+		node.name = name
+		address, weight, err := splitNodeWeight(node.address)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", redactAddress(node.address), err)
+		}
+		node.address, node.weight = address, weight
+		if other := byAddress[strings.TrimSuffix(node.address, "/")]; other != nil {
+			log.Printf("Warning: node %s is given more than once, using it once", other.Name())
+			continue
+		}
+		if other := byName[name]; name != "" && other != nil {
+			return nil, fmt.Errorf("node name %q is given to both %s and %s", name, redactAddress(other.address), redactAddress(node.address))
+		}
+		byAddress[strings.TrimSuffix(node.address, "/")] = node
+		byName[name] = node
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// parseNodeFlag splits a node given as name=address into its alias and
+// address. Addresses may contain '=' in their query, so the alias is only
+// split off if it precedes any ':', '/' or '?'.
+func parseNodeFlag(flag string) (name, address string) {
+	name, address, ok := strings.Cut(flag, "=")
+	if !ok || name == "" || strings.ContainsAny(name, ":/?") {
+		return "", flag
+	}
+	return name, address
+}
+
+// splitNodeWeight splits the weight query parameter off a node address, so
+// that it isn't sent to the node. Nodes without one weigh 1.
+func splitNodeWeight(address string) (string, float64, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", 0, err
+	}
+	query := u.Query()
+	if !query.Has("weight") {
+		return address, 1, nil
+	}
+	weight, err := strconv.ParseFloat(query.Get("weight"), 64)
+	if err != nil || weight <= 0 || math.IsInf(weight, 0) {
+		return "", 0, fmt.Errorf("weight %q isn't a positive number", query.Get("weight"))
+	}
+	query.Del("weight")
+	u.RawQuery = query.Encode()
+	return u.String(), weight, nil
+}
+
+// dedupeNodeIdentities drops nodes with the same peer ID as an earlier node,
+// such as the same node reached through different addresses, which would
+// otherwise be counted as independent sources.
+func dedupeNodeIdentities(nodes []*nodeClient) []*nodeClient {
+	var unique []*nodeClient
+	byPeerID := map[string]*nodeClient{}
+	for _, n := range nodes {
+		if other := byPeerID[n.peerID]; n.peerID != "" && other != nil {
+			log.Printf("Warning: nodes %s and %s are the same node (peer ID %s), using only %s", other.Name(), n.Name(), n.peerID, other.Name())
+			continue
+		}
+		byPeerID[n.peerID] = n
+		unique = append(unique, n)
+	}
+	return unique
+}
+
+// Name returns the node's alias, or its address without credentials if it
+// has none.
+func (n *nodeClient) Name() string {
+	if n.name != "" {
+		return n.name
+	}
+	return redactAddress(n.address)
+}
+
+// get sends a GET request for JSON and returns the response body.
+// If the node responds with 404, it returns nil for both the body and the error.
+func (n *nodeClient) get(ctx context.Context, endpoint string) ([]byte, error) {
+	data, _, err := n.request(ctx, endpoint, "application/json")
+	return data, err
+}
+
+// request sends a GET request and returns the response body and headers.
+// If the node responds with 404, it returns a nil body without an error.
+func (n *nodeClient) request(ctx context.Context, endpoint, accept string) ([]byte, http.Header, error) {
+	u, err := url.Parse(n.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	path, query, _ := strings.Cut(endpoint, "?")
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	if query != "" {
+		values := u.Query()
+		extra, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range extra {
+			values[k] = v
+		}
+		u.RawQuery = values.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	n.requests.Add(1)
+	n.bytes.Add(int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response from %s: %w", endpoint, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp.Header, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, &httpStatusError{endpoint, resp.StatusCode, data}
+	}
+	return data, resp.Header, nil
+}
+
+// httpStatusError is the error of a request answered with a status other
+// than 2xx or 404.
+type httpStatusError struct {
+	Endpoint   string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("GET %s failed with status %d: %s", e.Endpoint, e.StatusCode, e.Body)
+}
+
+// getJSON sends a GET request and decodes the response body into v.
+// Unlike get, it treats a 404 as an error.
+func (n *nodeClient) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	data, err := n.get(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("GET %s: not found", endpoint)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// SignedBeaconBlockData fetches the undecoded response for a block ID, so
+// that decoding can be done apart from the request, with decodeBlock.
+// If the block isn't available, it returns nil without an error.
+func (n *nodeClient) SignedBeaconBlockData(ctx context.Context, blockID string) ([]byte, error) {
+	return n.get(ctx, "/eth/v2/beacon/blocks/"+blockID)
+}
+
+// decodeSignedBeaconBlock decodes a v2 block response by its version.
+func decodeSignedBeaconBlock(data []byte) (*spec.VersionedSignedBeaconBlock, error) {
+	var metadata struct {
+		Version spec.DataVersion `json:"version"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse block response: %w", err)
+	}
+	block := &spec.VersionedSignedBeaconBlock{Version: metadata.Version}
+	var resp struct {
+		Data interface{} `json:"data"`
+	}
+	switch metadata.Version {
+	case spec.DataVersionPhase0:
+		block.Phase0 = &phase0.SignedBeaconBlock{}
+		resp.Data = block.Phase0
+	case spec.DataVersionAltair:
+		block.Altair = &altair.SignedBeaconBlock{}
+		resp.Data = block.Altair
+	case spec.DataVersionBellatrix:
+		block.Bellatrix = &bellatrix.SignedBeaconBlock{}
+		resp.Data = block.Bellatrix
+	case spec.DataVersionCapella:
+		block.Capella = &capella.SignedBeaconBlock{}
+		resp.Data = block.Capella
+	case spec.DataVersionDeneb:
+		block.Deneb = &deneb.SignedBeaconBlock{}
+		resp.Data = block.Deneb
+	default:
+		return nil, fmt.Errorf("unhandled block version %s", metadata.Version)
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse %s block: %w", metadata.Version, err)
+	}
+	return block, nil
+}
+
+// NodeVersion fetches the node's software version, confirming that the node is reachable.
+func (n *nodeClient) NodeVersion(ctx context.Context) (string, error) {
+	var resp struct {
+		Data struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}
+	if err := n.getJSON(ctx, "/eth/v1/node/version", &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.Version, nil
+}
+
+// PeerID fetches the node's libp2p peer ID, which identifies it regardless of
+// the address it's reached at.
+func (n *nodeClient) PeerID(ctx context.Context) (string, error) {
+	var resp struct {
+		Data struct {
+			PeerID string `json:"peer_id"`
+		} `json:"data"`
+	}
+	if err := n.getJSON(ctx, "/eth/v1/node/identity", &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.PeerID, nil
+}
+
+// Spec fetches the node's chain configuration. Values are returned as sent by
+// the node, which encodes numbers as strings.
+func (n *nodeClient) Spec(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := n.getJSON(ctx, "/eth/v1/config/spec", &resp); err != nil {
+		return nil, err
+	}
+	spec := make(map[string]string, len(resp.Data))
+	for k, v := range resp.Data {
+		if s, ok := v.(string); ok {
+			spec[k] = s
+		}
+	}
+	return spec, nil
+}
+
+// HeadSlot fetches the slot of the node's head block.
+func (n *nodeClient) HeadSlot(ctx context.Context) (phase0.Slot, error) {
+	var resp struct {
+		Data *apiv1.BeaconBlockHeader `json:"data"`
+	}
+	if err := n.getJSON(ctx, "/eth/v1/beacon/headers/head", &resp); err != nil {
+		return 0, err
+	}
+	return resp.Data.Header.Message.Slot, nil
+}
+
+// BlockHeader fetches the header of a block given a block ID.
+// If the block isn't available, it returns nil without an error.
+func (n *nodeClient) BlockHeader(ctx context.Context, blockID string) (*apiv1.BeaconBlockHeader, error) {
+	data, err := n.get(ctx, "/eth/v1/beacon/headers/"+blockID)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var resp struct {
+		Data *apiv1.BeaconBlockHeader `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse block header: %w", err)
+	}
+	return resp.Data, nil
+}
+
+// BlockRoot fetches the root of a block.
+func (n *nodeClient) BlockRoot(ctx context.Context, blockID string) (phase0.Root, error) {
+	var resp struct {
+		Data struct {
+			Root string `json:"root"`
+		} `json:"data"`
+	}
+	if err := n.getJSON(ctx, fmt.Sprintf("/eth/v1/beacon/blocks/%s/root", blockID), &resp); err != nil {
+		return phase0.Root{}, err
+	}
+	return parseRoot(resp.Data.Root)
+}
+
+// parseRoot decodes a 0x-prefixed hex root.
+func parseRoot(s string) (phase0.Root, error) {
+	var root phase0.Root
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(root) {
+		return phase0.Root{}, fmt.Errorf("malformed root %q", s)
+	}
+	copy(root[:], b)
+	return root, nil
+}
+
+// Genesis fetches the genesis details of the chain.
+func (n *nodeClient) Genesis(ctx context.Context) (*apiv1.Genesis, error) {
+	var resp struct {
+		Data *apiv1.Genesis `json:"data"`
+	}
+	if err := n.getJSON(ctx, "/eth/v1/beacon/genesis", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// BeaconCommittees fetches the committees of an epoch, from the state at its first slot.
+func (n *nodeClient) BeaconCommittees(ctx context.Context, epoch phase0.Epoch) ([]*apiv1.BeaconCommittee, error) {
+	var resp struct {
+		Data []*apiv1.BeaconCommittee `json:"data"`
+	}
+	endpoint := fmt.Sprintf("/eth/v1/beacon/states/%d/committees?epoch=%d", uint64(epoch)*uint64(slotsPerEpoch), epoch)
+	if err := n.getJSON(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// SyncCommittee fetches the sync committee of an epoch, from the state at its
+// first slot. Validators are listed by position, so one may appear more than
+// once.
+func (n *nodeClient) SyncCommittee(ctx context.Context, epoch phase0.Epoch) ([]phase0.ValidatorIndex, error) {
+	var resp struct {
+		Data *apiv1.SyncCommittee `json:"data"`
+	}
+	endpoint := fmt.Sprintf("/eth/v1/beacon/states/%d/sync_committees?epoch=%d", uint64(epoch)*uint64(slotsPerEpoch), epoch)
+	if err := n.getJSON(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, fmt.Errorf("GET %s: no sync committee", endpoint)
+	}
+	return resp.Data.Validators, nil
+}
+
+// ProposerDuties fetches the proposer duties of an epoch.
+func (n *nodeClient) ProposerDuties(ctx context.Context, epoch phase0.Epoch) ([]*apiv1.ProposerDuty, error) {
+	var resp struct {
+		Data []*apiv1.ProposerDuty `json:"data"`
+	}
+	if err := n.getJSON(ctx, fmt.Sprintf("/eth/v1/validator/duties/proposer/%d", epoch), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Validators fetches the given validators from a state.
+func (n *nodeClient) Validators(ctx context.Context, stateID string, indices []phase0.ValidatorIndex) ([]*apiv1.Validator, error) {
+	var validators []*apiv1.Validator
+	// Request a batch at a time to keep URLs short.
+	const batchSize = 100
+	for len(indices) > 0 {
+		batch := indices
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		indices = indices[len(batch):]
+		ids := make([]string, len(batch))
+		for i, index := range batch {
+			ids[i] = fmt.Sprint(index)
+		}
+		var resp struct {
+			Data []*apiv1.Validator `json:"data"`
+		}
+		endpoint := fmt.Sprintf("/eth/v1/beacon/states/%s/validators?id=%s", stateID, strings.Join(ids, ","))
+		if err := n.getJSON(ctx, endpoint, &resp); err != nil {
+			return nil, err
+		}
+		validators = append(validators, resp.Data...)
+	}
+	return validators, nil
+}
+
+// AllValidators fetches every validator of a state. At mainnet sizes, the
+// response runs into hundreds of megabytes.
+func (n *nodeClient) AllValidators(ctx context.Context, stateID string) ([]*apiv1.Validator, error) {
+	var resp struct {
+		Data []*apiv1.Validator `json:"data"`
+	}
+	if err := n.getJSON(ctx, fmt.Sprintf("/eth/v1/beacon/states/%s/validators", stateID), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Finality fetches the finality checkpoints of a state.
+func (n *nodeClient) Finality(ctx context.Context, stateID string) (*apiv1.Finality, error) {
+	var resp struct {
+		Data *apiv1.Finality `json:"data"`
+	}
+	if err := n.getJSON(ctx, fmt.Sprintf("/eth/v1/beacon/states/%s/finality_checkpoints", stateID), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// BeaconState fetches a beacon state. States are requested as SSZ, which is
+// far smaller and quicker to decode than JSON at mainnet sizes.
+func (n *nodeClient) BeaconState(ctx context.Context, stateID string) (*spec.VersionedBeaconState, error) {
+	endpoint := "/eth/v2/debug/beacon/states/" + stateID
+	data, header, err := n.request(ctx, endpoint, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("GET %s: not found", endpoint)
+	}
+
+	var version spec.DataVersion
+	if err := version.UnmarshalJSON([]byte(fmt.Sprintf("%q", header.Get("Eth-Consensus-Version")))); err != nil {
+		return nil, fmt.Errorf("failed to parse state version: %w", err)
+	}
+	state := &spec.VersionedBeaconState{Version: version}
+	switch version {
+	case spec.DataVersionAltair:
+		state.Altair = &altair.BeaconState{}
+		err = state.Altair.UnmarshalSSZ(data)
+	case spec.DataVersionBellatrix:
+		state.Bellatrix = &bellatrix.BeaconState{}
+		err = state.Bellatrix.UnmarshalSSZ(data)
+	case spec.DataVersionCapella:
+		state.Capella = &capella.BeaconState{}
+		err = state.Capella.UnmarshalSSZ(data)
+	case spec.DataVersionDeneb:
+		state.Deneb = &deneb.BeaconState{}
+		err = state.Deneb.UnmarshalSSZ(data)
+	default:
+		return nil, fmt.Errorf("unhandled state version %s", version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s state: %w", version, err)
+	}
+	return state, nil
+}
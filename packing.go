@@ -0,0 +1,136 @@
+package main
+
+import "github.com/attestantio/go-eth2-client/spec/phase0"
+
+// PackingStats measures how fully blocks were packed with attestations, to
+// tell blocks that had nothing left to pack from blocks whose proposers left
+// attestations out. Attestations are left behind by a block if a later block
+// included them, so they were known and could have been packed.
+type PackingStats struct {
+	Blocks       int `json:"blocks"`
+	Attestations int `json:"attestations"` // Aggregates included.
+	Capacity     int `json:"capacity"`     // MAX_ATTESTATIONS of every block.
+	Full         int `json:"full"`         // Blocks at capacity.
+
+	// Blocks with room to spare that left duties behind, and how many.
+	LeftBehind       int `json:"left_behind"`
+	LeftBehindDuties int `json:"left_behind_duties"`
+
+	// NothingToPack counts blocks with room to spare that left no duty
+	// behind. Duties no block included may still have been outstanding,
+	// but nothing shows their attestations existed.
+	NothingToPack int `json:"nothing_to_pack"`
+
+	// Duties the blocks included first: OnTimeDuties at the earliest block
+	// that could include them, and LatePickups after earlier blocks left
+	// them behind, as when aggregates reach proposers late.
+	OnTimeDuties int `json:"on_time_duties"`
+	LatePickups  int `json:"late_pickups"`
+}
+
+// addBlock counts a block, given its attestations, the duties it left behind
+// and the duties it included first, on time and late.
+func (s *PackingStats) addBlock(attestations, leftBehind int, pickups blockPickups) {
+	s.Blocks++
+	s.Attestations += attestations
+	s.Capacity += maxAttestations
+	s.OnTimeDuties += pickups.OnTime
+	s.LatePickups += pickups.Late
+	switch {
+	case attestations >= maxAttestations:
+		s.Full++
+	case leftBehind > 0:
+		s.LeftBehind++
+		s.LeftBehindDuties += leftBehind
+	default:
+		s.NothingToPack++
+	}
+}
+
+func (s *PackingStats) add(o PackingStats) {
+	s.Blocks += o.Blocks
+	s.Attestations += o.Attestations
+	s.Capacity += o.Capacity
+	s.Full += o.Full
+	s.LeftBehind += o.LeftBehind
+	s.LeftBehindDuties += o.LeftBehindDuties
+	s.NothingToPack += o.NothingToPack
+	s.OnTimeDuties += o.OnTimeDuties
+	s.LatePickups += o.LatePickups
+}
+
+// LatePickupRate returns the percentage of the duties the blocks included
+// first that were picked up late.
+func (s PackingStats) LatePickupRate() float64 {
+	return float64(s.LatePickups) / float64(s.OnTimeDuties+s.LatePickups) * 100
+}
+
+// Utilization returns the percentage of the blocks' capacity for
+// attestations that was used.
+func (s PackingStats) Utilization() float64 {
+	return float64(s.Attestations) / float64(s.Capacity) * 100
+}
+
+// leftBehindBySlot counts, for each slot from fromSlot up to the last slot
+// of the participations, the duties a block at the slot could have included
+// but left for a later block. Each duty is left behind by the slots from
+// its own up to its inclusion, which are summed over a difference array.
+// Only the duties of the given participations are counted, so blocks at
+// the start of the range miss the duties of slots before it.
+func leftBehindBySlot(fromSlot phase0.Slot, slotCommitteeParticipations [][]CommitteeParticipation) []int {
+	n := len(slotCommitteeParticipations)
+	diff := make([]int, n+1)
+	for i, committees := range slotCommitteeParticipations {
+		for _, participations := range committees {
+			for _, p := range participations {
+				if !p.Included || int(p.InclusionSlot-fromSlot) <= i+1 {
+					continue
+				}
+				diff[i+1]++
+				if end := int(p.InclusionSlot - fromSlot); end < n {
+					diff[end]--
+				}
+			}
+		}
+	}
+	counts := make([]int, n)
+	running := 0
+	for i := range counts {
+		running += diff[i]
+		counts[i] = running
+	}
+	return counts
+}
+
+// blockPickups counts the duties a block included first.
+type blockPickups struct {
+	OnTime, Late int
+}
+
+// pickupsBySlot counts, for each slot from fromSlot up to the last slot of
+// the participations, the duties the block at the slot included first, on
+// time if no earlier block could have included them. Like leftBehindBySlot,
+// only the duties of the given participations are counted, so blocks at the
+// start of the range miss the late pickups of slots before it.
+func pickupsBySlot(fromSlot phase0.Slot, slotCommitteeParticipations [][]CommitteeParticipation, chain *chainIndex) []blockPickups {
+	pickups := make([]blockPickups, len(slotCommitteeParticipations))
+	for i, committees := range slotCommitteeParticipations {
+		next, ok := chain.Next(fromSlot + phase0.Slot(i))
+		if !ok {
+			continue
+		}
+		for _, participations := range committees {
+			for _, p := range participations {
+				if !p.Included || int(p.InclusionSlot-fromSlot) >= len(pickups) {
+					continue
+				}
+				if p.InclusionSlot == next.Message.Slot {
+					pickups[p.InclusionSlot-fromSlot].OnTime++
+				} else {
+					pickups[p.InclusionSlot-fromSlot].Late++
+				}
+			}
+		}
+	}
+	return pickups
+}
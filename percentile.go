@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// ValidatorPercentile ranks a validator's attestation rate among every
+// validator with duties in the range.
+type ValidatorPercentile struct {
+	Validator    phase0.ValidatorIndex `json:"validator"`
+	Attestations AttestationStats      `json:"attestations"`
+
+	// Percentile is the percentage of validators with a lower rate,
+	// counting those with the same rate as half lower, so that 95 or more
+	// is the top 5%.
+	Percentile float64 `json:"percentile"`
+}
+
+// PercentileStats ranks a set of validators against the network.
+type PercentileStats struct {
+	Validators []ValidatorPercentile `json:"validators"` // Those of the set with duties, by index.
+
+	// Attestations are the set's, whose rate Percentile ranks as if it
+	// were a single validator's. Median is the median percentile of the
+	// set's validators.
+	Attestations AttestationStats `json:"attestations"`
+	Percentile   float64          `json:"percentile"`
+	Median       float64          `json:"median"`
+
+	Network int `json:"network"` // Validators ranked against.
+}
+
+// validatorPerformance tallies the attestations of every validator, to
+// rank a set of them against the rest.
+//
+// A nil validatorPerformance tallies nothing.
+type validatorPerformance struct {
+	set    map[phase0.ValidatorIndex]bool
+	duties map[phase0.ValidatorIndex]*AttestationStats
+}
+
+func newValidatorPerformance(set map[phase0.ValidatorIndex]bool) *validatorPerformance {
+	return &validatorPerformance{set: set, duties: map[phase0.ValidatorIndex]*AttestationStats{}}
+}
+
+// Add adds a duty of a validator.
+func (p *validatorPerformance) Add(validator phase0.ValidatorIndex, duty AttestationStats) {
+	if p == nil {
+		return
+	}
+	stats := p.duties[validator]
+	if stats == nil {
+		stats = &AttestationStats{}
+		p.duties[validator] = stats
+	}
+	stats.add(duty)
+}
+
+// Stats ranks the set. Validators whose duties are all pending aren't ranked.
+// It returns nil for a nil *validatorPerformance.
+func (p *validatorPerformance) Stats() *PercentileStats {
+	if p == nil {
+		return nil
+	}
+	var rates []float64
+	for _, stats := range p.duties {
+		if stats.Assigned > 0 {
+			rates = append(rates, stats.Rate())
+		}
+	}
+	sort.Float64s(rates)
+	// percentile ranks a rate by the midpoint of the rates equal to it.
+	percentile := func(rate float64) float64 {
+		lower := sort.SearchFloat64s(rates, rate)
+		upper := sort.Search(len(rates), func(i int) bool { return rates[i] > rate })
+		return (float64(lower) + float64(upper-lower)/2) / float64(len(rates)) * 100
+	}
+
+	stats := &PercentileStats{Validators: []ValidatorPercentile{}, Network: len(rates)}
+	for validator := range p.set {
+		duties := p.duties[validator]
+		if duties == nil || duties.Assigned == 0 {
+			continue
+		}
+		stats.Validators = append(stats.Validators, ValidatorPercentile{
+			Validator:    validator,
+			Attestations: *duties,
+			Percentile:   percentile(duties.Rate()),
+		})
+		stats.Attestations.add(*duties)
+	}
+	if len(stats.Validators) == 0 {
+		return stats
+	}
+	sort.Slice(stats.Validators, func(i, j int) bool { return stats.Validators[i].Validator < stats.Validators[j].Validator })
+	stats.Percentile = percentile(stats.Attestations.Rate())
+	percentiles := make([]float64, len(stats.Validators))
+	for i, v := range stats.Validators {
+		percentiles[i] = v.Percentile
+	}
+	sort.Float64s(percentiles)
+	n := len(percentiles)
+	stats.Median = (percentiles[(n-1)/2] + percentiles[n/2]) / 2
+	return stats
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Preset parameters, which default to mainnet's and are set from the spec of
+// the nodes by setPreset, since other networks use other presets. Gnosis
+// Chain, for one, has 16 slots per epoch.
+var (
+	slotsPerEpoch phase0.Slot = 32
+
+	// maxCommitteesPerSlot is the most committees a slot can have, which
+	// committee indices of attestations and committees must be below.
+	maxCommitteesPerSlot = 64
+
+	// The inclusion distances within which attestation votes are timely.
+	// From Deneb, target votes are timely throughout the inclusion window.
+	timelySourceDistance phase0.Slot = 5 // integer_squareroot(SLOTS_PER_EPOCH)
+	timelyTargetDistance phase0.Slot = 32
+	timelyHeadDistance   phase0.Slot = 1
+
+	// maxAttestations is the most attestations a block can include.
+	maxAttestations = 128
+
+	// altairForkEpoch is the epoch Altair activates at, from which blocks
+	// carry sync aggregates and states participation flags.
+	altairForkEpoch phase0.Epoch = 0
+
+	// denebForkEpoch is the epoch Deneb activates at, which extends the
+	// inclusion window of attestations (EIP-7045). It's never by default.
+	denebForkEpoch phase0.Epoch = math.MaxUint64
+)
+
+// setPreset sets the preset parameters from a spec.
+func setPreset(spec map[string]string) error {
+	slots, err := strconv.ParseUint(spec["SLOTS_PER_EPOCH"], 10, 64)
+	if err != nil || slots == 0 {
+		return fmt.Errorf("invalid SLOTS_PER_EPOCH %q", spec["SLOTS_PER_EPOCH"])
+	}
+	committees, err := strconv.ParseUint(spec["MAX_COMMITTEES_PER_SLOT"], 10, 64)
+	if err != nil || committees == 0 {
+		return fmt.Errorf("invalid MAX_COMMITTEES_PER_SLOT %q", spec["MAX_COMMITTEES_PER_SLOT"])
+	}
+	attestations, err := strconv.ParseUint(spec["MAX_ATTESTATIONS"], 10, 32)
+	if err != nil || attestations == 0 {
+		return fmt.Errorf("invalid MAX_ATTESTATIONS %q", spec["MAX_ATTESTATIONS"])
+	}
+	// Fork epochs missing from the spec keep their defaults.
+	altair, deneb := uint64(0), uint64(math.MaxUint64)
+	for key, epoch := range map[string]*uint64{"ALTAIR_FORK_EPOCH": &altair, "DENEB_FORK_EPOCH": &deneb} {
+		if v, ok := spec[key]; ok {
+			if *epoch, err = strconv.ParseUint(v, 10, 64); err != nil {
+				return fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	slotsPerEpoch = phase0.Slot(slots)
+	timelySourceDistance = phase0.Slot(integerSquareRoot(uint64(slotsPerEpoch)))
+	timelyTargetDistance = slotsPerEpoch
+	maxCommitteesPerSlot = int(committees)
+	maxAttestations = int(attestations)
+	altairForkEpoch = phase0.Epoch(altair)
+	denebForkEpoch = phase0.Epoch(deneb)
+	return nil
+}
+
+// extendedInclusion reports whether attestations at a slot are included by
+// Deneb's rules, which allow any block of the attestation's own or next
+// epoch to include them, rather than only the next SLOTS_PER_EPOCH slots.
+// Attestations from the epoch before the fork are, since blocks after it
+// include them.
+func extendedInclusion(slot phase0.Slot) bool {
+	return phase0.Epoch(slot/slotsPerEpoch)+1 >= denebForkEpoch
+}
+
+// inclusionWindowEnd returns the last slot at which an attestation at a slot
+// can be included.
+func inclusionWindowEnd(slot phase0.Slot) phase0.Slot {
+	if extendedInclusion(slot) {
+		return (slot/slotsPerEpoch+2)*slotsPerEpoch - 1
+	}
+	return slot + slotsPerEpoch
+}
+
+// inclusionWindowStart returns the earliest slot whose attestations a block
+// at a slot can include.
+func inclusionWindowStart(slot phase0.Slot) phase0.Slot {
+	epoch := phase0.Epoch(slot / slotsPerEpoch)
+	switch {
+	case epoch == 0:
+		return 0
+	case epoch >= denebForkEpoch:
+		return phase0.Slot(epoch-1) * slotsPerEpoch
+	default:
+		return slot - slotsPerEpoch
+	}
+}
+
+// integerSquareRoot implements integer_squareroot from the consensus specs.
+func integerSquareRoot(n uint64) uint64 {
+	x, y := n, (n+1)/2
+	for y < x {
+		x, y = y, (y+n/y)/2
+	}
+	return x
+}
+
+// checkNetwork checks that all nodes are on the network, since the stats of
+// another network would be computed with its own preset without complaint.
+func checkNetwork(ctx context.Context, nodes []*nodeClient, network string) error {
+	for _, n := range nodes {
+		spec, err := n.Spec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch spec from %s: %w", redactAddress(n.address), err)
+		}
+		if spec["CONFIG_NAME"] != network {
+			return fmt.Errorf("%s is on %s, not %s", redactAddress(n.address), spec["CONFIG_NAME"], network)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+// probeCmd reports what each node can serve, so that feasible ranges can be
+// chosen before launching a long run.
+type probeCmd struct {
+	Node []string `required:"" help:"Comma-separated Beacon node addresses, each optionally named, such as lighthouse=http://localhost:5052,http://localhost:3500"`
+
+	HTTPProxy   string `help:"Proxy URL for requests to Beacon nodes (defaults to the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	TLSInsecure bool   `help:"Skip verification of Beacon node TLS certificates"`
+	CACert      string `type:"existingfile" help:"PEM bundle of additional CA certificates to trust for Beacon node TLS"`
+}
+
+// probedAPI is an API runs depend on, and an endpoint to probe it by.
+type probedAPI struct {
+	Name     string
+	Endpoint func(p nodeProbe) string
+}
+
+// probedAPIs are the APIs probed, named by what runs use them for. The
+// endpoints are chosen to be cheap even on mainnet.
+var probedAPIs = []probedAPI{
+	{"blocks", func(nodeProbe) string { return "/eth/v2/beacon/blocks/head" }},
+	{"committees", func(p nodeProbe) string {
+		return fmt.Sprintf("/eth/v1/beacon/states/head/committees?slot=%d&index=0", p.HeadSlot)
+	}},
+	{"proposer duties", func(p nodeProbe) string {
+		return fmt.Sprintf("/eth/v1/validator/duties/proposer/%d", p.HeadSlot/slotsPerEpoch)
+	}},
+	{"sync committees", func(nodeProbe) string { return "/eth/v1/beacon/states/head/sync_committees" }},
+	{"validators", func(nodeProbe) string { return "/eth/v1/beacon/states/head/validators?id=0" }},
+	{"identity", func(nodeProbe) string { return "/eth/v1/node/identity" }},
+	// States midway through the node's history, as --verify-state and
+	// --cohorts need for past epochs, are only kept by archive nodes.
+	{"historical states", func(p nodeProbe) string {
+		return fmt.Sprintf("/eth/v1/beacon/states/%d/finality_checkpoints", p.HistoryStart+(p.HeadSlot-p.HistoryStart)/2)
+	}},
+}
+
+// nodeProbe is what a node was found to serve.
+type nodeProbe struct {
+	Name           string
+	Version        string
+	Network        string
+	HeadSlot       phase0.Slot
+	FinalizedEpoch phase0.Epoch
+	HistoryStart   phase0.Slot // First slot from which the node serves every block up to the head.
+	Supported      []string
+	Unsupported    []string
+	Err            error // Set if the node couldn't be probed.
+}
+
+// HistoryEpoch returns the first epoch whose blocks the node all serves.
+func (p nodeProbe) HistoryEpoch() phase0.Epoch {
+	return phase0.Epoch((p.HistoryStart + slotsPerEpoch - 1) / slotsPerEpoch)
+}
+
+func (cmd *probeCmd) Run() error {
+	ctx := context.Background()
+	transport, err := newTransport(transportConfig{
+		Proxy:        cmd.HTTPProxy,
+		MaxIdleConns: 64,
+		IdleTimeout:  time.Minute,
+		TLSInsecure:  cmd.TLSInsecure,
+		CACert:       cmd.CACert,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	nodes, err := newNodeClients(cmd.Node, transport)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The preset is taken from the first node, and nodes on other
+	// networks aren't probed further.
+	spec, err := nodes[0].Spec(ctx)
+	if err != nil {
+		log.Fatalf("Failed to fetch spec from %s: %s", nodes[0].Name(), err)
+	}
+	if err := setPreset(spec); err != nil {
+		log.Fatal(err)
+	}
+
+	probes := make([]nodeProbe, len(nodes))
+	var g multierror.Group
+	for i, node := range nodes {
+		i, node := i, node
+		g.Go(func() error {
+			probes[i] = probeNode(ctx, node, spec["CONFIG_NAME"])
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	tbl := table.New(os.Stdout)
+	tbl.AddHeaders("Node", "Version", "Head Slot", "Finalized Epoch", "Blocks From", "Supported APIs", "Unsupported APIs")
+	from, to := phase0.Epoch(0), phase0.Epoch(0)
+	found := false
+	for _, p := range probes {
+		if p.Err != nil {
+			log.Printf("Failed to probe %s: %s", p.Name, p.Err)
+			continue
+		}
+		tbl.AddRow(
+			p.Name,
+			p.Version,
+			fmt.Sprint(p.HeadSlot),
+			fmt.Sprint(p.FinalizedEpoch),
+			fmt.Sprintf("slot %d (epoch %d)", p.HistoryStart, p.HistoryEpoch()),
+			strings.Join(p.Supported, ", "),
+			strings.Join(p.Unsupported, ", "),
+		)
+		if !found || p.HistoryEpoch() < from {
+			from = p.HistoryEpoch()
+		}
+		if !found || p.FinalizedEpoch > to {
+			to = p.FinalizedEpoch
+		}
+		found = true
+	}
+	tbl.Render()
+	if found && from <= to {
+		fmt.Printf("Finalized epochs %d—%d of %s can be run over with these nodes\n", from, to, spec["CONFIG_NAME"])
+	}
+	return nil
+}
+
+// probeNode finds what a node serves. Failures are recorded in the probe.
+func probeNode(ctx context.Context, node *nodeClient, network string) nodeProbe {
+	p := nodeProbe{Name: node.Name()}
+	var err error
+	if p.Version, err = node.NodeVersion(ctx); err != nil {
+		p.Err = fmt.Errorf("failed to connect: %w", err)
+		return p
+	}
+	spec, err := node.Spec(ctx)
+	if err != nil {
+		p.Err = fmt.Errorf("failed to fetch spec: %w", err)
+		return p
+	}
+	p.Network = spec["CONFIG_NAME"]
+	if p.Network != network {
+		p.Err = fmt.Errorf("it's on %s, not %s", p.Network, network)
+		return p
+	}
+	if p.HeadSlot, err = node.HeadSlot(ctx); err != nil {
+		p.Err = fmt.Errorf("failed to fetch head: %w", err)
+		return p
+	}
+	finality, err := node.Finality(ctx, "head")
+	if err != nil {
+		p.Err = fmt.Errorf("failed to fetch finality: %w", err)
+		return p
+	}
+	p.FinalizedEpoch = finality.Finalized.Epoch
+	if p.HistoryStart, err = historyStart(ctx, node, 0, p.HeadSlot); err != nil {
+		p.Err = fmt.Errorf("failed to check history: %w", err)
+		return p
+	}
+	for _, api := range probedAPIs {
+		if data, err := node.get(ctx, api.Endpoint(p)); err == nil && data != nil {
+			p.Supported = append(p.Supported, api.Name)
+		} else {
+			p.Unsupported = append(p.Unsupported, api.Name)
+		}
+	}
+	return p
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressPhase is a phase of a run, shown on its own line of the progress
+// display.
+type progressPhase int
+
+const (
+	phaseFetch      progressPhase = iota // Blocks, within the range and the lookahead.
+	phaseCommittees                      // Proposer duties and committees, by epoch.
+	phaseDedupe                          // Discarding orphans from the fetched blocks.
+	phaseCompute                         // Attestation stats, by slot.
+	phaseRender                          // Report and artifacts.
+
+	numProgressPhases
+)
+
+var phaseNames = [numProgressPhases]string{
+	phaseFetch:      "fetch",
+	phaseCommittees: "committees",
+	phaseDedupe:     "dedupe",
+	phaseCompute:    "compute",
+	phaseRender:     "render",
+}
+
+// progressRefresh is how often the progress display is redrawn on a terminal.
+const progressRefresh = 250 * time.Millisecond
+
+// runProgress displays the progress of each phase of a run, redrawing a line
+// per phase on a terminal, or printing a line as each phase finishes
+// otherwise. Block fetching also shows the requests in flight and queued
+// across the nodes, since that's where a run spends its time waiting.
+//
+// While it's open, log output goes through it, so that log lines are
+// printed above the display rather than drawn over.
+type runProgress struct {
+	out      io.Writer
+	terminal bool
+	sched    *scheduler
+	events   *eventStream
+
+	mu     sync.Mutex
+	phases [numProgressPhases]phaseProgress
+	lines  int // Lines drawn last, to redraw over.
+
+	inRange          int
+	lookahead        int
+	fetchedInRange   int
+	emptyInRange     int
+	fetchedLookahead int
+
+	stop  chan struct{}
+	done  chan struct{}
+	close sync.Once
+}
+
+// phaseProgress counts the units of work done in a phase, out of total if
+// it's known.
+type phaseProgress struct {
+	total, done int
+	unit        string
+	detail      string
+	started     time.Time
+	finished    time.Time
+}
+
+func newRunProgress() *runProgress {
+	p := &runProgress{
+		out:      os.Stderr,
+		terminal: term.IsTerminal(int(os.Stderr.Fd())),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	log.SetOutput(p)
+	go p.refresh()
+	return p
+}
+
+// Write writes log output above the display.
+func (p *runProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.terminal && p.lines > 0 {
+		fmt.Fprintf(p.out, "\033[%dA\r\033[J", p.lines)
+		p.lines = 0
+	}
+	return p.out.Write(b)
+}
+
+func (p *runProgress) refresh() {
+	defer close(p.done)
+	var redraw <-chan time.Time
+	if p.terminal {
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		redraw = ticker.C
+	}
+	emit := time.NewTicker(progressEventInterval)
+	defer emit.Stop()
+	for {
+		select {
+		case <-redraw:
+			p.mu.Lock()
+			p.draw()
+			p.mu.Unlock()
+		case <-emit.C:
+			var running []ProgressEvent
+			p.mu.Lock()
+			events := p.events
+			for phase := progressPhase(0); phase < numProgressPhases; phase++ {
+				if ph := p.phases[phase]; !ph.started.IsZero() && ph.finished.IsZero() {
+					running = append(running, p.progressEvent(phase))
+				}
+			}
+			p.mu.Unlock()
+			for _, e := range running {
+				events.Progress(e)
+			}
+		case <-p.stop:
+			if p.terminal {
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			}
+			return
+		}
+	}
+}
+
+// SetEvents sets the stream that the progress of each phase is emitted to,
+// as it starts and finishes and in between.
+func (p *runProgress) SetEvents(events *eventStream) {
+	p.mu.Lock()
+	p.events = events
+	p.mu.Unlock()
+}
+
+// progressEvent describes the progress of a phase. p.mu must be held, and
+// the event emitted after releasing it, since the stream logs its errors.
+func (p *runProgress) progressEvent(phase progressPhase) ProgressEvent {
+	ph := p.phases[phase]
+	return ProgressEvent{
+		Phase:    phaseNames[phase],
+		Done:     ph.done,
+		Total:    ph.total,
+		Unit:     ph.unit,
+		Finished: !ph.finished.IsZero(),
+	}
+}
+
+// StartFetch starts the fetch phase, whose queue is observed on sched.
+func (p *runProgress) StartFetch(sched *scheduler, inRange, lookahead int) {
+	p.mu.Lock()
+	p.sched = sched
+	p.inRange, p.lookahead = inRange, lookahead
+	p.mu.Unlock()
+	p.Start(phaseFetch, inRange+lookahead, "slots")
+}
+
+// FetchDone records a fetched slot.
+func (p *runProgress) FetchDone(inRange, empty bool) {
+	p.mu.Lock()
+	if inRange {
+		p.fetchedInRange++
+		if empty {
+			p.emptyInRange++
+		}
+	} else {
+		p.fetchedLookahead++
+	}
+	p.mu.Unlock()
+	p.Add(phaseFetch, 1)
+}
+
+// Start starts a phase of total units, or an unknown number if total is 0.
+func (p *runProgress) Start(phase progressPhase, total int, unit string) {
+	p.mu.Lock()
+	p.phases[phase] = phaseProgress{total: total, unit: unit, started: time.Now()}
+	e, events := p.progressEvent(phase), p.events
+	p.mu.Unlock()
+	events.Progress(e)
+}
+
+// Add records n units of a phase as done.
+func (p *runProgress) Add(phase progressPhase, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phases[phase].done += n
+}
+
+// Finish marks a phase as done, with an optional detail to show for it.
+func (p *runProgress) Finish(phase progressPhase, detail string) {
+	p.mu.Lock()
+	ph := &p.phases[phase]
+	if ph.started.IsZero() {
+		ph.started = time.Now()
+	}
+	ph.finished = time.Now()
+	ph.detail = detail
+	if !p.terminal {
+		fmt.Fprintln(p.out, p.line(phase))
+	}
+	e, events := p.progressEvent(phase), p.events
+	p.mu.Unlock()
+	events.Progress(e)
+}
+
+// Close stops redrawing, leaving the final state of every phase shown, and
+// restores log output. Closing it again does nothing.
+func (p *runProgress) Close() {
+	p.close.Do(func() {
+		close(p.stop)
+		<-p.done
+		log.SetOutput(os.Stderr)
+	})
+}
+
+// Fraction returns the fraction of slots fetched so far.
+func (p *runProgress) Fraction() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fetch := p.phases[phaseFetch]
+	if fetch.total == 0 {
+		return 1
+	}
+	return float64(fetch.done) / float64(fetch.total)
+}
+
+// draw redraws every phase over the previous drawing.
+func (p *runProgress) draw() {
+	var b strings.Builder
+	if p.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.lines)
+	}
+	for phase := progressPhase(0); phase < numProgressPhases; phase++ {
+		fmt.Fprintf(&b, "\r\033[K%s\n", p.line(phase))
+	}
+	p.lines = int(numProgressPhases)
+	io.WriteString(p.out, b.String())
+}
+
+// line describes a phase, such as "fetch  1200/5000 slots  in flight 16, queued 3784".
+func (p *runProgress) line(phase progressPhase) string {
+	ph := p.phases[phase]
+	name := fmt.Sprintf("%-10s", phaseNames[phase])
+	if ph.started.IsZero() {
+		return name + "  -"
+	}
+	count := fmt.Sprint(ph.done)
+	if ph.total > 0 {
+		count = fmt.Sprintf("%d/%d", ph.done, ph.total)
+	}
+	s := fmt.Sprintf("%s  %s %s", name, count, ph.unit)
+	if phase == phaseFetch {
+		s += fmt.Sprintf(" (range %d/%d, %d empty, lookahead %d/%d)",
+			p.fetchedInRange, p.inRange, p.emptyInRange, p.fetchedLookahead, p.lookahead)
+	}
+	if ph.detail != "" {
+		s += ", " + ph.detail
+	}
+	if !ph.finished.IsZero() {
+		return s + fmt.Sprintf("  done in %s", ph.finished.Sub(ph.started).Round(time.Millisecond))
+	}
+	elapsed := time.Since(ph.started)
+	s += fmt.Sprintf("  %s", elapsed.Round(time.Second))
+	if phase == phaseFetch && p.sched != nil {
+		inflight, queued := p.sched.Load()
+		s += fmt.Sprintf("  in flight %d, queued %d", inflight, queued)
+	}
+	return s
+}
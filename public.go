@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// publicNodes lists free public Beacon API endpoints by network, for trying
+// the tool without running a node. Checkpoint sync endpoints aren't listed,
+// since most of them only serve finalized states and not blocks.
+var publicNodes = map[string][]string{
+	"mainnet": {
+		"https://ethereum-beacon-api.publicnode.com",
+		"https://lodestar-mainnet.chainsafe.io",
+	},
+	"holesky": {
+		"https://ethereum-holesky-beacon-api.publicnode.com",
+	},
+	"sepolia": {
+		"https://ethereum-sepolia-beacon-api.publicnode.com",
+	},
+}
+
+// checkPublicNodes drops public nodes that are unreachable or on another
+// network, failing only if none are left.
+func checkPublicNodes(ctx context.Context, nodes []*nodeClient, network string) ([]*nodeClient, error) {
+	var usable []*nodeClient
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		spec, err := n.Spec(ctx)
+		if err != nil {
+			log.Printf("Skipping public node %s: %s", redactAddress(n.address), err)
+			continue
+		}
+		if spec["CONFIG_NAME"] != network {
+			log.Printf("Skipping public node %s, which is on %s", redactAddress(n.address), spec["CONFIG_NAME"])
+			continue
+		}
+		usable = append(usable, n)
+	}
+	if len(usable) == 0 {
+		return nil, fmt.Errorf("no public %s Beacon nodes are reachable", network)
+	}
+	return usable, nil
+}
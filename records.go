@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// recordWriter writes flat records to a file for external analysis.
+//
+// Records are structs whose fields carry parquet tags; the same tags name
+// the CSV columns.
+type recordWriter interface {
+	Write(record interface{}) error
+	Close() error
+}
+
+// newRecordWriter creates a CSV or Parquet writer for records shaped like
+// record, depending on the extension of path.
+func newRecordWriter(path string, record interface{}) (recordWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".parquet":
+		pw, err := writer.NewParquetWriterFromWriter(f, reflect.New(reflect.TypeOf(record)).Interface(), 4)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &parquetRecordWriter{f, pw}, nil
+	case ".csv":
+		w := &csvRecordWriter{f: f, w: csv.NewWriter(f)}
+		return w, w.w.Write(recordColumns(reflect.TypeOf(record)))
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unsupported file extension %q (expected .csv or .parquet)", filepath.Ext(path))
+	}
+}
+
+type parquetRecordWriter struct {
+	f  *os.File
+	pw *writer.ParquetWriter
+}
+
+func (w *parquetRecordWriter) Write(record interface{}) error {
+	return w.pw.Write(record)
+}
+
+func (w *parquetRecordWriter) Close() error {
+	if err := w.pw.WriteStop(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+type csvRecordWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func (w *csvRecordWriter) Write(record interface{}) error {
+	v := reflect.ValueOf(record)
+	row := make([]string, v.NumField())
+	for i := range row {
+		row[i] = fmt.Sprint(v.Field(i).Interface())
+	}
+	return w.w.Write(row)
+}
+
+func (w *csvRecordWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// recordColumns returns the column names from the parquet tags of a record type.
+func recordColumns(t reflect.Type) []string {
+	columns := make([]string, t.NumField())
+	for i := range columns {
+		columns[i] = t.Field(i).Name
+		for _, opt := range strings.Split(t.Field(i).Tag.Get("parquet"), ",") {
+			if opt = strings.TrimSpace(opt); strings.HasPrefix(opt, "name=") {
+				columns[i] = strings.TrimPrefix(opt, "name=")
+			}
+		}
+	}
+	return columns
+}
+
+// rawAttestation is a single attestation duty and its inclusion.
+type rawAttestation struct {
+	Slot               int64  `parquet:"name=slot, type=INT64, convertedtype=UINT_64"`
+	Committee          int32  `parquet:"name=committee, type=INT32, convertedtype=UINT_32"`
+	Position           int32  `parquet:"name=position, type=INT32, convertedtype=UINT_32"`
+	Included           bool   `parquet:"name=included, type=BOOLEAN"`
+	InclusionSlot      int64  `parquet:"name=inclusion_slot, type=INT64, convertedtype=UINT_64"`
+	InclusionBlockRoot string `parquet:"name=inclusion_block_root, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// rawBlock is a canonical block.
+type rawBlock struct {
+	Slot              int64  `parquet:"name=slot, type=INT64, convertedtype=UINT_64"`
+	BlockRoot         string `parquet:"name=block_root, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProposerIndex     int64  `parquet:"name=proposer_index, type=INT64, convertedtype=UINT_64"`
+	Graffiti          string `parquet:"name=graffiti, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Attestations      int32  `parquet:"name=attestations, type=INT32, convertedtype=UINT_32"`
+	SyncParticipation int32  `parquet:"name=sync_participation, type=INT32, convertedtype=UINT_32"`
+	LeftBehind        int32  `parquet:"name=left_behind, type=INT32, convertedtype=UINT_32"`
+	LatePickups       int32  `parquet:"name=late_pickups, type=INT32, convertedtype=UINT_32"`
+}
+
+// writeRawBlocks writes a record for every block within the filter. Graffiti
+// that isn't printable is left empty, sync participation counts the sync
+// committee members whose signatures the block aggregated, and left behind
+// counts the duties it could have included but a later block did, taken
+// from leftBehind by slot from fromSlot, and late pickups count the duties it
+// included after earlier blocks left them behind, taken from pickups.
+func writeRawBlocks(path string, blocks []blockWithRoot, fromSlot phase0.Slot, leftBehind []int, pickups []blockPickups, filter func(slot phase0.Slot) bool) error {
+	w, err := newRecordWriter(path, rawBlock{})
+	if err != nil {
+		return err
+	}
+	for _, bl := range blocks {
+		if !filter(bl.Message.Slot) {
+			continue
+		}
+		record := rawBlock{
+			Slot:          int64(bl.Message.Slot),
+			BlockRoot:     bl.Root.String(),
+			ProposerIndex: int64(bl.Message.ProposerIndex),
+			Graffiti:      printableText(bl.Message.Body.Graffiti[:]),
+			Attestations:  int32(len(bl.Message.Body.Attestations)),
+			LeftBehind:    int32(leftBehind[bl.Message.Slot-fromSlot]),
+			LatePickups:   int32(pickups[bl.Message.Slot-fromSlot].Late),
+		}
+		if aggregate := bl.Message.Body.SyncAggregate; aggregate != nil {
+			record.SyncParticipation = int32(aggregate.SyncCommitteeBits.Count())
+		}
+		if err := w.Write(record); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// writeRawAttestations writes a record for every attestation duty that
+// passes the filter. Duties that were never included have a zero inclusion
+// slot and an empty inclusion block root.
+func writeRawAttestations(
+	path string,
+	fromSlot phase0.Slot,
+	slotCommitteeParticipations [][]CommitteeParticipation,
+	blockRoot func(phase0.Slot) phase0.Root,
+	filter func(slot phase0.Slot, committee, position int) bool,
+) error {
+	w, err := newRecordWriter(path, rawAttestation{})
+	if err != nil {
+		return err
+	}
+	for i, committees := range slotCommitteeParticipations {
+		slot := fromSlot + phase0.Slot(i)
+		for index, participations := range committees {
+			for position, p := range participations {
+				if !filter(slot, index, position) {
+					continue
+				}
+				record := rawAttestation{
+					Slot:      int64(slot),
+					Committee: int32(index),
+					Position:  int32(position),
+					Included:  p.Included,
+				}
+				if p.Included {
+					record.InclusionSlot = int64(p.InclusionSlot)
+					record.InclusionBlockRoot = blockRoot(p.InclusionSlot).String()
+				}
+				if err := w.Write(record); err != nil {
+					w.Close()
+					return err
+				}
+			}
+		}
+	}
+	return w.Close()
+}
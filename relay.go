@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// relayPageSize is the number of payloads requested from a relay's data API
+// at once, which is the most relays commonly allow.
+const relayPageSize = 200
+
+// relayClient reads the payloads a MEV-Boost relay delivered from its data
+// API, which is the only place the builder of a relay-built block is known.
+type relayClient struct {
+	address string
+	client  *http.Client
+}
+
+func newRelayClient(address string, transport http.RoundTripper) *relayClient {
+	if !strings.HasPrefix(address, "http") {
+		address = "https://" + address
+	}
+	return &relayClient{
+		address: strings.TrimSuffix(address, "/"),
+		client:  &http.Client{Timeout: nodeTimeout, Transport: transport},
+	}
+}
+
+// deliveredPayload is a payload a relay delivered to a proposer.
+type deliveredPayload struct {
+	Slot          phase0.Slot `json:"slot,string"`
+	BlockHash     string      `json:"block_hash"`
+	BuilderPubkey string      `json:"builder_pubkey"`
+}
+
+// DeliveredPayloads fetches the payloads the relay delivered for the slots
+// from one slot to another, paging back from the last one.
+func (r *relayClient) DeliveredPayloads(ctx context.Context, from, to phase0.Slot) ([]deliveredPayload, error) {
+	var payloads []deliveredPayload
+	cursor := to
+	for {
+		page, err := r.page(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page {
+			if p.Slot >= from && p.Slot <= to {
+				payloads = append(payloads, p)
+			}
+		}
+		// Relays may cap pages below the requested size, so only an empty
+		// page or one reaching back to the first slot ends the paging.
+		if len(page) == 0 || page[len(page)-1].Slot <= from {
+			return payloads, nil
+		}
+		cursor = page[len(page)-1].Slot - 1
+	}
+}
+
+// page fetches the payloads delivered up to the cursor slot, latest first.
+func (r *relayClient) page(ctx context.Context, cursor phase0.Slot) ([]deliveredPayload, error) {
+	u, err := url.Parse(r.address + "/relay/v1/data/bidtraces/proposer_payload_delivered")
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"cursor": {fmt.Sprint(cursor)},
+		"limit":  {fmt.Sprint(relayPageSize)},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{u.Path, resp.StatusCode, data}
+	}
+	var page []deliveredPayload
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse payloads from %s: %w", redactAddress(r.address), err)
+	}
+	sort.Slice(page, func(i, j int) bool { return page[i].Slot > page[j].Slot })
+	return page, nil
+}
+
+// BuilderStats counts the canonical blocks a builder built, as delivered by
+// the relays the run was given.
+type BuilderStats struct {
+	Pubkey string `json:"pubkey"`
+	Name   string `json:"name"` // Extra data of the builder's latest payload, which builders sign with.
+	Blocks int    `json:"blocks"`
+}
+
+// builderStats tallies relay-delivered payloads by builder.
+type builderStats map[string]*BuilderStats
+
+// Add counts a block by a builder.
+func (b builderStats) Add(pubkey string, execution executionSummary) {
+	stats := b[pubkey]
+	if stats == nil {
+		stats = &BuilderStats{Pubkey: pubkey}
+		b[pubkey] = stats
+	}
+	stats.Blocks++
+	if execution.ExtraData != "" {
+		stats.Name = execution.ExtraData
+	}
+}
+
+// List returns the builders, most blocks first.
+func (b builderStats) List() []BuilderStats {
+	list := make([]BuilderStats, 0, len(b))
+	for _, stats := range b {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Blocks != list[j].Blocks {
+			return list[i].Blocks > list[j].Blocks
+		}
+		return list[i].Pubkey < list[j].Pubkey
+	})
+	return list
+}
+
+// printableText returns bytes, such as the extra data of a payload or the
+// graffiti of a block, as text if it's printable, as builders and proposers
+// mostly use them for their name.
+func printableText(b []byte) string {
+	s := strings.TrimRight(string(b), "\x00")
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return ""
+		}
+	}
+	return s
+}
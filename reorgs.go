@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Reorg is a block within the range that was orphaned, and the canonical
+// block that won in its place.
+//
+// Votes count the attesters that named each block as their head, so they show
+// how much of the network saw the orphan before it was reorged out.
+type Reorg struct {
+	Slot          phase0.Slot           `json:"slot"`
+	Root          string                `json:"root"`
+	ProposerIndex phase0.ValidatorIndex `json:"proposer_index"`
+	Votes         int                   `json:"votes"`
+
+	CanonicalSlot          phase0.Slot           `json:"canonical_slot"`
+	CanonicalRoot          string                `json:"canonical_root"`
+	CanonicalProposerIndex phase0.ValidatorIndex `json:"canonical_proposer_index"`
+	CanonicalVotes         int                   `json:"canonical_votes"`
+}
+
+// findReorgs detects orphaned blocks from attestations whose head vote isn't
+// a canonical block. Orphans never show up when fetching blocks by slot, so
+// they're fetched by root, which works as long as the node hasn't pruned them.
+//
+// Only slots for which inRange returns true are considered, and all of
+// their blocks must be in the chain. The orphans found are returned too,
+// though orphans no attestation voted for are missed.
+func findReorgs(ctx context.Context, sched *scheduler, chain *chainIndex, inRange func(phase0.Slot) bool) ([]Reorg, []blockWithRoot, error) {
+	candidates := map[phase0.Root]bool{}
+	for _, bl := range chain.Blocks() {
+		for _, att := range bl.Message.Body.Attestations {
+			if inRange(att.Data.Slot) && !chain.IsCanonical(att.Data.BeaconBlockRoot) {
+				candidates[att.Data.BeaconBlockRoot] = true
+			}
+		}
+	}
+
+	reorgs := []Reorg{}
+	var orphans []blockWithRoot
+	var sides [][2]phase0.Root // Orphaned and canonical roots of each reorg.
+	for root := range candidates {
+		var data []byte
+		err := sched.Do(categoryBlocks, func(node *nodeClient) error {
+			var err error
+			data, err = node.SignedBeaconBlockData(ctx, root.String())
+			return err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch block %s: %w", root, err)
+		}
+		if data == nil {
+			log.Printf("Block %s received votes but isn't canonical, and the node doesn't have it", root)
+			continue
+		}
+		bl, err := decodeBlock(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode block %s: %w", root, err)
+		}
+		orphan := bl.Message
+		if !inRange(orphan.Slot) {
+			// Votes for a canonical block outside the range.
+			continue
+		}
+		reorg := Reorg{Slot: orphan.Slot, Root: root.String(), ProposerIndex: orphan.ProposerIndex}
+		// The canonical block that won is the first one from the orphan's slot on.
+		var canonicalRoot phase0.Root
+		if bl, ok := chain.Next(orphan.Slot - 1); ok {
+			canonicalRoot = bl.Root
+			reorg.CanonicalSlot = bl.Message.Slot
+			reorg.CanonicalRoot = bl.Root.String()
+			reorg.CanonicalProposerIndex = bl.Message.ProposerIndex
+		}
+		reorgs = append(reorgs, reorg)
+		orphans = append(orphans, bl)
+		sides = append(sides, [2]phase0.Root{root, canonicalRoot})
+	}
+
+	// Count distinct head votes for both sides of each reorg.
+	type vote struct {
+		slot      phase0.Slot
+		committee phase0.CommitteeIndex
+		position  int
+	}
+	votes := map[phase0.Root]map[vote]bool{}
+	for _, side := range sides {
+		votes[side[0]] = map[vote]bool{}
+		votes[side[1]] = map[vote]bool{}
+	}
+	for _, bl := range chain.Blocks() {
+		for _, att := range bl.Message.Body.Attestations {
+			voters, ok := votes[att.Data.BeaconBlockRoot]
+			if !ok {
+				continue
+			}
+			for _, i := range att.AggregationBits.BitIndices() {
+				voters[vote{att.Data.Slot, att.Data.Index, i}] = true
+			}
+		}
+	}
+	for i, side := range sides {
+		reorgs[i].Votes = len(votes[side[0]])
+		reorgs[i].CanonicalVotes = len(votes[side[1]])
+	}
+	sort.Slice(reorgs, func(i, j int) bool { return reorgs[i].Slot < reorgs[j].Slot })
+	return reorgs, orphans, nil
+}
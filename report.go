@@ -0,0 +1,1116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aquasecurity/table"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Report holds the computed stats of a run. It's the data passed to
+// user-supplied templates and written as JSON, so exported fields and
+// methods are part of both interfaces.
+type Report struct {
+	SchemaVersion int         `json:"schema_version"`
+	Metadata      RunMetadata `json:"metadata"`
+
+	Slots        []AttestationStats `json:"slots"` // By slot index within the epoch.
+	Epochs       []EpochStats       `json:"epochs"`
+	Timings      Timings            `json:"timings"`
+	Nodes        []NodeStats        `json:"nodes"`
+	Scope        Scope              `json:"scope"`
+	Attestations AttestationStats   `json:"attestations"`
+	HealthScore  *float64           `json:"health_score,omitempty"` // Over the epochs of the range, if they have data.
+	Missed       MissedStats        `json:"missed"`
+	Clients      []ClientStats      `json:"clients"`
+	Transition   TransitionStats    `json:"transition"`
+	Forks        []ForkStats        `json:"forks,omitempty"` // Forks activated within the range.
+	HoursOfDay   []TimeBucketStats  `json:"hours_of_day,omitempty"`
+	DaysOfWeek   []TimeBucketStats  `json:"days_of_week,omitempty"`
+	Reorgs       []Reorg            `json:"reorgs"`
+	DoubleBlocks []DoubleBlock      `json:"double_blocks,omitempty"` // Slots with a canonical block and a sibling.
+	Entities     []GroupStats       `json:"entities,omitempty"`
+	Regions      []GroupStats       `json:"regions,omitempty"`
+	ASNs         []GroupStats       `json:"asns,omitempty"`
+	Cohorts      []GroupStats       `json:"cohorts,omitempty"`              // By validator age at the start of the range.
+	Withdrawals  []GroupStats       `json:"withdrawal_addresses,omitempty"` // By the address validators withdraw to.
+	Builders     []BuilderStats     `json:"builders,omitempty"`             // Of relay-delivered payloads, with relays given.
+
+	// UnattributedWithdrawals counts the validators left out of Withdrawals
+	// since their BLS withdrawal credentials don't name an address.
+	UnattributedWithdrawals int `json:"unattributed_withdrawals,omitempty"`
+
+	// SlashableVotes is only set when validators are watched.
+	SlashableVotes []SlashableVote `json:"slashable_votes,omitempty"`
+	// SyncCommittee is only set for sync validators, by epoch in which
+	// they had sync committee duties.
+	SyncCommittee []SyncStats `json:"sync_committee,omitempty"`
+	// SyncPeriods is only set for ranges that cross into another sync
+	// committee period.
+	SyncPeriods []SyncPeriodStats `json:"sync_periods,omitempty"`
+	StateChecks []StateCheck      `json:"state_checks,omitempty"`
+
+	// Percentiles is only set for ranked validators.
+	Percentiles *PercentileStats `json:"percentiles,omitempty"`
+	// Flakiness is only set for validators checked for periodic misses.
+	Flakiness *FlakinessStats `json:"flakiness,omitempty"`
+	// Baseline is only set for runs compared with a baseline.
+	Baseline *BaselineComparison `json:"baseline,omitempty"`
+
+	// Sample is only set for sampled runs, whose other stats cover the
+	// sampled epochs only.
+	Sample *SampleStats `json:"sample,omitempty"`
+
+	// Incomplete lists epochs left out of the stats because blocks within
+	// their inclusion window couldn't be fetched from any node.
+	Incomplete []IncompleteEpoch `json:"incomplete_epochs,omitempty"`
+}
+
+// IncompleteEpoch is an epoch left out of the stats, and the slots whose
+// blocks couldn't be fetched.
+type IncompleteEpoch struct {
+	Epoch       phase0.Epoch  `json:"epoch"`
+	FailedSlots []phase0.Slot `json:"failed_slots"`
+}
+
+// RunMetadata describes a run, so that shared outputs are self-describing.
+type RunMetadata struct {
+	Tool      ToolInfo  `json:"tool"`
+	Network   string    `json:"network"`
+	StartTime time.Time `json:"start_time"` // Wall-clock start of the first slot in the range.
+	EndTime   time.Time `json:"end_time"`   // Wall-clock end of the last slot in the range.
+	StartedAt time.Time `json:"started_at"` // When the run started.
+
+	// EffectivenessModels are the models effectiveness is shown under in
+	// tables. JSON outputs carry the sums behind every model.
+	EffectivenessModels []string `json:"effectiveness_models"`
+
+	// Relays are the MEV-Boost relays payloads were attributed to builders by.
+	Relays []string `json:"relays,omitempty"`
+
+	// HealthWeights are the weights of the metrics blended into health scores.
+	HealthWeights HealthWeights `json:"health_weights"`
+
+	// BlockExport is set if blocks were read from a local export. Only
+	// blocks are read locally, while duties and committees still come from
+	// the nodes.
+	BlockExport bool `json:"block_export,omitempty"`
+
+	// Labels describe the run's context, such as its deployment, for
+	// slicing results downstream. Metrics carry them too.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// AttestationStats aggregates attestation duties and their inclusions.
+type AttestationStats struct {
+	Assigned       int `json:"assigned"`
+	Executed       int `json:"executed"`
+	InclusionDelay int `json:"inclusion_delay"` // Sum of inclusion delays of executed attestations.
+
+	// Sums of the delays of executed attestations: raw delays are the slots
+	// from the attestation's own to its inclusion, while effective delays
+	// only count the slots with canonical blocks.
+	RawDelay       int `json:"raw_delay"`
+	EffectiveDelay int `json:"effective_delay"`
+
+	// Sums behind the other effectiveness models, over assigned attestations.
+	InclusionScore float64 `json:"inclusion_score"` // Earliest possible over actual inclusion distance.
+	RewardWeight   int     `json:"reward_weight"`   // Net reward weight of the votes.
+
+	// Pending counts attestations not included yet whose inclusion window
+	// extends past the head. They aren't counted as assigned.
+	Pending int `json:"pending"`
+}
+
+func (s *AttestationStats) add(o AttestationStats) {
+	s.Assigned += o.Assigned
+	s.Executed += o.Executed
+	s.InclusionDelay += o.InclusionDelay
+	s.RawDelay += o.RawDelay
+	s.EffectiveDelay += o.EffectiveDelay
+	s.InclusionScore += o.InclusionScore
+	s.RewardWeight += o.RewardWeight
+	s.Pending += o.Pending
+}
+
+// Rate returns the percentage of assigned attestations that were executed.
+func (s AttestationStats) Rate() float64 {
+	return float64(s.Executed) / float64(s.Assigned) * 100
+}
+
+// Effectiveness returns the reciprocal of the average inclusion delay, as a percentage.
+func (s AttestationStats) Effectiveness() float64 {
+	return 1 / (float64(s.InclusionDelay) / float64(s.Executed)) * 100
+}
+
+// AverageRawDelay returns the average raw delay of executed attestations.
+func (s AttestationStats) AverageRawDelay() float64 {
+	return float64(s.RawDelay) / float64(s.Executed)
+}
+
+// AverageEffectiveDelay returns the average effective delay of executed
+// attestations.
+func (s AttestationStats) AverageEffectiveDelay() float64 {
+	return float64(s.EffectiveDelay) / float64(s.Executed)
+}
+
+// MissedStats attributes attestations that were never included.
+type MissedStats struct {
+	// AttesterFault counts misses where a canonical block existed at
+	// delay 1, so the attestation could have been included on time.
+	AttesterFault int `json:"attester_fault"`
+
+	// ProposerFault counts misses where the next slot had no canonical
+	// block, so the proposer or the network denied the earliest inclusion.
+	ProposerFault int `json:"proposer_fault"`
+}
+
+// Total returns the number of missed attestations.
+func (m MissedStats) Total() int {
+	return m.AttesterFault + m.ProposerFault
+}
+
+// ClientStats holds how attestations were packed by blocks of a consensus
+// client, as guessed from their graffiti.
+type ClientStats struct {
+	Client string `json:"client"`
+	Blocks int    `json:"blocks"` // Canonical blocks within the range.
+
+	// Attestations counts included attestations whose earliest inclusion
+	// opportunity was a block of this client, and IncludedAtDelay1 how
+	// many of them that block actually included.
+	Attestations     int `json:"attestations"`
+	IncludedAtDelay1 int `json:"included_at_delay_1"`
+}
+
+// Delay1Rate returns the percentage of attestations included at the earliest opportunity.
+func (c ClientStats) Delay1Rate() float64 {
+	return float64(c.IncludedAtDelay1) / float64(c.Attestations) * 100
+}
+
+// EpochStats holds the attestations of a single epoch and its proposals,
+// cross-checked against its proposer duties.
+type EpochStats struct {
+	Epoch        phase0.Epoch     `json:"epoch"`
+	Attestations AttestationStats `json:"attestations"`
+	Duties       int              `json:"duties"`
+	Blocks       int              `json:"blocks"`
+	SkippedSlots []SkippedSlot    `json:"skipped_slots"`
+	Execution    ExecutionStats   `json:"execution"`
+	Committees   CommitteeStats   `json:"committees"`
+	Fork         string           `json:"fork,omitempty"` // Fork activated at the epoch, if any.
+
+	// SyncAggregates counts the participation in the sync aggregates of
+	// the epoch's proposed blocks.
+	SyncAggregates SyncAggregateStats `json:"sync_aggregates"`
+	// Packing measures how fully the epoch's proposed blocks were packed
+	// with attestations.
+	Packing PackingStats `json:"packing"`
+	// Duplicates counts aggregates of the epoch's attestations included
+	// again with votes already included.
+	Duplicates DuplicateStats `json:"duplicates"`
+	// ReorgAffected holds the duties left out of Attestations because a
+	// reorged block fell within their inclusion window, if such duties are
+	// excluded.
+	ReorgAffected AttestationStats `json:"reorg_affected"`
+	// OrphanedOnly counts missed duties whose votes only orphaned blocks
+	// included, which reorgs cost rather than absent attesters.
+	OrphanedOnly int `json:"orphaned_only"`
+	// HealthScore blends the epoch's metrics by the run's health weights.
+	// It's left out if the epoch has no data.
+	HealthScore *float64 `json:"health_score,omitempty"`
+}
+
+// ProposalRate returns the percentage of proposer duties with a canonical block.
+func (e EpochStats) ProposalRate() float64 {
+	return float64(e.Blocks) / float64(e.Duties) * 100
+}
+
+// Label returns the epoch number, along with the fork activated at it.
+func (e EpochStats) Label() string {
+	if e.Fork != "" {
+		return fmt.Sprintf("%d (%s)", e.Epoch, e.Fork)
+	}
+	return fmt.Sprint(e.Epoch)
+}
+
+// CommitteeStats describes the sizes of an epoch's committees, which change
+// with the size of the validator set. Sizes are read off the aggregation
+// bits of included attestations, so committees that had none aren't seen.
+type CommitteeStats struct {
+	Committees int `json:"committees"`
+	PerSlot    int `json:"per_slot"` // Most committees seen in a slot of the epoch.
+	MinSize    int `json:"min_size"`
+	MaxSize    int `json:"max_size"`
+	Validators int `json:"validators"` // Sum of committee sizes.
+}
+
+func (s *CommitteeStats) add(size int) {
+	if s.Committees == 0 || size < s.MinSize {
+		s.MinSize = size
+	}
+	if size > s.MaxSize {
+		s.MaxSize = size
+	}
+	s.Committees++
+	s.Validators += size
+}
+
+// AverageSize returns the average committee size.
+func (s CommitteeStats) AverageSize() float64 {
+	return float64(s.Validators) / float64(s.Committees)
+}
+
+// epochResult is the contribution of a single epoch to a report. Reports
+// are assembled from epoch results, which is what allows caching them.
+type epochResult struct {
+	Epoch   EpochStats         `json:"epoch"`
+	Slots   []AttestationStats `json:"slots"`
+	Missed  MissedStats        `json:"missed"`
+	Clients []ClientStats      `json:"clients"`
+	Blocks  int                `json:"blocks"` // Canonical blocks within the epoch.
+	Reorgs  []Reorg            `json:"reorgs"`
+}
+
+// addEpoch adds an epoch's result to the report. Epochs must be added in order.
+func (r *Report) addEpoch(e epochResult) {
+	r.Epochs = append(r.Epochs, e.Epoch)
+	r.Attestations.add(e.Epoch.Attestations)
+	for i := range e.Slots {
+		r.Slots[i].add(e.Slots[i])
+	}
+	r.Missed.AttesterFault += e.Missed.AttesterFault
+	r.Missed.ProposerFault += e.Missed.ProposerFault
+	r.Scope.Blocks += e.Blocks
+	r.Reorgs = append(r.Reorgs, e.Reorgs...)
+	r.addClients(e.Clients)
+}
+
+// addClients adds the stats of clients to the report's, keeping them sorted.
+func (r *Report) addClients(clients []ClientStats) {
+	for _, c := range clients {
+		i := sort.Search(len(r.Clients), func(i int) bool { return r.Clients[i].Client >= c.Client })
+		if i == len(r.Clients) || r.Clients[i].Client != c.Client {
+			r.Clients = append(r.Clients[:i], append([]ClientStats{{Client: c.Client}}, r.Clients[i:]...)...)
+		}
+		r.Clients[i].Blocks += c.Blocks
+		r.Clients[i].Attestations += c.Attestations
+		r.Clients[i].IncludedAtDelay1 += c.IncludedAtDelay1
+	}
+}
+
+// SkippedSlot is a proposer duty without a canonical block.
+type SkippedSlot struct {
+	Slot          phase0.Slot           `json:"slot"`
+	ProposerIndex phase0.ValidatorIndex `json:"proposer_index"`
+}
+
+// Timings holds the duration of each phase of the run. Durations are
+// written to JSON in nanoseconds.
+type Timings struct {
+	FetchBlocks            time.Duration `json:"fetch_blocks"`
+	SortBlocks             time.Duration `json:"sort_blocks"`
+	OrganizeParticipations time.Duration `json:"organize_participations"`
+	CalculateParticipation time.Duration `json:"calculate_participation"`
+
+	DownloadedBytes int64 `json:"downloaded_bytes"` // Total bytes downloaded from all nodes.
+}
+
+// Bandwidth returns the average download rate while fetching blocks, in bytes per second.
+func (t Timings) Bandwidth() float64 {
+	return float64(t.DownloadedBytes) / t.FetchBlocks.Seconds()
+}
+
+// NodeStats holds the traffic sent to a single Beacon node.
+type NodeStats struct {
+	Address  string `json:"address"`
+	Name     string `json:"name,omitempty"` // Alias given with --node, if any.
+	Requests int    `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Scope describes the range of the run.
+type Scope struct {
+	FromEpoch phase0.Epoch `json:"from_epoch"`
+	ToEpoch   phase0.Epoch `json:"to_epoch"`
+	Slots     int          `json:"slots"`
+	Blocks    int          `json:"blocks"` // Canonical blocks within the range.
+
+	Committees         []int `json:"committees,omitempty"`          // Committee indices the stats are restricted to, if any.
+	SlotIndices        []int `json:"slot_indices,omitempty"`        // Slot-in-epoch indices the stats are restricted to, if any.
+	ExcludedValidators int   `json:"excluded_validators,omitempty"` // Number of validators left out of the stats.
+	IncludingProposers int   `json:"including_proposers,omitempty"` // Number of proposers whose inclusions alone are counted as executed, if restricted.
+
+	// ExcludingReorgedDuties is set if duties whose inclusion window
+	// overlapped a reorged block are counted apart, in ReorgAffected.
+	ExcludingReorgedDuties bool `json:"excluding_reorged_duties,omitempty"`
+
+	// Partial is set if the range, including the inclusion lookahead,
+	// extends past the head, which was at HeadSlot.
+	Partial  bool        `json:"partial"`
+	HeadSlot phase0.Slot `json:"head_slot"`
+
+	// Trimmed is set if the range was requested from RequestedFromEpoch,
+	// but no node served the blocks before FromEpoch.
+	Trimmed            bool         `json:"trimmed"`
+	RequestedFromEpoch phase0.Epoch `json:"requested_from_epoch"`
+
+	// DeadlineExceeded is set if the run stopped fetching at its deadline,
+	// leaving the epochs it hadn't fetched out as incomplete.
+	DeadlineExceeded bool `json:"deadline_exceeded,omitempty"`
+	// BudgetSpent is the cap of --max-requests or --max-bandwidth the run
+	// stopped fetching at, such as "500 MiB", if any.
+	BudgetSpent string `json:"budget_spent,omitempty"`
+}
+
+// IncludesSlotIndex reports whether the stats cover the given slot-in-epoch index.
+func (s Scope) IncludesSlotIndex(index int) bool {
+	if len(s.SlotIndices) == 0 {
+		return true
+	}
+	for _, i := range s.SlotIndices {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// Epochs returns the number of epochs in the range.
+func (s Scope) Epochs() int {
+	return int(s.ToEpoch-s.FromEpoch) + 1
+}
+
+// ProposalRate returns the percentage of slots in the range that have a canonical block.
+func (s Scope) ProposalRate() float64 {
+	return float64(s.Blocks) / float64(s.Slots) * 100
+}
+
+// Render prints the report as tables.
+func (r *Report) Render(w io.Writer) error {
+	fmt.Fprintf(w, "global-epoch-stats %s on %s, epochs %d—%d (%s — %s)\n",
+		r.Metadata.Tool.Version,
+		r.Metadata.Network,
+		r.Scope.FromEpoch,
+		r.Scope.ToEpoch,
+		r.Metadata.StartTime.Format(time.RFC3339),
+		r.Metadata.EndTime.Format(time.RFC3339),
+	)
+	for _, n := range r.Nodes {
+		if n.Name != "" {
+			fmt.Fprintf(w, "Node: %s (%s)\n", n.Name, n.Address)
+		} else {
+			fmt.Fprintf(w, "Node: %s\n", n.Address)
+		}
+	}
+	for _, f := range r.Forks {
+		fmt.Fprintf(w, "Fork: %s at epoch %d\n", f.Name, f.Epoch)
+	}
+	if r.Metadata.BlockExport {
+		fmt.Fprintf(w, "Blocks read from a local export, with duties and committees fetched from the nodes\n")
+	}
+	if r.Scope.ExcludedValidators > 0 {
+		fmt.Fprintf(w, "Excluding %d validators\n", r.Scope.ExcludedValidators)
+	}
+	if r.Scope.IncludingProposers > 0 {
+		fmt.Fprintf(w, "Counting only attestations first included by %d proposers as executed\n", r.Scope.IncludingProposers)
+	}
+	if r.Scope.Partial {
+		fmt.Fprintf(w, "PARTIAL: the range ends past the head at slot %d, so %d attestations are still pending\n",
+			r.Scope.HeadSlot, r.Attestations.Pending)
+	}
+	if r.Scope.Trimmed {
+		fmt.Fprintf(w, "TRIMMED: the range starts at epoch %d instead of %d, since no node serves older blocks\n",
+			r.Scope.FromEpoch, r.Scope.RequestedFromEpoch)
+	}
+	if r.Scope.DeadlineExceeded {
+		fmt.Fprintf(w, "DEADLINE: the run stopped fetching at its deadline, leaving %d epochs out as incomplete\n", len(r.Incomplete))
+	}
+	if r.Scope.BudgetSpent != "" {
+		fmt.Fprintf(w, "BUDGET: the run stopped fetching at its cap of %s, leaving %d epochs out as incomplete\n", r.Scope.BudgetSpent, len(r.Incomplete))
+	}
+	if r.Sample != nil {
+		fmt.Fprintf(w, "SAMPLE: stats cover %d of %d epochs, in %d random clusters of up to %d (seed %d)\n",
+			r.Sample.Epochs, r.Scope.Epochs(), r.Sample.Clusters, r.Sample.ClusterEpochs, r.Sample.Seed)
+	}
+	if len(r.Incomplete) > 0 {
+		fmt.Fprintf(w, "INCOMPLETE: %d epochs are left out of the stats, since some of their blocks couldn't be fetched\n",
+			len(r.Incomplete))
+	}
+	fmt.Fprintln(w)
+
+	models := r.Metadata.EffectivenessModels
+	fmt.Fprintf(w, "Slots\n")
+	tbl := table.New(w)
+	tbl.AddHeaders(append([]string{"Slot", "Assigned", "Executed", "Rate"}, effectivenessHeaders(models)...)...)
+	for i, stats := range r.Slots {
+		if !r.Scope.IncludesSlotIndex(i) {
+			continue
+		}
+		tbl.AddRow(append([]string{
+			fmt.Sprint(i),
+			fmt.Sprint(stats.Assigned),
+			fmt.Sprint(stats.Executed),
+			percent(stats.Rate()),
+		}, effectivenessCells(models, stats)...)...)
+	}
+	tbl.Render()
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Timings\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("FetchBlocks", "SortBlocks", "OrganizeParticipations", "CalculateParticipation", "Downloaded", "Bandwidth")
+	tbl.AddRow(
+		fmt.Sprint(r.Timings.FetchBlocks),
+		fmt.Sprint(r.Timings.SortBlocks),
+		fmt.Sprint(r.Timings.OrganizeParticipations),
+		fmt.Sprint(r.Timings.CalculateParticipation),
+		formatBytes(float64(r.Timings.DownloadedBytes)),
+		formatBytes(r.Timings.Bandwidth())+"/s",
+	)
+	tbl.Render()
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Nodes\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Node", "Requests", "Downloaded")
+	for _, n := range r.Nodes {
+		name := n.Name
+		if name == "" {
+			name = n.Address
+		}
+		tbl.AddRow(name, fmt.Sprint(n.Requests), formatBytes(float64(n.Bytes)))
+	}
+	tbl.Render()
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Scope\n")
+	tbl = table.New(w)
+	tbl.AddHeaders(fmt.Sprintf("%d Epochs", r.Scope.Epochs()), "Proposal Rate")
+	tbl.AddRow(
+		fmt.Sprintf("%d—%d", r.Scope.FromEpoch, r.Scope.ToEpoch),
+		percent(r.Scope.ProposalRate()),
+	)
+	tbl.Render()
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Attestations\n")
+	tbl = table.New(w)
+	tbl.AddHeaders(append(append([]string{"Assigned", "Executed", "Rate", "Avg Raw Delay", "Avg Effective Delay"}, effectivenessHeaders(models)...), "Duplicate Aggregates")...)
+	totals := r.epochTotals()
+	duplicates := totals.Duplicates
+	tbl.AddRow(append(append([]string{
+		fmt.Sprint(r.Attestations.Assigned),
+		fmt.Sprint(r.Attestations.Executed),
+		percent(r.Attestations.Rate()),
+		fmt.Sprintf("%.2f", r.Attestations.AverageRawDelay()),
+		fmt.Sprintf("%.2f", r.Attestations.AverageEffectiveDelay()),
+	}, effectivenessCells(models, r.Attestations)...), fmt.Sprintf("%d (%s)", duplicates.Duplicates, percent(duplicates.Rate())))...)
+	tbl.Render()
+	if duplicates.Duplicates > 0 {
+		fmt.Fprintf(w, "Duplicate aggregates re-included %d votes, and %d of them added none\n", duplicates.Votes, duplicates.Redundant)
+	}
+	if r.Scope.ExcludingReorgedDuties {
+		affected := totals.ReorgAffected
+		fmt.Fprintf(w, "Excluded %d duties whose inclusion window overlapped a reorg, of which %d were executed (%s)\n",
+			affected.Assigned, affected.Executed, percent(affected.Rate()))
+	}
+
+	if r.Sample != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Estimated Attestation Rate\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Estimate", "95% Confidence Interval")
+		interval := "unknown (a single cluster)"
+		if r.Sample.Rate.Low != nil {
+			interval = fmt.Sprintf("%s — %s", percent(*r.Sample.Rate.Low), percent(*r.Sample.Rate.High))
+		}
+		tbl.AddRow(percent(r.Sample.Rate.Value), interval)
+		tbl.Render()
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Missed Attestations\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Missed", "Attester Fault", "Proposer/Network Fault", "Only in Orphans")
+	tbl.AddRow(
+		fmt.Sprint(r.Missed.Total()),
+		fmt.Sprintf("%d (%s)", r.Missed.AttesterFault, percent(float64(r.Missed.AttesterFault)/float64(r.Missed.Total())*100)),
+		fmt.Sprintf("%d (%s)", r.Missed.ProposerFault, percent(float64(r.Missed.ProposerFault)/float64(r.Missed.Total())*100)),
+		fmt.Sprintf("%d (%s)", totals.OrphanedOnly, percent(float64(totals.OrphanedOnly)/float64(r.Missed.Total())*100)),
+	)
+	tbl.Render()
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Proposer Clients\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Client", "Blocks", "Next-Block Attestations", "Included at Delay 1", "Rate")
+	for _, c := range r.Clients {
+		tbl.AddRow(
+			c.Client,
+			fmt.Sprint(c.Blocks),
+			fmt.Sprint(c.Attestations),
+			fmt.Sprint(c.IncludedAtDelay1),
+			percent(c.Delay1Rate()),
+		)
+	}
+	tbl.Render()
+
+	if r.Transition.Boundary.Assigned > 0 && r.Transition.Rest.Assigned > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Epoch Transition\n")
+		tbl = table.New(w)
+		tbl.AddHeaders(append([]string{"Slots", "Assigned", "Executed", "Rate"}, effectivenessHeaders(models)...)...)
+		for _, row := range []struct {
+			name  string
+			stats AttestationStats
+		}{
+			{fmt.Sprintf("0—%d", transitionSlots-1), r.Transition.Boundary},
+			{fmt.Sprintf("%d—%d", transitionSlots, len(r.Slots)-1), r.Transition.Rest},
+		} {
+			tbl.AddRow(append([]string{
+				row.name,
+				fmt.Sprint(row.stats.Assigned),
+				fmt.Sprint(row.stats.Executed),
+				percent(row.stats.Rate()),
+			}, effectivenessCells(models, row.stats)...)...)
+		}
+		// Only the rate delta is tested for significance, so it's the only
+		// one shown.
+		delta := []string{"Δ", "", "", fmt.Sprintf("%+.2fpp", r.Transition.RateDelta())}
+		for range models {
+			delta = append(delta, "")
+		}
+		tbl.AddRow(delta...)
+		tbl.Render()
+		significance := "not significant"
+		if r.Transition.Significant() {
+			significance = "significant"
+		}
+		fmt.Fprintf(w, "Rate delta is %s (p=%.4f)\n", significance, r.Transition.PValue)
+	}
+
+	if len(r.Forks) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Forks\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Fork", "Epoch", "Rate Before", "Rate After", "Δ", "p", "Significance")
+		for _, f := range r.Forks {
+			significance := "not significant"
+			if f.Significant() {
+				significance = "significant"
+			}
+			tbl.AddRow(
+				f.Name,
+				fmt.Sprint(f.Epoch),
+				percent(f.Before.Rate()),
+				percent(f.After.Rate()),
+				fmt.Sprintf("%+.2fpp", f.RateDelta()),
+				fmt.Sprintf("%.4f", f.PValue),
+				significance,
+			)
+		}
+		tbl.Render()
+	}
+
+	for _, buckets := range []struct {
+		title, header string
+		list          []TimeBucketStats
+	}{
+		{"By Hour of Day (UTC)", "Hour", r.HoursOfDay},
+		{"By Day of Week (UTC)", "Day", r.DaysOfWeek},
+	} {
+		if len(buckets.list) == 0 {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "%s\n", buckets.title)
+		tbl = table.New(w)
+		tbl.AddHeaders(buckets.header, "Epochs", "Assigned", "Executed", "Rate", "Δ")
+		for _, b := range buckets.list {
+			tbl.AddRow(
+				b.Bucket,
+				fmt.Sprint(b.Epochs),
+				fmt.Sprint(b.Attestations.Assigned),
+				fmt.Sprint(b.Attestations.Executed),
+				percent(b.Attestations.Rate()),
+				fmt.Sprintf("%+.2fpp", b.Attestations.Rate()-r.Attestations.Rate()),
+			)
+		}
+		tbl.Render()
+	}
+
+	if len(r.Reorgs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Reorgs\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Orphaned Slot", "Proposer", "Votes", "Canonical Slot", "Canonical Proposer", "Canonical Votes")
+		for _, reorg := range r.Reorgs {
+			tbl.AddRow(
+				fmt.Sprint(reorg.Slot),
+				fmt.Sprint(reorg.ProposerIndex),
+				fmt.Sprint(reorg.Votes),
+				fmt.Sprint(reorg.CanonicalSlot),
+				fmt.Sprint(reorg.CanonicalProposerIndex),
+				fmt.Sprint(reorg.CanonicalVotes),
+			)
+		}
+		tbl.Render()
+	}
+
+	if len(r.DoubleBlocks) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Double Blocks\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Slot", "Proposer", "Canonical Root", "Orphaned Proposer", "Orphaned Root", "Detected", "Equivocation")
+		for _, d := range r.DoubleBlocks {
+			equivocation := ""
+			if d.Equivocation() {
+				equivocation = "yes"
+			}
+			tbl.AddRow(
+				fmt.Sprint(d.Slot),
+				fmt.Sprint(d.ProposerIndex),
+				shortHex(d.CanonicalRoot),
+				fmt.Sprint(d.OrphanedProposerIndex),
+				shortHex(d.OrphanedRoot),
+				d.Detected,
+				equivocation,
+			)
+		}
+		tbl.Render()
+	}
+
+	if len(r.Incomplete) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Incomplete epochs\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Epoch", "Failed Slots")
+		for _, e := range r.Incomplete {
+			slots := make([]string, len(e.FailedSlots))
+			for i, slot := range e.FailedSlots {
+				slots[i] = fmt.Sprint(slot)
+			}
+			tbl.AddRow(fmt.Sprint(e.Epoch), strings.Join(slots, ", "))
+		}
+		tbl.Render()
+	}
+
+	renderedGroups := false
+	for _, groups := range []struct {
+		title string
+		list  []GroupStats
+	}{
+		{"Entities", r.Entities},
+		{"Regions", r.Regions},
+		{"ASNs", r.ASNs},
+		{"Validator Age", r.Cohorts},
+		{"Withdrawal Addresses", r.Withdrawals},
+	} {
+		if len(groups.list) > 0 {
+			fmt.Fprintln(w)
+			renderGroups(w, groups.title, groups.list, models)
+			renderedGroups = true
+		}
+	}
+	if r.UnattributedWithdrawals > 0 {
+		fmt.Fprintf(w, "%d validators have BLS withdrawal credentials, so they aren't attributed to a withdrawal address\n", r.UnattributedWithdrawals)
+	}
+	if b := r.Baseline; b != nil && len(b.Epochs) > 0 && renderedGroups {
+		fmt.Fprintf(w, "Network baseline rate over the %d epochs it covers: %s\n", len(b.Epochs), percent(b.Baseline.Rate()))
+	}
+
+	if len(r.SlashableVotes) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "SLASHABLE VOTES\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Validator", "Kind", "First Vote", "Second Vote")
+		for _, v := range r.SlashableVotes {
+			tbl.AddRow(
+				fmt.Sprint(v.Validator),
+				v.Kind,
+				fmt.Sprintf("%d→%d at slot %d", v.First.Source, v.First.Target, v.First.Slot),
+				fmt.Sprintf("%d→%d at slot %d", v.Second.Source, v.Second.Target, v.Second.Slot),
+			)
+		}
+		tbl.Render()
+	}
+
+	if p := r.Percentiles; p != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Validator Percentiles\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Validator", "Assigned", "Executed", "Rate", "Percentile")
+		for _, v := range p.Validators {
+			tbl.AddRow(
+				fmt.Sprint(v.Validator),
+				fmt.Sprint(v.Attestations.Assigned),
+				fmt.Sprint(v.Attestations.Executed),
+				percent(v.Attestations.Rate()),
+				fmt.Sprintf("%.1f", v.Percentile),
+			)
+		}
+		tbl.AddFooters(
+			"Set",
+			fmt.Sprint(p.Attestations.Assigned),
+			fmt.Sprint(p.Attestations.Executed),
+			percent(p.Attestations.Rate()),
+			fmt.Sprintf("%.1f", p.Percentile),
+		)
+		tbl.Render()
+		fmt.Fprintf(w, "Ranked among %d validators with duties; the set's median percentile is %.1f\n", p.Network, p.Median)
+	}
+
+	if f := r.Flakiness; f != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Flaky Validators\n")
+		if len(f.Flaky) == 0 {
+			fmt.Fprintf(w, "None of the %d validators with duties missed them in a periodic pattern\n", f.Validators)
+		} else {
+			tbl = table.New(w)
+			tbl.AddHeaders("Validator", "Assigned", "Executed", "Rate", "Period", "Missed Epochs")
+			for _, v := range f.Flaky {
+				phases := make([]string, len(v.MissedPhases))
+				for i, phase := range v.MissedPhases {
+					phases[i] = fmt.Sprint(phase)
+				}
+				tbl.AddRow(
+					fmt.Sprint(v.Validator),
+					fmt.Sprint(v.Attestations.Assigned),
+					fmt.Sprint(v.Attestations.Executed),
+					percent(v.Attestations.Rate()),
+					fmt.Sprintf("%d epochs", v.Period),
+					fmt.Sprintf("%s mod %d", strings.Join(phases, ", "), v.Period),
+				)
+			}
+			tbl.Render()
+			fmt.Fprintf(w, "%d of %d validators with duties missed them in a periodic pattern\n", len(f.Flaky), f.Validators)
+		}
+	}
+
+	if b := r.Baseline; b != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Network Baseline\n")
+		if len(b.Epochs) == 0 {
+			fmt.Fprintf(w, "%s covers none of the epochs with duties\n", b.Source)
+		} else {
+			tbl = table.New(w)
+			tbl.AddHeaders("Epoch", "Assigned", "Rate", "Baseline Assigned", "Baseline Rate", "Delta")
+			baselineRow := func(label string, stats, base AttestationStats) []string {
+				return []string{
+					label,
+					fmt.Sprint(stats.Assigned),
+					percent(stats.Rate()),
+					fmt.Sprint(base.Assigned),
+					percent(base.Rate()),
+					fmt.Sprintf("%+.2f pp", stats.Rate()-base.Rate()),
+				}
+			}
+			for _, e := range b.Epochs {
+				tbl.AddRow(baselineRow(fmt.Sprint(e.Epoch), e.Attestations, e.Baseline)...)
+			}
+			tbl.AddFooters(baselineRow("Total", b.Attestations, b.Baseline)...)
+			tbl.Render()
+			fmt.Fprintf(w, "Baseline from %s\n", b.Source)
+		}
+	}
+
+	if len(r.SyncCommittee) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Sync Committee\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Epoch", "Duties", "Missed", "Rate", "Est. Lost")
+		var total SyncStats
+		for _, s := range r.SyncCommittee {
+			total.add(s)
+			tbl.AddRow(
+				fmt.Sprint(s.Epoch),
+				fmt.Sprint(s.Duties),
+				fmt.Sprint(s.Missed),
+				percent(s.Rate()),
+				fmt.Sprintf("%d gwei", s.LostGwei),
+			)
+		}
+		tbl.AddFooters(
+			"Total",
+			fmt.Sprint(total.Duties),
+			fmt.Sprint(total.Missed),
+			percent(total.Rate()),
+			fmt.Sprintf("%d gwei", total.LostGwei),
+		)
+		tbl.Render()
+	}
+
+	if len(r.SyncPeriods) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Sync Committee Periods\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Period", "Epochs", "Members", "Stayed", "Joined", "Left", "Participation")
+		for _, p := range r.SyncPeriods {
+			stayed, joined, left := "-", "-", "-"
+			if t := p.Turnover; t != nil {
+				stayed, joined, left = fmt.Sprint(t.Stayed), fmt.Sprint(t.Joined), fmt.Sprint(t.Left)
+			}
+			tbl.AddRow(
+				fmt.Sprint(p.Period),
+				fmt.Sprintf("%d—%d", p.FromEpoch, p.ToEpoch),
+				fmt.Sprint(p.Members),
+				stayed,
+				joined,
+				left,
+				formatSyncParticipation(p.SyncAggregates),
+			)
+		}
+		tbl.Render()
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Network Health\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Epoch", "Attestation Rate", "Effectiveness", "Proposal Rate", "Sync Participation", "Score")
+	for _, e := range r.Epochs {
+		tbl.AddRow(
+			e.Label(),
+			percent(e.Attestations.Rate()),
+			percent(e.Attestations.EffectivenessOf(models[0])),
+			percent(e.ProposalRate()),
+			formatSyncParticipation(e.SyncAggregates),
+			formatScore(e.HealthScore),
+		)
+	}
+	total := r.epochTotals()
+	tbl.AddFooters(
+		"Total",
+		percent(total.Attestations.Rate()),
+		percent(total.Attestations.EffectivenessOf(models[0])),
+		percent(total.ProposalRate()),
+		formatSyncParticipation(total.SyncAggregates),
+		formatScore(r.HealthScore),
+	)
+	tbl.Render()
+	hw := r.Metadata.HealthWeights
+	fmt.Fprintf(w, "Score weights: participation %g, effectiveness (%s) %g, proposals %g, sync %g\n",
+		hw.Participation, models[0], hw.Effectiveness, hw.Proposals, hw.Sync)
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Block Packing\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Epoch", "Blocks", "Attestations", "Utilization", "Full", "Left Behind", "Duties Left Behind", "Nothing to Pack", "Late Pickups")
+	packingRow := func(label string, p PackingStats) []string {
+		return []string{
+			label,
+			fmt.Sprint(p.Blocks),
+			fmt.Sprint(p.Attestations),
+			percent(p.Utilization()),
+			fmt.Sprint(p.Full),
+			fmt.Sprint(p.LeftBehind),
+			fmt.Sprint(p.LeftBehindDuties),
+			fmt.Sprint(p.NothingToPack),
+			fmt.Sprintf("%d (%s)", p.LatePickups, percent(p.LatePickupRate())),
+		}
+	}
+	for _, e := range r.Epochs {
+		tbl.AddRow(packingRow(e.Label(), e.Packing)...)
+	}
+	tbl.AddFooters(packingRow("Total", total.Packing)...)
+	tbl.Render()
+	fmt.Fprintf(w, "Blocks with room to spare left duties behind if a later block included them, or had nothing to pack\n")
+	fmt.Fprintf(w, "Late pickups are duties first included after an earlier block could have included them\n")
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Execution\n")
+	tbl = table.New(w)
+	relays := len(r.Metadata.Relays) > 0
+	headers := []string{"Epoch", "Attestation Rate", "Payloads", "Gas Used", "Gas Utilization", "Avg Base Fee", "Blob Gas Used", "Avg Blob Base Fee"}
+	if relays {
+		headers = append(headers, "MEV Adoption")
+	}
+	tbl.AddHeaders(headers...)
+	for _, e := range r.Epochs {
+		// Epochs before Deneb have no blob gas.
+		blobGasUsed, blobBaseFee := "", ""
+		if e.Execution.BlobPayloads > 0 {
+			blobGasUsed = fmt.Sprint(e.Execution.BlobGasUsed)
+			blobBaseFee = formatWei(e.Execution.AverageBlobBaseFee())
+		}
+		row := []string{
+			e.Label(),
+			percent(e.Attestations.Rate()),
+			fmt.Sprint(e.Execution.Payloads),
+			fmt.Sprint(e.Execution.GasUsed),
+			percent(e.Execution.Utilization()),
+			fmt.Sprintf("%.2f gwei", e.Execution.AverageBaseFee()),
+			blobGasUsed,
+			blobBaseFee,
+		}
+		if relays {
+			row = append(row, percent(e.Execution.MEVAdoption()))
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.Render()
+
+	if len(r.Builders) > 0 {
+		relayed := 0
+		for _, b := range r.Builders {
+			relayed += b.Blocks
+		}
+		builders := r.Builders
+		fmt.Fprintln(w)
+		if len(builders) > maxGroupRows {
+			fmt.Fprintf(w, "Builders (largest %d of %d)\n", maxGroupRows, len(builders))
+			builders = builders[:maxGroupRows]
+		} else {
+			fmt.Fprintf(w, "Builders\n")
+		}
+		tbl = table.New(w)
+		tbl.AddHeaders("Builder", "Name", "Blocks", "Market Share")
+		for _, b := range builders {
+			tbl.AddRow(shortHex(b.Pubkey), b.Name, fmt.Sprint(b.Blocks), percent(float64(b.Blocks)/float64(relayed)*100))
+		}
+		tbl.Render()
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Committees\n")
+	tbl = table.New(w)
+	tbl.AddHeaders("Epoch", "Committees", "Per Slot", "Min Size", "Avg Size", "Max Size")
+	for _, e := range r.Epochs {
+		tbl.AddRow(
+			e.Label(),
+			fmt.Sprint(e.Committees.Committees),
+			fmt.Sprint(e.Committees.PerSlot),
+			fmt.Sprint(e.Committees.MinSize),
+			fmt.Sprintf("%.1f", e.Committees.AverageSize()),
+			fmt.Sprint(e.Committees.MaxSize),
+		)
+	}
+	tbl.Render()
+
+	if len(r.StateChecks) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "State Verification\n")
+		tbl = table.New(w)
+		tbl.AddHeaders("Epoch", "Assigned", "Active in State", "Executed", "Participating in State", "Discrepancy")
+		for _, c := range r.StateChecks {
+			tbl.AddRow(
+				fmt.Sprint(c.Epoch),
+				fmt.Sprint(c.Assigned),
+				fmt.Sprint(c.StateActive),
+				fmt.Sprint(c.Executed),
+				fmt.Sprint(c.StateParticipating),
+				fmt.Sprintf("%+d", c.Discrepancy()),
+			)
+		}
+		tbl.Render()
+	}
+	return nil
+}
+
+// maxGroupRows is the number of largest groups shown in group tables.
+// JSON outputs include all groups.
+const maxGroupRows = 20
+
+func renderGroups(w io.Writer, title string, groups []GroupStats, models []string) {
+	if len(groups) > maxGroupRows {
+		fmt.Fprintf(w, "%s (largest %d of %d)\n", title, maxGroupRows, len(groups))
+		groups = groups[:maxGroupRows]
+	} else {
+		fmt.Fprintf(w, "%s\n", title)
+	}
+	tbl := table.New(w)
+	tbl.AddHeaders(append([]string{"Name", "Validators", "Active Epochs", "Duties/Epoch", "Assigned", "Executed", "Rate"}, effectivenessHeaders(models)...)...)
+	for _, g := range groups {
+		tbl.AddRow(append([]string{
+			g.Name,
+			fmt.Sprint(g.Validators),
+			fmt.Sprint(g.ActiveEpochs),
+			fmt.Sprintf("%.2f", g.DutiesPerActiveEpoch()),
+			fmt.Sprint(g.Attestations.Assigned),
+			fmt.Sprint(g.Attestations.Executed),
+			percent(g.Attestations.Rate()),
+		}, effectivenessCells(models, g.Attestations)...)...)
+	}
+	tbl.Render()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// RenderTemplate executes the text/template at path with the report as its data.
+func (r *Report) RenderTemplate(w io.Writer, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(path)).
+		Funcs(template.FuncMap{"percent": percent, "bytes": formatBytes}).
+		Parse(string(b))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl.Execute(w, r)
+}
+
+// shortHex abbreviates a hex string, such as a root or pubkey, for tables.
+func shortHex(s string) string {
+	if len(s) > 12 {
+		return s[:12] + "…"
+	}
+	return s
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%.2f%%", v)
+}
+
+// formatWei formats an amount of wei, in gwei unless it's below a
+// hundredth of one, as blob base fees often are.
+func formatWei(wei float64) string {
+	if wei < 1e7 {
+		return fmt.Sprintf("%.0f wei", wei)
+	}
+	return fmt.Sprintf("%.2f gwei", wei/1e9)
+}
+
+// formatSyncParticipation formats a sync participation rate, which epochs
+// before Altair have none of.
+func formatSyncParticipation(s SyncAggregateStats) string {
+	if s.Positions == 0 {
+		return "—"
+	}
+	return percent(s.Rate())
+}
+
+// formatScore formats a health score, which is nil without data.
+func formatScore(s *float64) string {
+	if s == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%.2f", *s)
+}
+
+func formatBytes(b float64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%.0f B", b)
+	}
+	exp := 0
+	for n := b / unit; n >= unit && exp < 4; n /= unit {
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", b/math.Pow(unit, float64(exp+1)), "KMGTP"[exp])
+}
@@ -0,0 +1,2170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// fetchRounds is how many times each node is asked for a block before
+	// giving up on its slot, and fetchRetryDelay the pause between rounds.
+	fetchRounds     = 3
+	fetchRetryDelay = time.Second
+
+	// exitIncomplete is the exit status of runs that left out epochs whose
+	// blocks couldn't be fetched.
+	exitIncomplete = 3
+	// exitDeadline is the exit status of runs that stopped fetching at
+	// their deadline, or at a cap of --max-requests or --max-bandwidth.
+	exitDeadline = 4
+)
+
+type AttesterParticipation struct {
+	Included      bool
+	InclusionSlot phase0.Slot
+}
+
+type CommitteeParticipation []AttesterParticipation
+
+type blockWithRoot struct {
+	Root      phase0.Root
+	Execution executionSummary
+	*bellatrix.SignedBeaconBlock
+}
+
+// runCmd computes stats over a range of epochs.
+type runCmd struct {
+	Concurrency          string            `short:"c" help:"Per-node concurrency limit, scaled by each node's weight, or 'auto' to tune it to each node" default:"16"`
+	Node                 []string          `help:"Comma-separated Beacon node addresses, each optionally named for reports and weighted to take a larger or smaller share of requests and concurrency, such as lighthouse=http://localhost:5052?weight=4,http://localhost:3500"`
+	AllowPublic          bool              `help:"If --node is omitted, use public Beacon nodes of --network instead"`
+	Network              string            `help:"Network the Beacon nodes must be on, such as mainnet or gnosis. With --allow-public, public nodes of it are used (defaults to mainnet)"`
+	Epochs               string            `required:"" help:"Epoch, or range of epochs such as 1000-1010, or 1000- to end at the latest finalized epoch"`
+	Template             string            `type:"existingfile" help:"Render the report with a Go text/template file instead of the default tables"`
+	Committees           []int             `help:"Comma-separated committee indices to restrict the stats to, such as 0,1,2"`
+	SlotIndices          string            `help:"Slot-in-epoch indices to restrict the stats to, such as 0-3 or 0,1,31"`
+	ExcludeValidators    string            `type:"existingfile" help:"File of validator indices, one per line, to leave out of the stats"`
+	IncludingProposers   string            `type:"existingfile" help:"File of validator indices, one per line, to count only attestations first included in blocks they proposed as executed, to measure how much of the network's inclusion they carry"`
+	Depositors           string            `type:"existingfile" help:"CSV of validator_index,deposit_address[,entity] to break down the stats by entity, or by depositor if the entity is empty"`
+	Locations            string            `type:"existingfile" help:"CSV of validator_index,region[,asn] to break down the stats by region and ASN"`
+	Cohorts              bool              `help:"Break down the stats by validator age: activated less than 1, 1 to 6, or over 6 months before the range"`
+	WithdrawalAddress    []string          `help:"Comma-separated execution addresses, such as 0x00000000219ab540356cbb839cbe05303d7705fa, to break down the stats by, finding the validators that withdraw to each from their withdrawal credentials"`
+	Temporal             bool              `help:"Break down attestation rates by UTC hour of day and day of week, to surface periodic patterns"`
+	WatchValidators      string            `type:"existingfile" help:"File of validator indices, one per line, to scan for slashable double and surround votes"`
+	SyncValidators       string            `type:"existingfile" help:"File of validator indices, one per line, to report missed sync committee participation and estimated rewards lost for"`
+	RankValidators       string            `type:"existingfile" help:"File of validator indices, one per line, to rank by attestation rate among all validators with duties in the range"`
+	FlakyValidators      string            `type:"existingfile" help:"File of validator indices, one per line, to check for duties missed in a periodic pattern, such as every 4th epoch, as a failover misconfiguration causes"`
+	DelayValidators      string            `type:"existingfile" help:"File of validator indices, one per line, whose inclusion delay distributions to write to --delay-distribution along with the network's"`
+	DelayDistribution    string            `help:"Write the number of attestations of each validator of --delay-validators, and of the network, included at each raw delay to the given .parquet or .csv file"`
+	EffectivenessModel   string            `enum:"reciprocal-delay,effective-delay,attestant,reward,all" default:"reciprocal-delay" help:"Effectiveness model shown in tables: reciprocal-delay, effective-delay, attestant, reward, or all side by side"`
+	HealthWeights        string            `default:"participation=1,effectiveness=1,proposals=1,sync=1" help:"Weights of the attestation rate, effectiveness (under the first model shown), proposal rate and sync participation blended into each epoch's network health score"`
+	JSON                 string            `help:"Write the report as JSON to the given file, or to stdout instead of the tables if '-'"`
+	RawAttestations      string            `help:"Write one record per attestation duty to the given .parquet or .csv file"`
+	RawBlocks            string            `help:"Write one record per canonical block, with its proposer, graffiti, attestations and sync participation, to the given .parquet or .csv file"`
+	Relay                []string          `help:"Comma-separated MEV-Boost relay addresses, such as https://boost-relay.flashbots.net, whose data APIs to report MEV adoption and builder market share from"`
+	DoubleBlocks         string            `enum:"resolve,exclude,fail" default:"resolve" help:"How to handle a slot for which a node served a block the canonical chain doesn't build on: resolve it to the canonical block, exclude its epochs, or fail"`
+	Deadline             time.Duration     `help:"Stop fetching blocks once the run has taken this long, such as 20m, compute the stats of the epochs fully fetched, leave the rest out as incomplete, and exit with status 4 (0 for no deadline). --max-requests and --max-bandwidth cap a run the same way"`
+	MaxRequests          int               `help:"Stop fetching blocks once the run has made about this many requests to the nodes, to stay within the quota of hosted nodes, and leave the epochs not fully fetched out as incomplete, like --deadline, which caps the run's duration (0 for no limit)"`
+	MaxBandwidth         int               `help:"Stop fetching blocks once the run has downloaded about this many MiB from the nodes, leaving the epochs not fully fetched out as incomplete like --max-requests and --deadline (0 for no limit)"`
+	MaxBlockMemory       int               `help:"Most MiB of fetched blocks to hold, past which the earliest are evicted and their epochs left out as incomplete (0 for no limit)"`
+	StatusAddr           string            `help:"Serve a status page with the run's progress at the given address, such as :8080"`
+	EventsOut            string            `help:"Stream progress and each epoch's stats as newline-delimited JSON events to a Unix socket, such as unix:///tmp/ges.sock"`
+	NDJSONProgress       bool              `name:"ndjson-progress" help:"Stream the events of --events-out to stdout instead, ahead of the report"`
+	Sample               string            `help:"Fetch a random sample of the range, such as 10%, and estimate the attestation rate with a confidence interval"`
+	SampleSeed           int64             `help:"Seed of the random sample, to reproduce it (defaults to a random seed)"`
+	FetchOrder           string            `enum:"sequential,random" default:"sequential" help:"Order to fetch blocks from the nodes in: sequential, taking turns at contiguous runs of ascending slots, which archive nodes read faster from disk, or random, spreading every slot over a random node"`
+	BlockExport          string            `type:"existingdir" help:"Read blocks from a client's database export, a directory of SSZ-encoded signed blocks named by slot such as 4000000.ssz, instead of fetching them from the nodes. Only blocks are read locally: duties and committees are still fetched from the nodes"`
+	CacheDir             string            `help:"Cache fetched blocks and results of finalized epochs in the given directory, so that overlapping runs only compute new epochs and fetch new blocks"`
+	Textfile             string            `help:"Write aggregate metrics in OpenMetrics format to the given file, for node_exporter's textfile collector"`
+	Baseline             string            `help:"Compare the attestation rates with a baseline, the JSON report of a run over the whole network, read from a file or fetched from an http(s):// URL, over the epochs both cover"`
+	ExcludeReorgedDuties bool              `help:"Count duties whose inclusion window overlaps a reorged block apart from the stats, since reorgs are beyond operators' control"`
+	Label                map[string]string `help:"Label the JSON report and metrics with a key=value pair describing the run's context, such as run=pre-upgrade (repeatable)"`
+	ErrorReport          string            `help:"Write a summary of failed requests, slots and epochs to the given file, such as errors.json, whether or not the run succeeds"`
+	Manifest             string            `help:"Write a manifest of the run's inputs, timings and output hashes to the given file, such as manifest.json"`
+	Bundle               string            `help:"Also archive the report, as JSON and tables, and every other output of the run, such as --raw-attestations and --manifest, to the given .tar.zst, .tar.gz or .tar file, to attach to tickets as one file"`
+	VerifyState          bool              `help:"Check attestations of finalized epochs against participation flags in beacon states (requires an archive node)"`
+	DebugDump            string            `help:"Write the canonical chain index, the participation of every committee position and how each duty was resolved as CSV files to the given directory, to attach to reports of suspicious numbers"`
+	SelfCheck            bool              `help:"Recompute the stats of a random sample of committees straight from the attestations, and fail if they differ from the stats computed"`
+	VerifyBlocks         bool              `help:"Check that fetched blocks chain up to a block root all nodes agree on, to guard against nodes serving bogus blocks"`
+	VerifySignatures     bool              `help:"Also check the proposer signatures of fetched blocks (implies --verify-blocks)"`
+	VerifyWith           string            `help:"Fetch a sample of canonical blocks again from a node of another client implementation, such as http://teku:5052, and check that their attestations match byte for byte"`
+
+	HTTPProxy    string        `help:"Proxy URL for requests to Beacon nodes (defaults to the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	MaxIdleConns int           `help:"Maximum idle connections kept open per node" default:"64"`
+	IdleTimeout  time.Duration `help:"How long idle connections are kept open" default:"10m"`
+	TLSInsecure  bool          `help:"Skip verification of Beacon node TLS certificates"`
+	CACert       string        `type:"existingfile" help:"PEM bundle of additional CA certificates to trust for Beacon node TLS"`
+}
+
+// runState is what the phases of a run share: the nodes, range and filters
+// set up from the flags, and what each phase leaves for the next ones.
+type runState struct {
+	cmd       *runCmd
+	ctx       context.Context
+	startedAt time.Time
+	errs      *errorReporter
+	status    *runStatus
+	events    *eventStream
+	progress  *runProgress
+
+	transport       *http.Transport
+	nodes           []*nodeClient
+	sched           *scheduler
+	autoConcurrency bool
+	verifier        *nodeClient
+	spec            map[string]string
+	genesis         *apiv1.Genesis
+	secondsPerSlot  int
+	head            phase0.Slot
+	baseline        *Report
+
+	// Range, with the epochs to compute, which cached epochs at either end
+	// are left out of, and the epochs sampled among them.
+	fromEpoch, toEpoch, requestedFromEpoch phase0.Epoch
+	computeFrom, computeTo                 phase0.Epoch
+	fromSlot, toSlot                       phase0.Slot
+	clusters                               []epochCluster
+	sample                                 *SampleStats
+	sampled                                map[phase0.Epoch]bool
+
+	// Filters and breakdowns.
+	committeeFilter         []bool
+	slotIndices             []int
+	slotIndexFilter         []bool
+	healthWeights           HealthWeights
+	excluded                map[phase0.ValidatorIndex]bool
+	includingProposers      map[phase0.ValidatorIndex]bool
+	watched                 map[phase0.ValidatorIndex]bool
+	syncValidators          map[phase0.ValidatorIndex]bool
+	syncModel               syncRewardModel
+	syncModelErr            error
+	dump                    *debugDump
+	performance             *validatorPerformance
+	flakiness               *flakinessDetector
+	delays                  *delayDistribution
+	entities, regions, asns *validatorGroups
+	cohorts, withdrawals    *validatorGroups
+	allValidators           []*apiv1.Validator
+	unattributedWithdrawals int
+
+	cache         *epochCache
+	cachedResults map[phase0.Epoch]epochResult
+	anchors       map[phase0.Epoch]phase0.Root
+	blocksCache   *blockCache
+	export        *blockExport
+
+	// Fetched.
+	spans            [][2]phase0.Slot
+	store            *blockStore
+	fetched          int
+	doubles          []DoubleBlock
+	incomplete       map[phase0.Epoch][]phase0.Slot
+	deadlineExceeded bool
+	budgetSpent      string
+	proposerDuties   [][]*apiv1.ProposerDuty
+	committees       [][][]phase0.ValidatorIndex
+	syncCommittees   map[phase0.Epoch][]phase0.ValidatorIndex
+	firstSyncEpoch   phase0.Epoch
+	trackSyncPeriods bool
+	delivered        map[phase0.Hash32]string
+
+	// Deduplicated.
+	chain  *chainIndex
+	blocks []blockWithRoot
+
+	// Computed.
+	slotCommitteeParticipations [][]CommitteeParticipation
+	results                     []epochResult
+	leftBehind                  []int
+	pickups                     []blockPickups
+	timings                     Timings
+	report                      Report
+}
+
+func (cmd *runCmd) Run() error {
+	r := &runState{cmd: cmd, ctx: context.Background(), startedAt: time.Now()}
+	if cmd.ErrorReport != "" {
+		r.errs = newErrorReporter(cmd.ErrorReport)
+	}
+	r.setup()
+	r.progress = newRunProgress()
+	defer r.progress.Close()
+	r.progress.SetEvents(r.events)
+	r.fetch()
+	r.dedupe()
+	r.compute()
+	r.assemble()
+	r.render()
+	r.status.SetPhase("Done")
+	if len(r.report.Incomplete) > 0 {
+		log.Printf("%d epochs are incomplete", len(r.report.Incomplete))
+		if r.deadlineExceeded || r.budgetSpent != "" {
+			os.Exit(exitDeadline)
+		}
+		os.Exit(exitIncomplete)
+	}
+	return nil
+}
+
+// setup connects to the nodes, parses the range and filters, and looks up
+// cached epochs to settle which epochs to compute.
+func (r *runState) setup() {
+	cmd, ctx, errs := r.cmd, r.ctx, r.errs
+	transport, err := newTransport(transportConfig{
+		Proxy:        cmd.HTTPProxy,
+		MaxIdleConns: cmd.MaxIdleConns,
+		IdleTimeout:  cmd.IdleTimeout,
+		TLSInsecure:  cmd.TLSInsecure,
+		CACert:       cmd.CACert,
+	})
+	if err != nil {
+		errs.Fatal(err)
+	}
+	r.transport = transport
+	public := len(cmd.Node) == 0
+	if public {
+		if !cmd.AllowPublic {
+			errs.Fatal("No --node given. Pass --allow-public to use public Beacon nodes instead.")
+		}
+		if cmd.Network == "" {
+			cmd.Network = "mainnet"
+		}
+		cmd.Node = publicNodes[cmd.Network]
+		if len(cmd.Node) == 0 {
+			errs.Fatalf("No public %s Beacon nodes are known. Pass --node instead.", cmd.Network)
+		}
+		log.Printf("Using public %s Beacon nodes, which may be rate-limited or out of sync", cmd.Network)
+	}
+	configured, err := newNodeClients(cmd.Node, transport)
+	if err != nil {
+		errs.Fatal(err)
+	}
+	nodes := make([]*nodeClient, len(configured))
+	var g multierror.Group
+	for i, node := range configured {
+		i, node := i, node
+		g.Go(func() error {
+			version, err := node.NodeVersion(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to connect to %s: %w", node.Name(), err)
+			}
+			node.version = version
+			// Not every node exposes its identity, so it's only used to
+			// catch duplicates where it's available.
+			node.peerID, _ = node.PeerID(ctx)
+			nodes[i] = node
+			return nil
+		})
+	}
+	err = g.Wait().ErrorOrNil()
+	if public {
+		// Public nodes come and go, so make do with the reachable ones.
+		nodes, err = checkPublicNodes(ctx, nodes, cmd.Network)
+	} else if err == nil && cmd.Network != "" {
+		err = checkNetwork(ctx, nodes, cmd.Network)
+	}
+	if err != nil {
+		errs.Fatal(err)
+	}
+	nodes = dedupeNodeIdentities(nodes)
+	errs.SetNodes(nodes)
+	r.nodes = nodes
+	if cmd.StatusAddr != "" {
+		r.status = newRunStatus(nodes)
+		if err := r.status.Serve(cmd.StatusAddr); err != nil {
+			errs.Fatal(err)
+		}
+	}
+
+	switch {
+	case cmd.EventsOut != "" && cmd.NDJSONProgress:
+		errs.Fatal("--events-out and --ndjson-progress are mutually exclusive")
+	case cmd.EventsOut != "":
+		r.events, err = newEventStream(cmd.EventsOut)
+	case cmd.NDJSONProgress:
+		r.events, err = newEventStream("-")
+	}
+	if err != nil {
+		errs.Fatalf("Failed to open events stream: %s", err)
+	}
+
+	// Parse epochs.
+	fromEpoch, toEpoch, err := resolveEpochRange(ctx, nodes[0], cmd.Epochs)
+	if err != nil {
+		errs.Fatalf("Invalid epochs %q: %s", cmd.Epochs, err)
+	}
+	if toEpoch-fromEpoch > 1575 {
+		errs.Fatal("That's too many epochs, bruh?")
+	}
+
+	// Describe the run.
+	spec, err := nodes[0].Spec(ctx)
+	if err != nil {
+		errs.Fatal(err)
+	}
+	r.spec = spec
+	r.genesis, err = nodes[0].Genesis(ctx)
+	if err != nil {
+		errs.Fatal(err)
+	}
+	if err := setPreset(spec); err != nil {
+		errs.Fatal(err)
+	}
+	r.secondsPerSlot, err = strconv.Atoi(spec["SECONDS_PER_SLOT"])
+	if err != nil {
+		errs.Fatalf("Invalid SECONDS_PER_SLOT %q", spec["SECONDS_PER_SLOT"])
+	}
+	if cmd.VerifyWith != "" {
+		verifier := newNodeClient(cmd.VerifyWith, transport)
+		if verifier.version, err = verifier.NodeVersion(ctx); err != nil {
+			errs.Fatalf("Failed to connect to %s: %s", verifier.Name(), err)
+		}
+		if err := checkNetwork(ctx, []*nodeClient{verifier}, spec["CONFIG_NAME"]); err != nil {
+			errs.Fatal(err)
+		}
+		// Nodes of the same client share its bugs, defeating the check.
+		if client := versionClient(verifier.version); client != unknownClient {
+			for _, node := range nodes {
+				if versionClient(node.version) == client {
+					log.Printf("Warning: %s runs %s like node %s, so it can't catch bugs of %s", verifier.Name(), client, node.Name(), client)
+					break
+				}
+			}
+		}
+		r.verifier = verifier
+	}
+	if cmd.Baseline != "" {
+		r.baseline, err = loadBaseline(ctx, cmd.Baseline, spec["CONFIG_NAME"])
+		if err != nil {
+			errs.Fatalf("Invalid baseline %s: %s", redactAddress(cmd.Baseline), err)
+		}
+	}
+	// All requests from here on go through the scheduler, so that they
+	// share the nodes' concurrency limits with block fetching.
+	r.autoConcurrency = cmd.Concurrency == "auto"
+	concurrency, err := strconv.Atoi(cmd.Concurrency)
+	if !r.autoConcurrency && (err != nil || concurrency < 1) {
+		errs.Fatalf("Invalid concurrency %q", cmd.Concurrency)
+	}
+	sched := newScheduler(nodes, func(node *nodeClient) *limiter {
+		if r.autoConcurrency {
+			return newAutoLimiter()
+		}
+		// Weighted nodes are expected to take proportionally more
+		// requests at once.
+		limit := int(math.Round(float64(concurrency) * node.weight))
+		if limit < 1 {
+			limit = 1
+		}
+		return newLimiter(limit)
+	}, errs)
+	r.sched = sched
+	err = sched.Do(categoryDuties, func(node *nodeClient) error {
+		var err error
+		r.head, err = node.HeadSlot(ctx)
+		return err
+	})
+	if err != nil {
+		errs.Fatal(err)
+	}
+	if r.head < phase0.Slot(fromEpoch)*slotsPerEpoch {
+		errs.Fatalf("Epoch %d hasn't started yet (head is at slot %d)", fromEpoch, r.head)
+	}
+	r.requestedFromEpoch = fromEpoch
+	fromEpoch, err = checkHistory(ctx, sched, fromEpoch, toEpoch, r.head)
+	if err != nil {
+		errs.Fatal(err)
+	}
+	r.fromEpoch, r.toEpoch = fromEpoch, toEpoch
+
+	if cmd.Bundle != "" {
+		if _, err := bundleCompression(cmd.Bundle); err != nil {
+			errs.Fatal(err)
+		}
+	}
+	if cmd.MaxBlockMemory < 0 {
+		errs.Fatalf("Invalid max block memory %d", cmd.MaxBlockMemory)
+	}
+	if cmd.MaxRequests < 0 || cmd.MaxBandwidth < 0 {
+		errs.Fatal("--max-requests and --max-bandwidth can't be negative")
+	}
+
+	// Parse filters.
+	r.committeeFilter = make([]bool, maxCommitteesPerSlot)
+	for _, index := range cmd.Committees {
+		if index < 0 || index >= maxCommitteesPerSlot {
+			errs.Fatalf("Committee index %d is out of range", index)
+		}
+		r.committeeFilter[index] = true
+	}
+	if cmd.SlotIndices != "" {
+		r.slotIndices, err = parseIndexRanges(cmd.SlotIndices, int(slotsPerEpoch))
+		if err != nil {
+			errs.Fatalf("Invalid slot indices: %s", err)
+		}
+	}
+	r.slotIndexFilter = make([]bool, slotsPerEpoch)
+	for _, index := range r.slotIndices {
+		r.slotIndexFilter[index] = true
+	}
+	r.healthWeights, err = parseHealthWeights(cmd.HealthWeights)
+	if err != nil {
+		errs.Fatalf("Invalid health weights: %s", err)
+	}
+	if err := checkLabelNames(cmd.Label); err != nil {
+		errs.Fatalf("Invalid labels: %s", err)
+	}
+	if cmd.ExcludeValidators != "" {
+		r.excluded, err = readValidatorIndices(cmd.ExcludeValidators)
+		if err != nil {
+			errs.Fatalf("Invalid excluded validators: %s", err)
+		}
+	}
+	if cmd.IncludingProposers != "" {
+		r.includingProposers, err = readValidatorIndices(cmd.IncludingProposers)
+		if err != nil {
+			errs.Fatalf("Invalid including proposers: %s", err)
+		}
+	}
+	if cmd.DebugDump != "" {
+		r.dump, err = newDebugDump(cmd.DebugDump)
+		if err != nil {
+			errs.Fatalf("Failed to start debug dump: %s", err)
+		}
+	}
+	if cmd.Depositors != "" {
+		depositors, err := readValidatorLabels(cmd.Depositors, 2, 1)
+		if err != nil {
+			errs.Fatalf("Invalid depositors: %s", err)
+		}
+		r.entities = newValidatorGroups(depositors)
+	}
+	if cmd.WatchValidators != "" {
+		r.watched, err = readValidatorIndices(cmd.WatchValidators)
+		if err != nil {
+			errs.Fatalf("Invalid watched validators: %s", err)
+		}
+	}
+	// Networks without sync committees may lack their parameters, which
+	// are only required for sync validators.
+	r.syncModel, r.syncModelErr = newSyncRewardModel(spec)
+	if cmd.SyncValidators != "" {
+		r.syncValidators, err = readValidatorIndices(cmd.SyncValidators)
+		if err != nil {
+			errs.Fatalf("Invalid sync validators: %s", err)
+		}
+		if r.syncModelErr != nil {
+			errs.Fatal(r.syncModelErr)
+		}
+	}
+	if cmd.RankValidators != "" {
+		ranked, err := readValidatorIndices(cmd.RankValidators)
+		if err != nil {
+			errs.Fatalf("Invalid ranked validators: %s", err)
+		}
+		r.performance = newValidatorPerformance(ranked)
+	}
+	if cmd.FlakyValidators != "" {
+		checked, err := readValidatorIndices(cmd.FlakyValidators)
+		if err != nil {
+			errs.Fatalf("Invalid flaky validators: %s", err)
+		}
+		r.flakiness = newFlakinessDetector(checked)
+	}
+	if (cmd.DelayValidators == "") != (cmd.DelayDistribution == "") {
+		errs.Fatal("--delay-validators and --delay-distribution must be given together")
+	}
+	if cmd.DelayValidators != "" {
+		set, err := readValidatorIndices(cmd.DelayValidators)
+		if err != nil {
+			errs.Fatalf("Invalid delay validators: %s", err)
+		}
+		r.delays = newDelayDistribution(set)
+	}
+	if cmd.Locations != "" {
+		regionLabels, err := readValidatorLabels(cmd.Locations, 1)
+		if err != nil {
+			errs.Fatalf("Invalid locations: %s", err)
+		}
+		asnLabels, err := readValidatorLabels(cmd.Locations, 2)
+		if err != nil {
+			errs.Fatalf("Invalid locations: %s", err)
+		}
+		r.regions = newValidatorGroups(regionLabels)
+		if len(asnLabels) > 0 {
+			r.asns = newValidatorGroups(asnLabels)
+		}
+	}
+
+	if cmd.Cohorts || len(cmd.WithdrawalAddress) > 0 {
+		err := sched.Do(categoryDuties, func(node *nodeClient) error {
+			var err error
+			r.allValidators, err = node.AllValidators(ctx, "head")
+			return err
+		})
+		if err != nil {
+			errs.Fatalf("Failed to fetch validators: %s", err)
+		}
+	}
+	if cmd.Cohorts {
+		epochsPerMonth := phase0.Epoch(30 * 24 * time.Hour / (time.Duration(r.secondsPerSlot) * time.Second * time.Duration(slotsPerEpoch)))
+		r.cohorts = newValidatorGroups(cohortLabels(r.allValidators, fromEpoch, epochsPerMonth))
+	}
+	if len(cmd.WithdrawalAddress) > 0 {
+		labels, unattributed, err := withdrawalLabels(r.allValidators, cmd.WithdrawalAddress)
+		if err != nil {
+			errs.Fatalf("Invalid withdrawal address: %s", err)
+		}
+		if unattributed > 0 {
+			log.Printf("%d validators have BLS withdrawal credentials, so they can't be attributed to an address", unattributed)
+		}
+		r.unattributedWithdrawals = unattributed
+		found := map[string]int{}
+		for _, address := range labels {
+			found[address]++
+		}
+		for _, address := range cmd.WithdrawalAddress {
+			address = strings.ToLower(address)
+			if found[address] == 0 {
+				log.Printf("No validators withdraw to %s", address)
+			} else {
+				log.Printf("Found %d validators withdrawing to %s", found[address], address)
+			}
+		}
+		r.withdrawals = newValidatorGroups(labels)
+	}
+
+	// Look up cached epochs. Per-validator outputs need every duty, which
+	// isn't cached, so they always compute the whole range.
+	if cmd.CacheDir != "" {
+		if err := checkCacheChain(cmd.CacheDir, spec["CONFIG_NAME"], r.genesis); err != nil {
+			errs.Fatal(err)
+		}
+		switch {
+		case cmd.Sample != "":
+			log.Printf("Not using cached epochs, since sampled runs don't compute every epoch")
+		case cmd.RawAttestations != "" || r.entities != nil || r.regions != nil || r.cohorts != nil || r.withdrawals != nil || r.performance != nil || r.flakiness != nil || r.delays != nil || len(r.watched) > 0 || len(r.syncValidators) > 0:
+			log.Printf("Not using cached epochs, since per-validator outputs aren't cached")
+		case len(cmd.Relay) > 0:
+			log.Printf("Not using cached epochs, since relay data isn't cached")
+		case cmd.RawBlocks != "":
+			log.Printf("Not using cached epochs, since block records need every block")
+		case r.dump != nil:
+			log.Printf("Not using cached epochs, since debug dumps need every duty")
+		default:
+			r.cache, err = newEpochCache(cmd.CacheDir, spec["CONFIG_NAME"], cmd.Committees, r.slotIndices,
+				sortedIndices(r.excluded), sortedIndices(r.includingProposers), cmd.ExcludeReorgedDuties)
+			if err != nil {
+				errs.Fatal(err)
+			}
+			r.cachedResults, r.anchors, err = r.cache.Lookup(ctx, sched, fromEpoch, toEpoch)
+			if err != nil {
+				errs.Fatal(err)
+			}
+		}
+	}
+	// Blocks are cached whether or not epochs are, since they're the bulk of
+	// what a run downloads.
+	if cmd.CacheDir != "" {
+		r.blocksCache, err = newBlockCache(cmd.CacheDir, spec["CONFIG_NAME"])
+		if err != nil {
+			errs.Fatal(err)
+		}
+	}
+	if cmd.BlockExport != "" {
+		r.export, err = openBlockExport(cmd.BlockExport, spec)
+		if err != nil {
+			errs.Fatal(err)
+		}
+	}
+	// Compute the epochs from the first to the last one that isn't cached.
+	// If all of them are, computeTo ends up before computeFrom.
+	r.computeFrom, r.computeTo = fromEpoch, toEpoch
+	for ; r.computeFrom <= toEpoch; r.computeFrom++ {
+		if _, ok := r.cachedResults[r.computeFrom]; !ok {
+			break
+		}
+	}
+	for ; r.computeTo > r.computeFrom; r.computeTo-- {
+		if _, ok := r.cachedResults[r.computeTo]; !ok {
+			break
+		}
+	}
+	if len(r.cachedResults) > 0 {
+		log.Printf("Found %d cached epochs", len(r.cachedResults))
+	}
+	r.fromSlot = phase0.Slot(r.computeFrom) * slotsPerEpoch
+	r.toSlot = phase0.Slot(r.computeTo+1)*slotsPerEpoch - 1
+
+	// Compute the epochs in clusters, which is a single one unless the
+	// range is sampled.
+	if r.computeFrom <= r.computeTo {
+		r.clusters = []epochCluster{{r.computeFrom, r.computeTo}}
+	}
+	if cmd.Sample != "" {
+		fraction, err := parseSampleFraction(cmd.Sample)
+		if err != nil {
+			errs.Fatalf("Invalid sample %q: %s", cmd.Sample, err)
+		}
+		seed := cmd.SampleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		r.sample = &SampleStats{Fraction: fraction, Seed: seed, ClusterEpochs: sampleClusterEpochs}
+		r.clusters, r.sample.TotalClusters = sampleClusters(r.computeFrom, r.computeTo, fraction, rand.New(rand.NewSource(seed)))
+		r.sample.Clusters = len(r.clusters)
+		log.Printf("Sampling %d of %d clusters of %d epochs (seed %d)", r.sample.Clusters, r.sample.TotalClusters, sampleClusterEpochs, seed)
+	}
+	r.sampled = map[phase0.Epoch]bool{}
+	for _, c := range r.clusters {
+		for epoch := c.From; epoch <= c.To; epoch++ {
+			r.sampled[epoch] = true
+		}
+	}
+}
+
+// slotTime returns the time a slot starts at.
+func (r *runState) slotTime(slot phase0.Slot) time.Time {
+	return r.genesis.GenesisTime.Add(time.Duration(slot) * time.Duration(r.secondsPerSlot) * time.Second).UTC()
+}
+
+// fetch fetches the blocks of the sampled epochs along with their inclusion
+// windows, while fetchCommittees fetches their duties, then resolves double
+// blocks and leaves out the epochs of slots that failed to fetch.
+func (r *runState) fetch() {
+	cmd, ctx, errs, sched, progress := r.cmd, r.ctx, r.errs, r.sched, r.progress
+	start := time.Now()
+	// Don't wait for blocks that don't exist yet. Duties whose inclusion
+	// window extends past the head are reported as pending instead.
+	lastSlot := inclusionWindowEnd(r.toSlot)
+	if lastSlot > r.head {
+		lastSlot = r.head
+	}
+	if r.computeFrom > r.computeTo {
+		lastSlot = r.toSlot // Everything is cached.
+	}
+	// Fetch the blocks of each cluster along with its inclusion window,
+	// merging clusters whose windows overlap into a single span of slots.
+	var spans [][2]phase0.Slot
+	for _, c := range r.clusters {
+		from, to := phase0.Slot(c.From)*slotsPerEpoch, inclusionWindowEnd(phase0.Slot(c.To+1)*slotsPerEpoch-1)
+		if to > lastSlot {
+			to = lastSlot
+		}
+		if from > to {
+			continue
+		}
+		if n := len(spans); n > 0 && from <= spans[n-1][1]+1 {
+			spans[n-1][1] = to
+		} else {
+			spans = append(spans, [2]phase0.Slot{from, to})
+		}
+	}
+	store := newBlockStore(spans, int64(cmd.MaxBlockMemory)<<20)
+	var g multierror.Group
+	inRange, lookahead := 0, 0
+	for _, span := range spans {
+		for slot := span[0]; slot <= span[1]; slot++ {
+			if r.sampled[phase0.Epoch(slot/slotsPerEpoch)] {
+				inRange++
+			} else {
+				lookahead++
+			}
+		}
+	}
+	progress.StartFetch(sched, inRange, lookahead)
+	r.status.SetPhase("Fetching blocks")
+	r.status.SetProgress(progress)
+
+	// Decode blocks in a separate pool, so that slow decoding of large
+	// blocks doesn't hold on to the nodes' concurrency slots.
+	blockData := make(chan fetchedBlock, runtime.NumCPU())
+	var decoders multierror.Group
+	for i := 0; i < runtime.NumCPU(); i++ {
+		decoders.Go(func() (err error) {
+			// Keep draining after an error, so that fetches don't block.
+			for fetched := range blockData {
+				if err != nil {
+					continue
+				}
+				var bl blockWithRoot
+				bl, err = decodeBlock(fetched.Data)
+				if err != nil {
+					continue
+				}
+				if bl.Message.Slot != fetched.Slot {
+					log.Printf("Leaving out slot %d, since the block served for it is at slot %d", fetched.Slot, bl.Message.Slot)
+					store.Fail(fetched.Slot)
+					continue
+				}
+				if err = r.blocksCache.Put(bl.Root, fetched.Data); err != nil {
+					continue
+				}
+				store.Insert(bl)
+			}
+			return err
+		})
+	}
+	// Blocks not fetched by the deadline, or once the budget is spent, are
+	// left out like failed ones. So that whole epochs are fetched by then,
+	// rather than slots scattered across the range, slots are fetched in
+	// order through a window about as wide as the nodes' concurrency.
+	// Sequential fetches go through the window too, so that each node reads
+	// close to where it left off.
+	fetchCtx := ctx
+	if cmd.Deadline > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithDeadline(ctx, r.startedAt.Add(cmd.Deadline))
+		defer cancel()
+	}
+	var budget *fetchBudget
+	if cmd.MaxRequests > 0 || cmd.MaxBandwidth > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithCancel(fetchCtx)
+		defer cancel()
+		budget = newFetchBudget(r.nodes, cmd.MaxRequests, cmd.MaxBandwidth, cancel)
+		sched.budget = budget
+	}
+	var window chan struct{}
+	width := 0
+	for _, l := range sched.limiters {
+		width += 2 * l.Limit()
+	}
+	if cmd.Deadline > 0 || budget != nil || cmd.FetchOrder == "sequential" {
+		window = make(chan struct{}, width)
+	}
+	// Sequential fetches take turns at runs of slots short enough that
+	// every node has a run within the window.
+	var turns *rotation
+	runLength := phase0.Slot(width / (2 * len(r.nodes)))
+	if runLength > slotsPerEpoch {
+		runLength = slotsPerEpoch
+	}
+	if runLength < 1 {
+		runLength = 1
+	}
+	export := r.export
+	if cmd.FetchOrder == "sequential" && export == nil {
+		turns = sched.Rotation()
+	}
+	g.Go(func() error {
+		preferred := -1
+		for _, span := range spans {
+			for slot := span[0]; slot <= span[1]; slot++ {
+				s := slot
+				if turns != nil && (preferred < 0 || s%runLength == 0) {
+					preferred = turns.Next()
+				}
+				node := preferred
+				if window != nil {
+					window <- struct{}{}
+				}
+				g.Go(func() error {
+					if window != nil {
+						defer func() { <-window }()
+					}
+					var data []byte
+					var err error
+					if export != nil {
+						data, err = export.Block(s)
+					} else {
+						data, err = fetchBlock(fetchCtx, sched, r.blocksCache, s, node)
+					}
+					progress.FetchDone(r.sampled[phase0.Epoch(s/slotsPerEpoch)], err == nil && data == nil)
+					if err != nil {
+						// Leave the affected epochs out rather than abort the run.
+						if export != nil {
+							log.Printf("Failed to read block at slot %d from %s: %s", s, cmd.BlockExport, err)
+						} else if fetchCtx.Err() == nil {
+							log.Printf("Failed to fetch block at slot %d from any node: %s", s, err)
+						}
+						store.Fail(s)
+						return nil
+					}
+					if data != nil {
+						blockData <- fetchedBlock{s, data}
+					}
+					return nil
+				})
+			}
+		}
+		return nil
+	})
+	r.fetchCommittees(&g)
+	err := g.Wait().ErrorOrNil()
+	close(blockData)
+	if decodeErr := decoders.Wait().ErrorOrNil(); err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		errs.Fatal(err)
+	}
+	r.fetched = store.Len()
+	detail := fmt.Sprintf("%d blocks", r.fetched)
+	if hits := r.blocksCache.Hits(); hits > 0 {
+		detail += fmt.Sprintf(" (%d cached)", hits)
+	}
+	progress.Finish(phaseFetch, detail)
+	if evictions := store.Evictions(); evictions > 0 {
+		log.Printf("Evicted %d blocks to stay within %d MiB, leaving their epochs out", evictions, cmd.MaxBlockMemory)
+	}
+	r.doubles, err = resolveDoubleBlocks(ctx, sched, store, spans, cmd.DoubleBlocks)
+	if err != nil {
+		errs.Fatal(err)
+	}
+	progress.Finish(phaseCommittees, "")
+	if r.autoConcurrency {
+		for i, l := range sched.limiters {
+			log.Printf("Node %s settled at concurrency %d", r.nodes[i].Name(), l.Limit())
+		}
+	}
+	r.timings.FetchBlocks = time.Since(start)
+
+	// Leave out the epochs whose inclusion window has a slot that failed to
+	// fetch or was evicted, and split the spans around such slots, so that
+	// the chain is only followed across slots that were fetched.
+	failedSlots := store.Missing()
+	r.deadlineExceeded = errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+	if r.deadlineExceeded {
+		log.Printf("Stopped fetching at the deadline of %s, with %d slots left", cmd.Deadline, len(failedSlots))
+	}
+	r.budgetSpent = budget.Spent()
+	if r.budgetSpent != "" {
+		log.Printf("Stopped fetching at the cap of %s, with %d slots left", r.budgetSpent, len(failedSlots))
+	}
+	r.incomplete = map[phase0.Epoch][]phase0.Slot{}
+	for _, slot := range failedSlots {
+		first := inclusionWindowStart(slot)
+		for epoch := phase0.Epoch(first / slotsPerEpoch); epoch <= phase0.Epoch(slot/slotsPerEpoch); epoch++ {
+			if r.sampled[epoch] {
+				r.incomplete[epoch] = append(r.incomplete[epoch], slot)
+			}
+		}
+	}
+	for epoch := range r.incomplete {
+		delete(r.sampled, epoch)
+	}
+	r.spans = splitSpansAt(spans, failedSlots)
+	r.store = store
+}
+
+// fetchCommittees fetches, in g along with the blocks, the proposer duties
+// of the sampled epochs, and their committees, sync committees and relayed
+// payloads where the flags need them.
+func (r *runState) fetchCommittees(g *multierror.Group) {
+	cmd, ctx, sched, progress := r.cmd, r.ctx, r.sched, r.progress
+	// Committees are only needed to tell which validator is at each position.
+	needCommittees := len(r.excluded) > 0 || len(r.watched) > 0 || r.entities != nil || r.regions != nil || r.cohorts != nil || r.withdrawals != nil || r.performance != nil || r.flakiness != nil || r.delays != nil || r.dump != nil
+	requestsPerEpoch := 1
+	if needCommittees {
+		requestsPerEpoch = 2
+	}
+	// Sync committees only change every period, so they're fetched once for
+	// the first sampled epoch of each. There are none before Altair.
+	syncPeriods := map[phase0.Epoch]phase0.Epoch{}
+	period := r.syncModel.period
+	if len(r.syncValidators) > 0 {
+		for epoch := r.computeFrom; epoch <= r.computeTo; epoch++ {
+			if _, ok := syncPeriods[epoch/period]; !ok && r.sampled[epoch] && epoch >= altairForkEpoch {
+				syncPeriods[epoch/period] = epoch
+			}
+		}
+	}
+	// Ranges that cross into another period break sync participation down
+	// by period, cached epochs included, and compare their committees.
+	r.firstSyncEpoch = r.fromEpoch
+	if r.firstSyncEpoch < altairForkEpoch {
+		r.firstSyncEpoch = altairForkEpoch
+	}
+	r.trackSyncPeriods = r.syncModelErr == nil && r.toEpoch >= r.firstSyncEpoch && r.toEpoch/period > r.firstSyncEpoch/period
+	if r.trackSyncPeriods {
+		for epoch := r.firstSyncEpoch; epoch <= r.toEpoch; epoch++ {
+			if _, ok := syncPeriods[epoch/period]; !ok {
+				syncPeriods[epoch/period] = epoch
+			}
+		}
+	}
+	progress.Start(phaseCommittees, len(r.sampled)*requestsPerEpoch+len(syncPeriods), "requests")
+	r.proposerDuties = make([][]*apiv1.ProposerDuty, r.computeTo-r.computeFrom+1)
+	for epoch := r.computeFrom; epoch <= r.computeTo; epoch++ {
+		if !r.sampled[epoch] {
+			continue
+		}
+		epoch := epoch
+		g.Go(func() error {
+			return sched.Do(categoryDuties, func(node *nodeClient) error {
+				duties, err := node.ProposerDuties(ctx, epoch)
+				if err != nil {
+					return fmt.Errorf("failed to fetch proposer duties for epoch %d: %w", epoch, err)
+				}
+				r.proposerDuties[epoch-r.computeFrom] = duties
+				progress.Add(phaseCommittees, 1)
+				return nil
+			})
+		})
+	}
+	if needCommittees {
+		fromSlot, toSlot := r.fromSlot, r.toSlot
+		committees := make([][][]phase0.ValidatorIndex, toSlot-fromSlot+1)
+		for i := range committees {
+			committees[i] = make([][]phase0.ValidatorIndex, maxCommitteesPerSlot)
+		}
+		r.committees = committees
+		for epoch := r.computeFrom; epoch <= r.computeTo; epoch++ {
+			if !r.sampled[epoch] {
+				continue
+			}
+			epoch := epoch
+			g.Go(func() error {
+				return sched.Do(categoryCommittees, func(node *nodeClient) error {
+					epochCommittees, err := node.BeaconCommittees(ctx, epoch)
+					if err != nil {
+						return fmt.Errorf("failed to fetch committees for epoch %d: %w", epoch, err)
+					}
+					for _, c := range epochCommittees {
+						if c.Slot < fromSlot || c.Slot > toSlot {
+							continue
+						}
+						if int(c.Index) >= maxCommitteesPerSlot {
+							log.Printf("Ignoring committee %d of slot %d from %s, beyond MAX_COMMITTEES_PER_SLOT of %d", c.Index, c.Slot, node.Name(), maxCommitteesPerSlot)
+							continue
+						}
+						committees[c.Slot-fromSlot][c.Index] = c.Validators
+					}
+					progress.Add(phaseCommittees, 1)
+					return nil
+				})
+			})
+		}
+	}
+	var syncCommitteesMu sync.Mutex
+	r.syncCommittees = map[phase0.Epoch][]phase0.ValidatorIndex{}
+	for period, epoch := range syncPeriods {
+		period, epoch := period, epoch
+		g.Go(func() error {
+			return sched.Do(categoryCommittees, func(node *nodeClient) error {
+				committee, err := node.SyncCommittee(ctx, epoch)
+				if err != nil {
+					return fmt.Errorf("failed to fetch sync committee for epoch %d: %w", epoch, err)
+				}
+				syncCommitteesMu.Lock()
+				r.syncCommittees[period] = committee
+				syncCommitteesMu.Unlock()
+				progress.Add(phaseCommittees, 1)
+				return nil
+			})
+		})
+	}
+	// Relays tell which payloads were built by a builder, by block hash.
+	var deliveredMu sync.Mutex
+	r.delivered = map[phase0.Hash32]string{}
+	for _, address := range cmd.Relay {
+		relay := newRelayClient(address, r.transport)
+		g.Go(func() error {
+			payloads, err := relay.DeliveredPayloads(ctx, r.fromSlot, r.toSlot)
+			if err != nil {
+				return fmt.Errorf("failed to fetch delivered payloads from %s: %w", redactAddress(relay.address), err)
+			}
+			deliveredMu.Lock()
+			defer deliveredMu.Unlock()
+			for _, p := range payloads {
+				hash, err := parseRoot(p.BlockHash)
+				if err != nil {
+					return fmt.Errorf("relay %s: %w", redactAddress(relay.address), err)
+				}
+				r.delivered[phase0.Hash32(hash)] = p.BuilderPubkey
+			}
+			return nil
+		})
+	}
+}
+
+// validatorAt returns the validator at a position of a committee, if
+// committees were fetched.
+func (r *runState) validatorAt(slot phase0.Slot, committee, position int) (phase0.ValidatorIndex, bool) {
+	if r.committees == nil {
+		return 0, false
+	}
+	validators := r.committees[slot-r.fromSlot][committee]
+	if position >= len(validators) {
+		return 0, false
+	}
+	return validators[position], true
+}
+
+// isExcluded reports whether the validator at a position of a committee is
+// one of --exclude-validators.
+func (r *runState) isExcluded(slot phase0.Slot, committee, position int) bool {
+	validator, ok := r.validatorAt(slot, committee, position)
+	return ok && r.excluded[validator]
+}
+
+// dedupe indexes the canonical chain of the fetched blocks, discarding
+// orphans, and verifies it where asked to.
+func (r *runState) dedupe() {
+	cmd, ctx, errs := r.cmd, r.ctx, r.errs
+	r.status.SetPhase("Processing blocks")
+	start := time.Now()
+	r.progress.Start(phaseDedupe, r.fetched, "blocks")
+	r.chain = r.store.Canonical(r.spans)
+	blocks := r.chain.Blocks()
+	r.blocks = blocks
+	r.progress.Add(phaseDedupe, r.fetched)
+	r.progress.Finish(phaseDedupe, fmt.Sprintf("%d orphaned", r.fetched-len(blocks)))
+	r.timings.SortBlocks = time.Since(start)
+	if r.verifier != nil {
+		checked, err := verifyWithClient(ctx, r.verifier, blocks, rand.New(rand.NewSource(time.Now().UnixNano())))
+		if err != nil {
+			errs.Fatalf("Cross-client verification failed: %s", err)
+		}
+		log.Printf("Verified the attestations of %d blocks against %s", checked, r.verifier.Name())
+	}
+
+	// Verify the chain the stats are computed from, once orphans, which
+	// nodes may serve for slots that were reorged, are discarded.
+	if cmd.VerifyBlocks || cmd.VerifySignatures {
+		for _, spanBlocks := range splitSpans(blocks, r.spans) {
+			if err := verifyChain(spanBlocks); err != nil {
+				errs.Fatalf("Block verification failed: %s", err)
+			}
+			if len(spanBlocks) > 0 {
+				if err := verifyCheckpoint(ctx, r.sched, spanBlocks[len(spanBlocks)-1]); err != nil {
+					errs.Fatalf("Block verification failed: %s", err)
+				}
+			}
+		}
+		if cmd.VerifySignatures {
+			if err := verifyProposerSignatures(ctx, r.sched, blocks, r.spec, r.genesis.GenesisValidatorsRoot); err != nil {
+				errs.Fatalf("Block verification failed: %s", err)
+			}
+		}
+		log.Printf("Verified %d blocks", len(blocks))
+	}
+}
+
+// compute resolves every duty of the sampled epochs from the canonical
+// chain into the stats of its epoch, slot, client and validator groups.
+func (r *runState) compute() {
+	cmd, ctx, errs := r.cmd, r.ctx, r.errs
+	chain, blocks := r.chain, r.blocks
+	fromSlot, toSlot, head := r.fromSlot, r.toSlot, r.head
+	slotIndices, slotIndexFilter, committeeFilter := r.slotIndices, r.slotIndexFilter, r.committeeFilter
+
+	// Organize participations.
+	start := time.Now()
+	slotCommitteeParticipations := newSlotParticipations(int(toSlot - fromSlot + 1))
+	results := make([]epochResult, r.computeTo-r.computeFrom+1)
+	for i := range results {
+		results[i].Epoch = EpochStats{Epoch: r.computeFrom + phase0.Epoch(i), SkippedSlots: []SkippedSlot{}}
+		results[i].Slots = make([]AttestationStats, slotsPerEpoch)
+	}
+	duplicates := duplicateTracker{}
+	for _, bl := range blocks {
+		if bl.Message.Slot >= fromSlot && bl.Message.Slot <= toSlot {
+			results[(bl.Message.Slot-fromSlot)/slotsPerEpoch].Blocks++
+		}
+		if malformed := addParticipations(slotCommitteeParticipations, fromSlot, bl); malformed > 0 {
+			log.Printf("Ignoring %d malformed attestations of block %s at slot %d, of committees beyond MAX_COMMITTEES_PER_SLOT of %d or with the wrong number of attesters", malformed, bl.Root, bl.Message.Slot, maxCommitteesPerSlot)
+		}
+		// Duplicates count toward the epoch of their attestations, within
+		// the same filters as duties.
+		for _, att := range bl.Message.Body.Attestations {
+			slot := att.Data.Slot
+			if slot < fromSlot || slot > toSlot ||
+				(len(slotIndices) > 0 && !slotIndexFilter[slot%slotsPerEpoch]) ||
+				(len(cmd.Committees) > 0 && (int(att.Data.Index) >= maxCommitteesPerSlot || !committeeFilter[att.Data.Index])) {
+				continue
+			}
+			results[(slot-fromSlot)/slotsPerEpoch].Epoch.Duplicates.add(duplicates.Add(att))
+		}
+	}
+	for i, committees := range slotCommitteeParticipations {
+		stats := &results[phase0.Slot(i)/slotsPerEpoch].Epoch.Committees
+		perSlot := 0
+		for index, participations := range committees {
+			if participations != nil {
+				stats.add(len(participations))
+				perSlot = index + 1
+			}
+		}
+		if perSlot > stats.PerSlot {
+			stats.PerSlot = perSlot
+		}
+	}
+	r.slotCommitteeParticipations, r.results = slotCommitteeParticipations, results
+	r.timings.OrganizeParticipations = time.Since(start)
+
+	reorgs, orphans, err := findReorgs(ctx, r.sched, chain, func(slot phase0.Slot) bool {
+		return r.sampled[phase0.Epoch(slot/slotsPerEpoch)]
+	})
+	if err != nil {
+		errs.Fatal(err)
+	}
+	var reorgedSlots []phase0.Slot
+	for _, reorg := range reorgs {
+		result := &results[(reorg.Slot-fromSlot)/slotsPerEpoch]
+		result.Reorgs = append(result.Reorgs, reorg)
+		reorgedSlots = append(reorgedSlots, reorg.Slot)
+	}
+	sort.Slice(reorgedSlots, func(i, j int) bool { return reorgedSlots[i] < reorgedSlots[j] })
+	// Index the votes of orphaned blocks, both those behind reorgs and those
+	// fetched by slot but left off the canonical chain, to tell the misses
+	// that only orphans included.
+	orphanVotes := map[committeeKey][]bool{}
+	seenOrphans := map[phase0.Root]bool{}
+	for _, bl := range append(orphans, r.store.Blocks()...) {
+		if seenOrphans[bl.Root] || chain.IsCanonical(bl.Root) {
+			continue
+		}
+		seenOrphans[bl.Root] = true
+		for _, att := range bl.Message.Body.Attestations {
+			key := committeeKey{att.Data.Slot, int(att.Data.Index)}
+			if orphanVotes[key] == nil {
+				orphanVotes[key] = make([]bool, att.AggregationBits.Len())
+			}
+			for _, i := range att.AggregationBits.BitIndices() {
+				if i < len(orphanVotes[key]) {
+					orphanVotes[key][i] = true
+				}
+			}
+		}
+	}
+	// reorgAffected reports whether a reorged block falls within the
+	// inclusion window of attestations at a slot.
+	reorgAffected := func(slot phase0.Slot) bool {
+		i := sort.Search(len(reorgedSlots), func(i int) bool { return reorgedSlots[i] > slot })
+		return i < len(reorgedSlots) && reorgedSlots[i] <= inclusionWindowEnd(slot)
+	}
+
+	// Calculate participation.
+	start = time.Now()
+	clients := make([]map[string]*ClientStats, len(results))
+	for i := range clients {
+		clients[i] = map[string]*ClientStats{}
+	}
+	// clientAt returns the stats of a client within the epoch of a slot.
+	clientAt := func(slot phase0.Slot, client string) *ClientStats {
+		epochClients := clients[(slot-fromSlot)/slotsPerEpoch]
+		if epochClients[client] == nil {
+			epochClients[client] = &ClientStats{Client: client}
+		}
+		return epochClients[client]
+	}
+	for _, bl := range blocks {
+		if bl.Message.Slot >= fromSlot && bl.Message.Slot <= toSlot {
+			clientAt(bl.Message.Slot, graffitiClient(bl.Message.Body.Graffiti)).Blocks++
+		}
+	}
+	r.report = Report{
+		SchemaVersion: schemaVersion,
+		Slots:         make([]AttestationStats, slotsPerEpoch),
+		Metadata: RunMetadata{
+			Tool:      toolInfo(),
+			Network:   r.spec["CONFIG_NAME"],
+			StartTime: r.slotTime(phase0.Slot(r.fromEpoch) * slotsPerEpoch),
+			EndTime:   r.slotTime(phase0.Slot(r.toEpoch+1) * slotsPerEpoch),
+			StartedAt: r.startedAt,
+
+			EffectivenessModels: []string{cmd.EffectivenessModel},
+			HealthWeights:       r.healthWeights,
+			BlockExport:         r.export != nil,
+			Labels:              cmd.Label,
+		},
+	}
+	report := &r.report
+	if cmd.EffectivenessModel == "all" {
+		report.Metadata.EffectivenessModels = effectivenessModels
+	}
+	for _, address := range cmd.Relay {
+		report.Metadata.Relays = append(report.Metadata.Relays, redactAddress(newRelayClient(address, nil).address))
+	}
+	var check *selfCheck
+	if cmd.SelfCheck {
+		var candidates []committeeKey
+		for i, committees := range slotCommitteeParticipations {
+			slot := fromSlot + phase0.Slot(i)
+			if !r.sampled[phase0.Epoch(slot/slotsPerEpoch)] || (len(slotIndices) > 0 && !slotIndexFilter[slot%slotsPerEpoch]) {
+				continue
+			}
+			for index, participations := range committees {
+				if participations != nil && (len(cmd.Committees) == 0 || committeeFilter[index]) {
+					candidates = append(candidates, committeeKey{slot, index})
+				}
+			}
+		}
+		check = newSelfCheck(candidates, rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	// includedByProposers reports whether the block at an inclusion slot
+	// is by one of --including-proposers. Without a canonical block there,
+	// there's no proposer to credit.
+	includedByProposers := func(slot phase0.Slot) bool {
+		bl, ok := chain.Block(slot)
+		return ok && r.includingProposers[bl.Message.ProposerIndex]
+	}
+	r.progress.Start(phaseCompute, len(slotCommitteeParticipations), "slots")
+	for i, committees := range slotCommitteeParticipations {
+		r.progress.Add(phaseCompute, 1)
+		slot := fromSlot + phase0.Slot(i)
+		slotIndex := slot % slotsPerEpoch
+		if !r.sampled[phase0.Epoch(slot/slotsPerEpoch)] {
+			continue
+		}
+		if len(slotIndices) > 0 && !slotIndexFilter[slotIndex] {
+			continue
+		}
+		next, ok := chain.Next(slot)
+		if !ok {
+			continue
+		}
+		earliestInclusionSlot := next.Message.Slot
+		nextClient := clientAt(slot, graffitiClient(next.Message.Body.Graffiti))
+		result := &results[(slot-fromSlot)/slotsPerEpoch]
+		missed := &result.Missed
+		// Duties of reorg-affected slots are tallied apart, without crediting
+		// their inclusions to clients or blaming their misses on anyone.
+		reorged := cmd.ExcludeReorgedDuties && reorgAffected(slot)
+		if reorged {
+			nextClient, missed = &ClientStats{}, &MissedStats{}
+		}
+
+		windowOpen := inclusionWindowEnd(slot) > head
+
+		for index, participations := range committees {
+			if len(cmd.Committees) > 0 && !committeeFilter[index] {
+				continue
+			}
+			for position, p := range participations {
+				validator, known := r.validatorAt(slot, index, position)
+				if known && r.excluded[validator] {
+					r.dump.Duty(slot, index, position, validator, known, resolutionExcluded, p, AttestationStats{})
+					continue
+				}
+				var duty AttestationStats
+				var resolution string
+				orphanedOnly := false
+				switch {
+				case p.Included && r.includingProposers != nil && !includedByProposers(p.InclusionSlot):
+					// Counted like a miss, but not blamed on anyone.
+					resolution = resolutionOtherProposer
+					duty.Assigned = 1
+					duty.RewardWeight = attestationRewardWeight(slot, 0)
+				case p.Included:
+					resolution = resolutionIncluded
+					duty = includedDuty(chain, slot, earliestInclusionSlot, p.InclusionSlot)
+					nextClient.Attestations++
+					if duty.InclusionDelay == 1 {
+						nextClient.IncludedAtDelay1++
+					}
+				case windowOpen:
+					resolution = resolutionPending
+					duty.Pending = 1
+				default:
+					duty.Assigned = 1
+					duty.RewardWeight = attestationRewardWeight(slot, 0)
+					// Blame the miss on the attester if there was a block to include
+					// the attestation at delay 1, otherwise on the proposer or network.
+					if _, ok := chain.Block(slot + 1); ok {
+						resolution = resolutionMissedAttester
+						missed.AttesterFault++
+					} else {
+						resolution = resolutionMissedProposer
+						missed.ProposerFault++
+					}
+					votes := orphanVotes[committeeKey{slot, index}]
+					orphanedOnly = position < len(votes) && votes[position]
+				}
+				r.dump.Duty(slot, index, position, validator, known, resolution, p, duty)
+				check.Add(slot, index, duty)
+				if reorged {
+					result.Epoch.ReorgAffected.add(duty)
+					continue
+				}
+				if orphanedOnly {
+					result.Epoch.OrphanedOnly++
+				}
+				result.Epoch.Attestations.add(duty)
+				result.Slots[slotIndex].add(duty)
+				r.delays.Add(validator, known, duty)
+				if known {
+					r.entities.Add(validator, duty)
+					r.regions.Add(validator, duty)
+					r.asns.Add(validator, duty)
+					r.cohorts.Add(validator, duty)
+					r.withdrawals.Add(validator, duty)
+					r.performance.Add(validator, duty)
+					r.flakiness.Add(validator, slot, duty)
+				}
+			}
+		}
+	}
+	if err := check.Verify(blocks, head, r.isExcluded, r.includingProposers); err != nil {
+		errs.Fatal(err)
+	}
+	if cmd.SelfCheck {
+		log.Printf("Self-check matched the stats of %d committees", check.Committees())
+	}
+	if r.entities != nil || r.regions != nil || r.cohorts != nil || r.withdrawals != nil {
+		// Duties only come up while validators are active, so count the
+		// epochs each group was active in to measure its duties against.
+		var activeEpochs []phase0.Epoch
+		for epoch := r.computeFrom; epoch <= r.computeTo && phase0.Slot(epoch)*slotsPerEpoch <= head; epoch++ {
+			if r.sampled[epoch] {
+				activeEpochs = append(activeEpochs, epoch)
+			}
+		}
+		validators := r.allValidators
+		if validators == nil {
+			labelled := map[phase0.ValidatorIndex]bool{}
+			var indices []phase0.ValidatorIndex
+			for _, index := range append(r.entities.Validators(), r.regions.Validators()...) {
+				if !labelled[index] {
+					labelled[index] = true
+					indices = append(indices, index)
+				}
+			}
+			err := r.sched.Do(categoryDuties, func(node *nodeClient) error {
+				var err error
+				validators, err = node.Validators(ctx, "head", indices)
+				return err
+			})
+			if err != nil {
+				errs.Fatalf("Failed to fetch validators: %s", err)
+			}
+		}
+		r.entities.AddActivity(validators, activeEpochs)
+		r.regions.AddActivity(validators, activeEpochs)
+		r.asns.AddActivity(validators, activeEpochs)
+		r.cohorts.AddActivity(validators, activeEpochs)
+		r.withdrawals.AddActivity(validators, activeEpochs)
+	}
+	report.Entities = r.entities.List()
+	if len(r.watched) > 0 {
+		report.SlashableVotes, err = scanSlashableVotes(blocks, r.watched, fromSlot, toSlot, r.validatorAt)
+		if err != nil {
+			errs.Fatal(err)
+		}
+	}
+	if len(r.syncValidators) > 0 {
+		report.SyncCommittee = syncCommitteeStats(
+			blocks, r.syncCommittees, r.syncValidators, r.syncModel,
+			func(epoch phase0.Epoch) int { return results[epoch-r.computeFrom].Epoch.Committees.Validators },
+			func(slot phase0.Slot) bool {
+				return slot >= fromSlot && slot <= toSlot && r.sampled[phase0.Epoch(slot/slotsPerEpoch)]
+			},
+		)
+	}
+	report.Regions = r.regions.List()
+	report.ASNs = r.asns.List()
+	report.Cohorts = r.cohorts.List()
+	report.Withdrawals = r.withdrawals.List()
+	report.UnattributedWithdrawals = r.unattributedWithdrawals
+	report.Percentiles = r.performance.Stats()
+	report.Flakiness = r.flakiness.Stats()
+	for i, epochClients := range clients {
+		for _, stats := range epochClients {
+			results[i].Clients = append(results[i].Clients, *stats)
+		}
+		sort.Slice(results[i].Clients, func(j, k int) bool { return results[i].Clients[j].Client < results[i].Clients[k].Client })
+	}
+	r.timings.CalculateParticipation = time.Since(start)
+	r.progress.Finish(phaseCompute, "")
+}
+
+// assemble completes the report with the computed and cached epochs, the
+// blocks of proposer duties, and the comparisons the flags ask for.
+func (r *runState) assemble() {
+	cmd, ctx, errs := r.cmd, r.ctx, r.errs
+	chain, fromSlot, head := r.chain, r.fromSlot, r.head
+	fromEpoch, toEpoch, computeFrom, computeTo := r.fromEpoch, r.toEpoch, r.computeFrom, r.computeTo
+	report, results := &r.report, r.results
+
+	report.Timings = r.timings
+	for _, n := range r.nodes {
+		report.Nodes = append(report.Nodes, NodeStats{
+			Address:  redactAddress(n.address),
+			Name:     n.name,
+			Requests: int(n.requests.Load()),
+			Bytes:    n.bytes.Load(),
+		})
+		report.Timings.DownloadedBytes += n.bytes.Load()
+	}
+	// Cross-check canonical blocks against proposer duties.
+	r.leftBehind = leftBehindBySlot(fromSlot, r.slotCommitteeParticipations)
+	r.pickups = pickupsBySlot(fromSlot, r.slotCommitteeParticipations, chain)
+	builders := builderStats{}
+	for i, duties := range r.proposerDuties {
+		stats := &results[i].Epoch
+		stats.Duties = len(duties)
+		for _, duty := range duties {
+			// Nothing is proposed at genesis, and blocks can't be yet past the head.
+			if duty.Slot == 0 || duty.Slot > head {
+				stats.Duties--
+				continue
+			}
+			bl, ok := chain.Block(duty.Slot)
+			if !ok {
+				stats.SkippedSlots = append(stats.SkippedSlots, SkippedSlot{duty.Slot, duty.ValidatorIndex})
+				continue
+			}
+			stats.Blocks++
+			stats.Packing.addBlock(len(bl.Message.Body.Attestations), r.leftBehind[duty.Slot-fromSlot], r.pickups[duty.Slot-fromSlot])
+			stats.Execution.add(bl.Execution)
+			if aggregate := bl.Message.Body.SyncAggregate; aggregate != nil {
+				stats.SyncAggregates.add(SyncAggregateStats{
+					Positions:    int(aggregate.SyncCommitteeBits.Len()),
+					Participants: int(aggregate.SyncCommitteeBits.Count()),
+				})
+			}
+			if builder, ok := r.delivered[bl.Execution.BlockHash]; ok {
+				stats.Execution.addRelayed(builder)
+				builders.Add(builder, bl.Execution)
+			}
+			if bl.Message.ProposerIndex != duty.ValidatorIndex {
+				log.Printf(
+					"Block at slot %d was proposed by %d, but the duty belongs to %d",
+					duty.Slot, bl.Message.ProposerIndex, duty.ValidatorIndex,
+				)
+			}
+		}
+	}
+	report.Builders = builders.List()
+
+	rangeEnd := phase0.Slot(toEpoch+1)*slotsPerEpoch - 1
+	report.Scope = Scope{
+		FromEpoch:              fromEpoch,
+		ToEpoch:                toEpoch,
+		Committees:             cmd.Committees,
+		SlotIndices:            r.slotIndices,
+		ExcludedValidators:     len(r.excluded),
+		IncludingProposers:     len(r.includingProposers),
+		ExcludingReorgedDuties: cmd.ExcludeReorgedDuties,
+		Partial:                head < inclusionWindowEnd(rangeEnd),
+		HeadSlot:               head,
+		Trimmed:                fromEpoch > r.requestedFromEpoch,
+		RequestedFromEpoch:     r.requestedFromEpoch,
+		DeadlineExceeded:       r.deadlineExceeded,
+		BudgetSpent:            r.budgetSpent,
+	}
+
+	// Assemble the report from computed and cached epochs.
+	report.Reorgs = []Reorg{}
+	for epoch := fromEpoch; epoch <= toEpoch; epoch++ {
+		computed := epoch >= computeFrom && epoch <= computeTo
+		if slots, ok := r.incomplete[epoch]; ok {
+			report.Incomplete = append(report.Incomplete, IncompleteEpoch{epoch, slots})
+			continue
+		}
+		if computed && !r.sampled[epoch] {
+			continue
+		}
+		first, last := phase0.Slot(epoch)*slotsPerEpoch, phase0.Slot(epoch+1)*slotsPerEpoch-1
+		if last > head {
+			last = head
+		}
+		if first <= last {
+			report.Scope.Slots += int(last - first + 1)
+		}
+		if !computed {
+			report.addEpoch(r.cachedResults[epoch])
+			continue
+		}
+		result := results[epoch-computeFrom]
+		if anchor, ok := r.anchors[epoch]; ok {
+			if err := r.cache.Put(epoch, anchor, result); err != nil {
+				errs.Fatal(err)
+			}
+		}
+		report.addEpoch(result)
+	}
+	// Siblings attesters voted for may also have been served by a node.
+	report.DoubleBlocks = r.doubles
+	served := map[string]bool{}
+	for _, d := range r.doubles {
+		served[d.OrphanedRoot] = true
+	}
+	for _, d := range reorgDoubleBlocks(report.Reorgs) {
+		if !served[d.OrphanedRoot] {
+			report.DoubleBlocks = append(report.DoubleBlocks, d)
+		}
+	}
+	sort.Slice(report.DoubleBlocks, func(i, j int) bool { return report.DoubleBlocks[i].Slot < report.DoubleBlocks[j].Slot })
+	report.scoreHealth()
+	report.Transition = newTransitionStats(report.Slots)
+	report.Forks = newForkStats(forkSchedule(r.spec), report.Epochs)
+	// Stream the epochs in order, now that they're scored and annotated.
+	for i, j := 0, 0; i < len(report.Epochs) || j < len(report.Incomplete); {
+		if j == len(report.Incomplete) || (i < len(report.Epochs) && report.Epochs[i].Epoch < report.Incomplete[j].Epoch) {
+			e := report.Epochs[i]
+			r.events.Epoch(e, e.Epoch < computeFrom || e.Epoch > computeTo)
+			i++
+		} else {
+			r.events.Incomplete(report.Incomplete[j])
+			j++
+		}
+	}
+	if r.baseline != nil {
+		report.Baseline = compareBaseline(cmd.Baseline, report.Epochs, r.baseline)
+	}
+	if r.trackSyncPeriods {
+		report.SyncPeriods = syncPeriodStats(report.Epochs, r.syncCommittees, r.syncModel.period, r.firstSyncEpoch, toEpoch)
+	}
+	if cmd.Temporal {
+		report.HoursOfDay, report.DaysOfWeek = newTimeBuckets(report.Epochs, func(epoch phase0.Epoch) time.Time {
+			return r.slotTime(phase0.Slot(epoch) * slotsPerEpoch)
+		})
+	}
+	if sample := r.sample; sample != nil {
+		var clusterStats []AttestationStats
+		for _, c := range r.clusters {
+			var stats AttestationStats
+			for epoch := c.From; epoch <= c.To; epoch++ {
+				if r.sampled[epoch] {
+					stats.add(results[epoch-computeFrom].Epoch.Attestations)
+					sample.Epochs++
+				}
+			}
+			if stats.Assigned > 0 {
+				clusterStats = append(clusterStats, stats)
+			}
+		}
+		sample.Rate = estimateRate(clusterStats, sample.TotalClusters)
+		report.Sample = sample
+	}
+
+	if cmd.VerifyState {
+		r.status.SetPhase("Verifying states")
+		if len(cmd.Committees) > 0 || len(r.slotIndices) > 0 || len(r.excluded) > 0 {
+			log.Printf("Skipping state verification, since states can't be restricted to committees, slot indices or validators")
+		} else {
+			var err error
+			report.StateChecks, err = verifyStates(ctx, r.sched, report.Epochs)
+			if err != nil {
+				errs.Fatalf("State verification failed: %s", err)
+			}
+		}
+	}
+}
+
+// render writes the report, and every other output the flags ask for.
+func (r *runState) render() {
+	cmd, errs, progress := r.cmd, r.errs, r.progress
+	report, fromSlot, toSlot := &r.report, r.fromSlot, r.toSlot
+
+	// The report is written to stdout once the progress display is closed,
+	// so that they don't draw over each other on a terminal.
+	progress.Start(phaseRender, 0, "outputs")
+	var out bytes.Buffer
+	var err error
+	switch {
+	case cmd.JSON == "-":
+		err = report.WriteJSON(&out)
+	case cmd.Template != "":
+		err = report.RenderTemplate(&out, cmd.Template)
+	default:
+		err = report.Render(&out)
+	}
+	if err != nil {
+		errs.Fatal(err)
+	}
+	progress.Add(phaseRender, 1)
+	var artifacts []string
+	if cmd.RawAttestations != "" {
+		err := writeRawAttestations(
+			cmd.RawAttestations,
+			fromSlot,
+			r.slotCommitteeParticipations,
+			r.chain.Root,
+			func(slot phase0.Slot, index, position int) bool {
+				return r.sampled[phase0.Epoch(slot/slotsPerEpoch)] &&
+					(len(r.slotIndices) == 0 || r.slotIndexFilter[slot%slotsPerEpoch]) &&
+					(len(cmd.Committees) == 0 || r.committeeFilter[index]) &&
+					!r.isExcluded(slot, index, position)
+			},
+		)
+		if err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.RawAttestations)
+	}
+	if r.delays != nil {
+		if err := r.delays.Write(cmd.DelayDistribution); err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.DelayDistribution)
+	}
+	if cmd.RawBlocks != "" {
+		err := writeRawBlocks(cmd.RawBlocks, r.blocks, fromSlot, r.leftBehind, r.pickups, func(slot phase0.Slot) bool {
+			return slot >= fromSlot && slot <= toSlot && r.sampled[phase0.Epoch(slot/slotsPerEpoch)]
+		})
+		if err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.RawBlocks)
+	}
+	if r.dump != nil {
+		files, err := r.dump.Close(r.blocks, fromSlot, r.slotCommitteeParticipations, r.chain.Root)
+		if err != nil {
+			errs.Fatalf("Failed to write debug dump: %s", err)
+		}
+		artifacts = append(artifacts, files...)
+	}
+	if cmd.Textfile != "" {
+		if err := report.WriteTextfile(cmd.Textfile); err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.Textfile)
+	}
+	if cmd.JSON != "" && cmd.JSON != "-" {
+		f, err := os.Create(cmd.JSON)
+		if err != nil {
+			errs.Fatal(err)
+		}
+		if err := report.WriteJSON(f); err != nil {
+			errs.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.JSON)
+	}
+	if errs != nil {
+		var incomplete []phase0.Epoch
+		for _, e := range report.Incomplete {
+			incomplete = append(incomplete, e.Epoch)
+		}
+		errs.SetIncomplete(incomplete)
+		if err := errs.Write(nil); err != nil {
+			errs.Fatal(err)
+		}
+		artifacts = append(artifacts, cmd.ErrorReport)
+	}
+
+	if cmd.Manifest != "" {
+		manifest := Manifest{
+			SchemaVersion: schemaVersion,
+			Tool:          report.Metadata.Tool,
+			Network:       report.Metadata.Network,
+			FromEpoch:     r.fromEpoch,
+			ToEpoch:       r.toEpoch,
+			StartedAt:     r.startedAt,
+			FinishedAt:    time.Now(),
+			Timings:       report.Timings,
+			Artifacts:     []Artifact{},
+		}
+		for _, n := range r.nodes {
+			manifest.Nodes = append(manifest.Nodes, ManifestNode{redactAddress(n.address), n.name, n.version})
+		}
+		for _, path := range artifacts {
+			artifact, err := newArtifact(path)
+			if err != nil {
+				errs.Fatal(err)
+			}
+			manifest.Artifacts = append(manifest.Artifacts, artifact)
+		}
+		if err := manifest.Write(cmd.Manifest); err != nil {
+			errs.Fatal(err)
+		}
+		progress.Add(phaseRender, 1)
+	}
+	if cmd.Bundle != "" {
+		var reportJSON, reportText bytes.Buffer
+		if err := report.WriteJSON(&reportJSON); err != nil {
+			errs.Fatal(err)
+		}
+		if err := report.Render(&reportText); err != nil {
+			errs.Fatal(err)
+		}
+		files := []bundleFile{
+			{Name: "report.json", Data: reportJSON.Bytes()},
+			{Name: "report.txt", Data: reportText.Bytes()},
+		}
+		if cmd.Manifest != "" {
+			artifacts = append(artifacts, cmd.Manifest)
+		}
+		for _, path := range artifacts {
+			files = append(files, bundleFile{Name: filepath.Base(path), Path: path})
+		}
+		if err := writeBundle(cmd.Bundle, files); err != nil {
+			errs.Fatalf("Failed to write bundle: %s", err)
+		}
+		progress.Add(phaseRender, 1)
+	}
+	progress.Add(phaseRender, len(artifacts))
+	progress.Finish(phaseRender, "")
+	progress.Close()
+	r.events.Done(len(report.Incomplete))
+	if _, err := os.Stdout.Write(out.Bytes()); err != nil {
+		errs.Fatal(err)
+	}
+}
+
+// fetchedBlock is the undecoded data of a block, and the slot it was
+// fetched for, which a misbehaving node may not have served.
+type fetchedBlock struct {
+	Slot phase0.Slot
+	Data []byte
+}
+
+// fetchBlock fetches the data of the block at a slot, trying each node that
+// serves it in turn, starting from the preferred node if it does, or else a
+// random one, for up to fetchRounds rounds. It returns nil data if the slot is
+// empty, and an error if no node serves it. With a cache, the header of the
+// slot is fetched first, and the block is only fetched if the cache doesn't
+// have it.
+func fetchBlock(ctx context.Context, sched *scheduler, cache *blockCache, slot phase0.Slot, preferred int) ([]byte, error) {
+	var serving []int
+	first := -1
+	for i, n := range sched.nodes {
+		if n.historyStart <= slot {
+			if i == preferred {
+				first = len(serving)
+			}
+			serving = append(serving, i)
+		}
+	}
+	nodes := len(serving)
+	if nodes == 0 {
+		err := fmt.Errorf("no node serves slot %d, since their history starts later", slot)
+		sched.errors.SlotFailed(slot, 0, err)
+		return nil, err
+	}
+	if first < 0 {
+		first = sched.Pick(serving)
+	}
+	var err error
+	for attempt := 0; attempt < fetchRounds*nodes; attempt++ {
+		if ctx.Err() != nil {
+			// Past the deadline, which isn't the slot's failure.
+			return nil, ctx.Err()
+		}
+		if attempt > 0 {
+			sched.errors.Retried()
+			if attempt%nodes == 0 {
+				time.Sleep(fetchRetryDelay)
+			}
+		}
+		var data []byte
+		err = sched.DoOn(serving[(first+attempt)%nodes], categoryBlocks, func(node *nodeClient) error {
+			if cache != nil {
+				// The header names the block, which may be cached already.
+				header, err := node.BlockHeader(ctx, fmt.Sprint(slot))
+				if err != nil || header == nil {
+					return err
+				}
+				if d, ok := cache.Get(header.Root); ok {
+					data = d
+					return nil
+				}
+			}
+			d, err := node.SignedBeaconBlockData(ctx, fmt.Sprint(slot))
+			if err != nil && strings.Contains(err.Error(), "Could not find requested block") {
+				return nil
+			}
+			data = d
+			return err
+		})
+		if err == nil {
+			return data, nil
+		}
+	}
+	sched.errors.SlotFailed(slot, fetchRounds*nodes, err)
+	return nil, err
+}
+
+// includedDuty returns the stats of a duty at a slot included at a later
+// one, given the earliest slot a block could have included it at.
+func includedDuty(chain *chainIndex, slot, earliestInclusionSlot, inclusionSlot phase0.Slot) AttestationStats {
+	distance := inclusionSlot - slot
+	return AttestationStats{
+		Assigned:       1,
+		Executed:       1,
+		InclusionDelay: int(1 + inclusionSlot - earliestInclusionSlot),
+		RawDelay:       int(distance),
+		EffectiveDelay: 1 + chain.BlocksBetween(earliestInclusionSlot, inclusionSlot),
+		InclusionScore: float64(earliestInclusionSlot-slot) / float64(distance),
+		RewardWeight:   attestationRewardWeight(slot, distance),
+	}
+}
+
+// newSlotParticipations returns room for the participation of every
+// committee of a number of slots.
+func newSlotParticipations(slots int) [][]CommitteeParticipation {
+	slotCommitteeParticipations := make([][]CommitteeParticipation, slots)
+	for i := range slotCommitteeParticipations {
+		slotCommitteeParticipations[i] = make([]CommitteeParticipation, maxCommitteesPerSlot)
+	}
+	return slotCommitteeParticipations
+}
+
+// addParticipations records the first inclusion of each attester in the
+// attestations of a block, for the slots from fromSlot on that
+// slotCommitteeParticipations covers. Malformed attestations, of committees
+// beyond the slot's or with more attesters than an earlier attestation of
+// the committee, are skipped, and the number of them returned.
+func addParticipations(slotCommitteeParticipations [][]CommitteeParticipation, fromSlot phase0.Slot, bl blockWithRoot) int {
+	malformed := 0
+	for _, att := range bl.Message.Body.Attestations {
+		if att.Data.Slot < fromSlot || att.Data.Slot-fromSlot >= phase0.Slot(len(slotCommitteeParticipations)) {
+			continue
+		}
+		slotIndex := att.Data.Slot - fromSlot
+		if int(att.Data.Index) >= len(slotCommitteeParticipations[slotIndex]) {
+			malformed++
+			continue
+		}
+		participations := slotCommitteeParticipations[slotIndex][att.Data.Index]
+		if participations == nil {
+			participations = make(CommitteeParticipation, att.AggregationBits.Len())
+		} else if att.AggregationBits.Len() != uint64(len(participations)) {
+			malformed++
+			continue
+		}
+		for _, i := range att.AggregationBits.BitIndices() {
+			if !participations[i].Included {
+				participations[i].Included = true
+				participations[i].InclusionSlot = bl.Message.Slot
+			}
+		}
+		slotCommitteeParticipations[slotIndex][att.Data.Index] = participations
+	}
+	return malformed
+}
+
+// parseEpochRange parses an epoch, a range of epochs such as 1000-1010, or
+// an open-ended range such as 1000-, for which open is set and to is unset.
+func parseEpochRange(s string) (from, to phase0.Epoch, open bool, err error) {
+	parseEpoch := func(part, what string) (phase0.Epoch, error) {
+		if part == "" {
+			return 0, fmt.Errorf("missing the %s", what)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't an epoch number", part)
+		}
+		return phase0.Epoch(n), nil
+	}
+	if strings.HasPrefix(s, "-") {
+		return 0, 0, false, errors.New("epochs can't be negative")
+	}
+	parts := strings.Split(s, "-")
+	switch len(parts) {
+	case 1:
+		from, err = parseEpoch(parts[0], "epoch")
+		return from, from, false, err
+	case 2:
+		if from, err = parseEpoch(parts[0], "first epoch"); err != nil {
+			return 0, 0, false, err
+		}
+		if parts[1] == "" {
+			return from, 0, true, nil
+		}
+		if to, err = parseEpoch(parts[1], "last epoch"); err != nil {
+			return 0, 0, false, err
+		}
+		if from > to {
+			return 0, 0, false, fmt.Errorf("the range ends at epoch %d, before it starts at epoch %d", to, from)
+		}
+		return from, to, false, nil
+	default:
+		return 0, 0, false, fmt.Errorf("%q isn't an epoch or a range of epochs such as 1000-1010 or 1000-", s)
+	}
+}
+
+// resolveEpochRange parses epochs with parseEpochRange, ending open-ended
+// ranges at the latest epoch the node has finalized.
+func resolveEpochRange(ctx context.Context, node *nodeClient, s string) (from, to phase0.Epoch, err error) {
+	from, to, open, err := parseEpochRange(s)
+	if err != nil || !open {
+		return from, to, err
+	}
+	finality, err := node.Finality(ctx, "head")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch the finalized epoch from %s: %w", node.Name(), err)
+	}
+	if to = finality.Finalized.Epoch; from > to {
+		return 0, 0, fmt.Errorf("epoch %d isn't finalized yet (the latest finalized epoch is %d)", from, to)
+	}
+	return from, to, nil
+}
+
+// sortedIndices returns the validator indices of a set, sorted.
+func sortedIndices(set map[phase0.ValidatorIndex]bool) []int {
+	indices := make([]int, 0, len(set))
+	for index := range set {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// readValidatorIndices reads a file of validator indices, one per line.
+// Blank lines and lines starting with '#' are ignored.
+func readValidatorIndices(path string) (map[phase0.ValidatorIndex]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	indices := map[phase0.ValidatorIndex]bool{}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		index, err := strconv.ParseUint(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: malformed validator index %q", i+1, line)
+		}
+		indices[phase0.ValidatorIndex(index)] = true
+	}
+	return indices, nil
+}
+
+// decodeBlock decodes a block response and computes its root, keeping only
+// what the stats need. Blocks of other forks are held in Bellatrix's shape.
+// Those before it lack the fields their fork didn't have yet: phase0 blocks
+// have no sync aggregate, and neither they nor Altair blocks have an
+// execution payload. Capella and Deneb blocks leave their withdrawals, BLS
+// to execution changes and blob commitments out, since nothing uses them.
+func decodeBlock(data []byte) (blockWithRoot, error) {
+	bl, err := decodeSignedBeaconBlock(data)
+	if err != nil {
+		return blockWithRoot{}, err
+	}
+	var root phase0.Root
+	switch bl.Version {
+	case spec.DataVersionPhase0:
+		root, err = bl.Phase0.Message.HashTreeRoot()
+		m, body := bl.Phase0.Message, bl.Phase0.Message.Body
+		bl.Bellatrix = &bellatrix.SignedBeaconBlock{
+			Message: &bellatrix.BeaconBlock{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &bellatrix.BeaconBlockBody{
+					RANDAOReveal:      body.RANDAOReveal,
+					ETH1Data:          body.ETH1Data,
+					Graffiti:          body.Graffiti,
+					ProposerSlashings: body.ProposerSlashings,
+					AttesterSlashings: body.AttesterSlashings,
+					Attestations:      body.Attestations,
+					Deposits:          body.Deposits,
+					VoluntaryExits:    body.VoluntaryExits,
+				},
+			},
+			Signature: bl.Phase0.Signature,
+		}
+	case spec.DataVersionAltair:
+		root, err = bl.Altair.Message.HashTreeRoot()
+		m, body := bl.Altair.Message, bl.Altair.Message.Body
+		bl.Bellatrix = &bellatrix.SignedBeaconBlock{
+			Message: &bellatrix.BeaconBlock{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &bellatrix.BeaconBlockBody{
+					RANDAOReveal:      body.RANDAOReveal,
+					ETH1Data:          body.ETH1Data,
+					Graffiti:          body.Graffiti,
+					ProposerSlashings: body.ProposerSlashings,
+					AttesterSlashings: body.AttesterSlashings,
+					Attestations:      body.Attestations,
+					Deposits:          body.Deposits,
+					VoluntaryExits:    body.VoluntaryExits,
+					SyncAggregate:     body.SyncAggregate,
+				},
+			},
+			Signature: bl.Altair.Signature,
+		}
+	case spec.DataVersionBellatrix:
+		root, err = bl.Bellatrix.Message.HashTreeRoot()
+	case spec.DataVersionCapella:
+		root, err = bl.Capella.Message.HashTreeRoot()
+		m, body := bl.Capella.Message, bl.Capella.Message.Body
+		var payload *bellatrix.ExecutionPayload
+		if p := body.ExecutionPayload; p != nil {
+			payload = &bellatrix.ExecutionPayload{
+				ParentHash:    p.ParentHash,
+				FeeRecipient:  p.FeeRecipient,
+				StateRoot:     p.StateRoot,
+				ReceiptsRoot:  p.ReceiptsRoot,
+				LogsBloom:     p.LogsBloom,
+				PrevRandao:    p.PrevRandao,
+				BlockNumber:   p.BlockNumber,
+				GasLimit:      p.GasLimit,
+				GasUsed:       p.GasUsed,
+				Timestamp:     p.Timestamp,
+				ExtraData:     p.ExtraData,
+				BaseFeePerGas: p.BaseFeePerGas,
+				BlockHash:     p.BlockHash,
+				Transactions:  p.Transactions,
+			}
+		}
+		bl.Bellatrix = &bellatrix.SignedBeaconBlock{
+			Message: &bellatrix.BeaconBlock{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &bellatrix.BeaconBlockBody{
+					RANDAOReveal:      body.RANDAOReveal,
+					ETH1Data:          body.ETH1Data,
+					Graffiti:          body.Graffiti,
+					ProposerSlashings: body.ProposerSlashings,
+					AttesterSlashings: body.AttesterSlashings,
+					Attestations:      body.Attestations,
+					Deposits:          body.Deposits,
+					VoluntaryExits:    body.VoluntaryExits,
+					SyncAggregate:     body.SyncAggregate,
+					ExecutionPayload:  payload,
+				},
+			},
+			Signature: bl.Capella.Signature,
+		}
+	case spec.DataVersionDeneb:
+		root, err = bl.Deneb.Message.HashTreeRoot()
+		m, body := bl.Deneb.Message, bl.Deneb.Message.Body
+		var payload *bellatrix.ExecutionPayload
+		if p := body.ExecutionPayload; p != nil {
+			payload = &bellatrix.ExecutionPayload{
+				ParentHash:   p.ParentHash,
+				FeeRecipient: p.FeeRecipient,
+				StateRoot:    p.StateRoot,
+				ReceiptsRoot: p.ReceiptsRoot,
+				LogsBloom:    p.LogsBloom,
+				PrevRandao:   p.PrevRandao,
+				BlockNumber:  p.BlockNumber,
+				GasLimit:     p.GasLimit,
+				GasUsed:      p.GasUsed,
+				Timestamp:    p.Timestamp,
+				ExtraData:    p.ExtraData,
+				BlockHash:    p.BlockHash,
+				Transactions: p.Transactions,
+			}
+			// Bellatrix holds the base fee as little-endian bytes.
+			if p.BaseFeePerGas != nil {
+				be := p.BaseFeePerGas.Bytes32()
+				for i, b := range be {
+					payload.BaseFeePerGas[len(be)-1-i] = b
+				}
+			}
+		}
+		bl.Bellatrix = &bellatrix.SignedBeaconBlock{
+			Message: &bellatrix.BeaconBlock{
+				Slot:          m.Slot,
+				ProposerIndex: m.ProposerIndex,
+				ParentRoot:    m.ParentRoot,
+				StateRoot:     m.StateRoot,
+				Body: &bellatrix.BeaconBlockBody{
+					RANDAOReveal:      body.RANDAOReveal,
+					ETH1Data:          body.ETH1Data,
+					Graffiti:          body.Graffiti,
+					ProposerSlashings: body.ProposerSlashings,
+					AttesterSlashings: body.AttesterSlashings,
+					Attestations:      body.Attestations,
+					Deposits:          body.Deposits,
+					VoluntaryExits:    body.VoluntaryExits,
+					SyncAggregate:     body.SyncAggregate,
+					ExecutionPayload:  payload,
+				},
+			},
+			Signature: bl.Deneb.Signature,
+		}
+	default:
+		return blockWithRoot{}, fmt.Errorf("%s blocks aren't supported yet", bl.Version)
+	}
+	if err != nil {
+		return blockWithRoot{}, err
+	}
+	execution := newExecutionSummary(bl.Bellatrix.Message.Body.ExecutionPayload)
+	if bl.Deneb != nil {
+		execution = execution.withBlobGas(bl.Deneb.Message.Body.ExecutionPayload)
+	}
+	bl.Bellatrix.Message.Body.ExecutionPayload = nil // Free some memory. We only need the summary.
+	return blockWithRoot{root, execution, bl.Bellatrix}, nil
+}
+
+// splitSpansAt splits spans of slots around the given sorted slots, which
+// are left out.
+func splitSpansAt(spans [][2]phase0.Slot, slots []phase0.Slot) [][2]phase0.Slot {
+	var split [][2]phase0.Slot
+	for _, span := range spans {
+		for _, slot := range slots {
+			if slot < span[0] || slot > span[1] {
+				continue
+			}
+			if slot > span[0] {
+				split = append(split, [2]phase0.Slot{span[0], slot - 1})
+			}
+			span[0] = slot + 1
+		}
+		if span[0] <= span[1] {
+			split = append(split, span)
+		}
+	}
+	return split
+}
+
+// splitSpans splits sorted blocks by the spans of slots they were fetched from.
+func splitSpans(blocks []blockWithRoot, spans [][2]phase0.Slot) [][]blockWithRoot {
+	split := make([][]blockWithRoot, len(spans))
+	for i, span := range spans {
+		for len(blocks) > 0 && blocks[0].Message.Slot <= span[1] {
+			if blocks[0].Message.Slot >= span[0] {
+				split[i] = append(split[i], blocks[0])
+			}
+			blocks = blocks[1:]
+		}
+	}
+	return split
+}
+
+// parseIndexRanges parses a comma-separated list of indices and inclusive
+// ranges, such as "0-3,31", where each index must be below n.
+func parseIndexRanges(s string, n int) ([]int, error) {
+	var indices []int
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("malformed range %q", part)
+		}
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("malformed index %q", bounds[0])
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed index %q", bounds[1])
+			}
+		}
+		if from < 0 || to >= n || from > to {
+			return nil, fmt.Errorf("range %q is outside of 0-%d", part, n-1)
+		}
+		for i := from; i <= to; i++ {
+			indices = append(indices, i)
+		}
+	}
+	return indices, nil
+}
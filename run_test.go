@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+func TestParseEpochRange(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to phase0.Epoch
+		open     bool
+		err      bool
+	}{
+		{in: "1000", from: 1000, to: 1000},
+		{in: "0", from: 0, to: 0},
+		{in: "1000-1010", from: 1000, to: 1010},
+		{in: "1000-1000", from: 1000, to: 1000},
+		{in: "1000-", from: 1000, open: true},
+		{in: "18446744073709551615", from: 18446744073709551615, to: 18446744073709551615},
+		{in: "1010-1000", err: true},
+		{in: "18446744073709551616", err: true},
+		{in: "1000-18446744073709551616", err: true},
+		{in: "-1", err: true},
+		{in: "-1000-1010", err: true},
+		{in: "1000--1010", err: true},
+		{in: "-", err: true},
+		{in: "", err: true},
+		{in: "1000-1010-1020", err: true},
+		{in: "1e3", err: true},
+		{in: " 1000", err: true},
+		{in: "latest", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			from, to, open, err := parseEpochRange(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %d-%d (open: %t), want an error", from, to, open)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if from != tt.from || to != tt.to || open != tt.open {
+				t.Errorf("got %d-%d (open: %t), want %d-%d (open: %t)", from, to, open, tt.from, tt.to, tt.open)
+			}
+		})
+	}
+}
+
+func TestParseIndexRanges(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want []int
+		err  bool
+	}{
+		{in: "0", n: 32, want: []int{0}},
+		{in: "31", n: 32, want: []int{31}},
+		{in: "0-3", n: 32, want: []int{0, 1, 2, 3}},
+		{in: "0-3,31", n: 32, want: []int{0, 1, 2, 3, 31}},
+		{in: "5-5", n: 32, want: []int{5}},
+		{in: "0,1,31", n: 32, want: []int{0, 1, 31}},
+		{in: "32", n: 32, err: true},
+		{in: "30-32", n: 32, err: true},
+		{in: "3-0", n: 32, err: true},
+		{in: "-1", n: 32, err: true},
+		{in: "-1-3", n: 32, err: true},
+		{in: "0--3", n: 32, err: true},
+		{in: "9223372036854775808", n: 32, err: true},
+		{in: "0-9223372036854775808", n: 32, err: true},
+		{in: "", n: 32, err: true},
+		{in: "0,,1", n: 32, err: true},
+		{in: "0,", n: 32, err: true},
+		{in: "0-", n: 32, err: true},
+		{in: "0-1-2", n: 32, err: true},
+		{in: "a", n: 32, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseIndexRanges(tt.in, tt.n)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
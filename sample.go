@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// sampleClusterEpochs is the number of consecutive epochs sampled together.
+// Each cluster needs the blocks of an extra inclusion window, so longer
+// clusters waste fewer fetches, while shorter ones spread the sample wider.
+const sampleClusterEpochs = 4
+
+// epochCluster is a run of consecutive epochs whose blocks are fetched
+// together, along with the inclusion window that follows them.
+type epochCluster struct {
+	From, To phase0.Epoch
+}
+
+// parseSampleFraction parses a sample size given as a percentage, such as
+// "10%", or as a fraction, such as "0.1".
+func parseSampleFraction(s string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, scale = strings.TrimSuffix(s, "%"), 100
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(f > 0 && f/scale <= 1) { // Also rejects NaN.
+		return 0, fmt.Errorf("expected a percentage or fraction such as 10%% or 0.1")
+	}
+	return f / scale, nil
+}
+
+// sampleClusters splits the range into clusters and picks a random fraction
+// of them, at least one, sorted by epoch.
+func sampleClusters(fromEpoch, toEpoch phase0.Epoch, fraction float64, rng *rand.Rand) (sampled []epochCluster, total int) {
+	var clusters []epochCluster
+	for epoch := fromEpoch; epoch <= toEpoch; epoch += sampleClusterEpochs {
+		c := epochCluster{epoch, epoch + sampleClusterEpochs - 1}
+		if c.To > toEpoch {
+			c.To = toEpoch
+		}
+		clusters = append(clusters, c)
+	}
+	n := int(math.Ceil(fraction * float64(len(clusters))))
+	rng.Shuffle(len(clusters), func(i, j int) { clusters[i], clusters[j] = clusters[j], clusters[i] })
+	sampled = clusters[:n]
+	sort.Slice(sampled, func(i, j int) bool { return sampled[i].From < sampled[j].From })
+	return sampled, len(clusters)
+}
+
+// SampleStats describes a sampled run, and estimates the attestation rate
+// of the whole range from it.
+type SampleStats struct {
+	Fraction      float64 `json:"fraction"`
+	Seed          int64   `json:"seed"`
+	ClusterEpochs int     `json:"cluster_epochs"`
+	Clusters      int     `json:"clusters"`
+	TotalClusters int     `json:"total_clusters"`
+	Epochs        int     `json:"epochs"` // Sampled epochs.
+
+	// Rate estimates the attestation rate with a 95% confidence interval.
+	Rate Estimate `json:"rate"`
+}
+
+// Estimate is a percentage estimated from a sample. The confidence interval
+// is unknown if fewer than two clusters were sampled.
+type Estimate struct {
+	Value float64  `json:"value"`
+	Low   *float64 `json:"low,omitempty"`
+	High  *float64 `json:"high,omitempty"`
+}
+
+// estimateRate estimates the attestation rate as a ratio estimator over the
+// sampled clusters, with the variance corrected for sampling a finite
+// population of clusters without replacement.
+func estimateRate(clusters []AttestationStats, totalClusters int) Estimate {
+	var executed, assigned float64
+	for _, c := range clusters {
+		executed += float64(c.Executed)
+		assigned += float64(c.Assigned)
+	}
+	rate := executed / assigned
+	n := float64(len(clusters))
+	if n < 2 {
+		return Estimate{Value: rate * 100}
+	}
+	var residuals float64
+	for _, c := range clusters {
+		r := float64(c.Executed) - rate*float64(c.Assigned)
+		residuals += r * r
+	}
+	meanAssigned := assigned / n
+	variance := (1 - n/float64(totalClusters)) / (n * meanAssigned * meanAssigned) * residuals / (n - 1)
+	margin := tQuantile975(len(clusters)-1) * math.Sqrt(variance)
+	low, high := math.Max(rate-margin, 0)*100, math.Min(rate+margin, 1)*100
+	return Estimate{Value: rate * 100, Low: &low, High: &high}
+}
+
+// tQuantile975 returns the 97.5th percentile of Student's t-distribution with
+// the given degrees of freedom, for two-sided 95% confidence intervals that
+// hold up with few sampled clusters.
+func tQuantile975(df int) float64 {
+	quantiles := [...]float64{
+		12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+	}
+	if df <= len(quantiles) {
+		return quantiles[df-1]
+	}
+	return 1.96
+}
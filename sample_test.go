@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseSampleFraction(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		err  bool
+	}{
+		{in: "10%", want: 0.1},
+		{in: "100%", want: 1},
+		{in: "0.5%", want: 0.005},
+		{in: "0.1", want: 0.1},
+		{in: "1", want: 1},
+		{in: "0%", err: true},
+		{in: "0", err: true},
+		{in: "-10%", err: true},
+		{in: "-0.1", err: true},
+		{in: "101%", err: true},
+		{in: "1.5", err: true},
+		{in: "1e400", err: true},
+		{in: "Inf", err: true},
+		{in: "NaN", err: true},
+		{in: "NaN%", err: true},
+		{in: "%", err: true},
+		{in: "", err: true},
+		{in: "10%%", err: true},
+		{in: "ten%", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSampleFraction(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateRate(t *testing.T) {
+	tests := []struct {
+		name          string
+		clusters      []AttestationStats
+		totalClusters int
+		value         float64
+		low, high     float64 // Both 0 if the interval is unknown.
+	}{
+		{
+			name:          "single cluster",
+			clusters:      []AttestationStats{{Assigned: 100, Executed: 90}},
+			totalClusters: 10,
+			value:         90,
+		},
+		{
+			name:          "ratio over clusters of different sizes",
+			clusters:      []AttestationStats{{Assigned: 100, Executed: 100}, {Assigned: 300, Executed: 0}},
+			totalClusters: 2,
+			value:         25,
+			low:           25,
+			high:          25,
+		},
+		{
+			name:          "same rate in every cluster",
+			clusters:      []AttestationStats{{Assigned: 100, Executed: 90}, {Assigned: 200, Executed: 180}, {Assigned: 50, Executed: 45}},
+			totalClusters: 100,
+			value:         90,
+			low:           90,
+			high:          90,
+		},
+		{
+			name:          "interval",
+			clusters:      []AttestationStats{{Assigned: 100, Executed: 90}, {Assigned: 100, Executed: 80}},
+			totalClusters: 10,
+			value:         85,
+			// margin = 12.706 * sqrt((1-2/10) / (2*100*100) * 50 / 1)
+			low:  (0.85 - 12.706*math.Sqrt(0.002)) * 100,
+			high: 100,
+		},
+		{
+			name:          "whole population",
+			clusters:      []AttestationStats{{Assigned: 100, Executed: 90}, {Assigned: 100, Executed: 80}},
+			totalClusters: 2,
+			value:         85,
+			low:           85,
+			high:          85,
+		},
+		{
+			name:          "interval clamped at 0",
+			clusters:      []AttestationStats{{Assigned: 1000, Executed: 0}, {Assigned: 1000, Executed: 20}},
+			totalClusters: 10,
+			value:         1,
+			low:           0,
+			high:          (0.01 + 12.706*math.Sqrt(8e-5)) * 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := estimateRate(tt.clusters, tt.totalClusters)
+			if math.Abs(got.Value-tt.value) > 1e-9 {
+				t.Errorf("got value %v, want %v", got.Value, tt.value)
+			}
+			if tt.low == 0 && tt.high == 0 {
+				if got.Low != nil || got.High != nil {
+					t.Errorf("got an interval, want none")
+				}
+				return
+			}
+			if got.Low == nil || got.High == nil {
+				t.Fatalf("got no interval, want %v-%v", tt.low, tt.high)
+			}
+			if math.Abs(*got.Low-tt.low) > 1e-9 || math.Abs(*got.High-tt.high) > 1e-9 {
+				t.Errorf("got interval %v-%v, want %v-%v", *got.Low, *got.High, tt.low, tt.high)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// requestCategory is the kind of data a request fetches, which decides its
+// priority and share of each node's concurrency.
+type requestCategory int
+
+const (
+	// categoryBlocks is block fetching, the critical path of every run.
+	categoryBlocks requestCategory = iota
+	categoryDuties
+	categoryCommittees
+
+	numRequestCategories
+)
+
+// categoryShares caps the share of a node's concurrency limit that each
+// category may take up, so that auxiliary requests can't crowd out blocks.
+var categoryShares = [numRequestCategories]float64{
+	categoryBlocks:     1,
+	categoryDuties:     0.25,
+	categoryCommittees: 0.25,
+}
+
+// scheduler runs the requests of a run on its nodes, bounding each node's
+// concurrency with its limiter. Nodes are chosen in proportion to their
+// weights.
+type scheduler struct {
+	nodes    []*nodeClient
+	all      []int // Indices of all nodes.
+	limiters []*limiter
+	errors   *errorReporter
+
+	// budget is checked after every request, whatever it fetches, since
+	// all of them count towards the caps.
+	budget *fetchBudget
+}
+
+func newScheduler(nodes []*nodeClient, newLimiter func(*nodeClient) *limiter, errors *errorReporter) *scheduler {
+	s := &scheduler{nodes: nodes, limiters: make([]*limiter, len(nodes)), errors: errors}
+	for i, node := range nodes {
+		s.all = append(s.all, i)
+		s.limiters[i] = newLimiter(node)
+	}
+	return s
+}
+
+// Load returns the number of requests in flight and waiting to be admitted,
+// across the nodes.
+func (s *scheduler) Load() (inflight, waiting int) {
+	for _, l := range s.limiters {
+		i, w := l.Load()
+		inflight += i
+		waiting += w
+	}
+	return inflight, waiting
+}
+
+// Do runs a request on a randomly chosen node.
+func (s *scheduler) Do(category requestCategory, request func(*nodeClient) error) error {
+	return s.DoOn(s.all[s.Pick(s.all)], category, request)
+}
+
+// Pick chooses one of the candidate node indices at random, weighted by the
+// nodes' weights, and returns its position among the candidates.
+func (s *scheduler) Pick(candidates []int) int {
+	var total float64
+	for _, i := range candidates {
+		total += s.nodes[i].weight
+	}
+	x := rand.Float64() * total
+	for k, i := range candidates {
+		if x -= s.nodes[i].weight; x < 0 {
+			return k
+		}
+	}
+	return len(candidates) - 1
+}
+
+// rotation takes turns among the nodes of a scheduler by smooth weighted
+// round-robin, giving each node turns in proportion to its weight, spread
+// evenly rather than in bursts.
+type rotation struct {
+	nodes   []*nodeClient
+	current []float64
+}
+
+// Rotation returns a rotation of the scheduler's nodes.
+func (s *scheduler) Rotation() *rotation {
+	return &rotation{nodes: s.nodes, current: make([]float64, len(s.nodes))}
+}
+
+// Next returns the index of the node whose turn is next.
+func (r *rotation) Next() int {
+	var total float64
+	next := 0
+	for i, n := range r.nodes {
+		r.current[i] += n.weight
+		total += n.weight
+		if r.current[i] > r.current[next] {
+			next = i
+		}
+	}
+	r.current[next] -= total
+	return next
+}
+
+// DoOn runs a request on the i-th node once its limiter admits it.
+func (s *scheduler) DoOn(i int, category requestCategory, request func(*nodeClient) error) error {
+	l := s.limiters[i]
+	l.Acquire(category)
+	start := time.Now()
+	err := request(s.nodes[i])
+	l.Release(category, time.Since(start), err)
+	if err != nil {
+		s.errors.RequestFailed(s.nodes[i], err)
+	}
+	s.budget.Check()
+	return err
+}
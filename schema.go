@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaVersion is embedded in JSON outputs. Bump it whenever a field is
+// removed or changes meaning; adding fields doesn't require a bump.
+const schemaVersion = 1
+
+// schemaCmd prints the JSON Schema of a JSON output.
+type schemaCmd struct {
+	Output string `arg:"" optional:"" enum:"report,manifest,errors" default:"report" help:"Output to describe: report, manifest or errors"`
+}
+
+func (cmd *schemaCmd) Run() error {
+	var v interface{} = Report{}
+	switch cmd.Output {
+	case "manifest":
+		v = Manifest{}
+	case "errors":
+		v = ErrorReport{}
+	}
+	schema := jsonSchema(reflect.TypeOf(v))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = fmt.Sprintf("global-epoch-stats %s, schema version %d", cmd.Output, schemaVersion)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schema)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// jsonSchema derives a JSON Schema from a type the way encoding/json would
+// marshal it, so that the schema can't drift from the outputs. Pointers,
+// slices and maps may be null, as encoding/json marshals them when nil.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(jsonSchema(t.Elem()))
+	case reflect.Slice, reflect.Map:
+		if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+			break
+		}
+		return nullable(nonNullSchema(t))
+	}
+	return nonNullSchema(t)
+}
+
+// nullable allows a schema's type to be null as well.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if t, ok := schema["type"].(string); ok {
+		schema["type"] = []string{t, "null"}
+	}
+	return schema
+}
+
+func nonNullSchema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	// Custom marshalers in go-eth2-client encode roots, keys and signatures as hex strings.
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		schema := map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		}
+		return schema
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// selfCheckCommittees is the number of committees --self-check recomputes.
+const selfCheckCommittees = 256
+
+// committeeKey identifies a committee by slot and index.
+type committeeKey struct {
+	Slot  phase0.Slot
+	Index int
+}
+
+// selfCheck recomputes the stats of a random sample of committees straight
+// from the attestations of the canonical blocks, without the participation
+// maps the stats are computed from, and compares them to the stats computed.
+// It guards against bugs in the aggregation going unnoticed.
+//
+// A nil selfCheck checks nothing.
+type selfCheck struct {
+	computed map[committeeKey]*AttestationStats
+}
+
+// newSelfCheck samples up to selfCheckCommittees of the candidates.
+func newSelfCheck(candidates []committeeKey, rng *rand.Rand) *selfCheck {
+	rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > selfCheckCommittees {
+		candidates = candidates[:selfCheckCommittees]
+	}
+	c := &selfCheck{computed: make(map[committeeKey]*AttestationStats, len(candidates))}
+	for _, key := range candidates {
+		c.computed[key] = &AttestationStats{}
+	}
+	return c
+}
+
+// Add records a duty computed for a committee, if it's sampled.
+func (c *selfCheck) Add(slot phase0.Slot, index int, duty AttestationStats) {
+	if c == nil {
+		return
+	}
+	if stats, ok := c.computed[committeeKey{slot, index}]; ok {
+		stats.add(duty)
+	}
+}
+
+// Verify recomputes the sampled committees from the canonical blocks,
+// sorted by slot, and returns an error describing every committee whose
+// stats differ. Positions for which excluded returns true are left out, and
+// if includingProposers isn't nil, inclusions by other proposers don't count.
+func (c *selfCheck) Verify(
+	blocks []blockWithRoot,
+	head phase0.Slot,
+	excluded func(slot phase0.Slot, committee, position int) bool,
+	includingProposers map[phase0.ValidatorIndex]bool,
+) error {
+	if c == nil {
+		return nil
+	}
+	// Find the earliest inclusion of each position in one pass over the
+	// blocks, as committee sizes come from the attestations' bits.
+	type committee struct {
+		size       int
+		inclusions map[int]*blockWithRoot
+	}
+	committees := make(map[committeeKey]*committee, len(c.computed))
+	for key := range c.computed {
+		committees[key] = &committee{inclusions: map[int]*blockWithRoot{}}
+	}
+	for i := range blocks {
+		bl := &blocks[i]
+		for _, att := range bl.Message.Body.Attestations {
+			cm, ok := committees[committeeKey{att.Data.Slot, int(att.Data.Index)}]
+			if !ok {
+				continue
+			}
+			cm.size = int(att.AggregationBits.Len())
+			for position := 0; position < cm.size; position++ {
+				if _, ok := cm.inclusions[position]; !ok && att.AggregationBits.BitAt(uint64(position)) {
+					cm.inclusions[position] = bl
+				}
+			}
+		}
+	}
+
+	var mismatches []string
+	for key, computed := range c.computed {
+		cm := committees[key]
+		next := sort.Search(len(blocks), func(i int) bool { return blocks[i].Message.Slot > key.Slot })
+		if next == len(blocks) {
+			continue // Nothing could include it, so it isn't computed either.
+		}
+		earliestBlock := blocks[next].Message.Slot
+		var recomputed AttestationStats
+		for position := 0; position < cm.size; position++ {
+			if excluded(key.Slot, key.Index, position) {
+				continue
+			}
+			inclusion, ok := cm.inclusions[position]
+			switch {
+			case ok && includingProposers != nil && !includingProposers[inclusion.Message.ProposerIndex]:
+				recomputed.Assigned++
+			case ok:
+				recomputed.Assigned++
+				recomputed.Executed++
+				recomputed.InclusionDelay += int(1 + inclusion.Message.Slot - earliestBlock)
+				recomputed.RawDelay += int(inclusion.Message.Slot - key.Slot)
+			case inclusionWindowEnd(key.Slot) > head:
+				recomputed.Pending++
+			default:
+				recomputed.Assigned++
+			}
+		}
+		if recomputed.Assigned != computed.Assigned || recomputed.Executed != computed.Executed ||
+			recomputed.InclusionDelay != computed.InclusionDelay || recomputed.RawDelay != computed.RawDelay ||
+			recomputed.Pending != computed.Pending {
+			mismatches = append(mismatches, fmt.Sprintf(
+				"slot %d committee %d: computed %d/%d executed (delays %d, raw %d, %d pending), recomputed %d/%d (delays %d, raw %d, %d pending)",
+				key.Slot, key.Index,
+				computed.Executed, computed.Assigned, computed.InclusionDelay, computed.RawDelay, computed.Pending,
+				recomputed.Executed, recomputed.Assigned, recomputed.InclusionDelay, recomputed.RawDelay, recomputed.Pending,
+			))
+		}
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return fmt.Errorf("self-check failed for %d of %d committees:\n%s", len(mismatches), len(c.computed), strings.Join(mismatches, "\n"))
+	}
+	return nil
+}
+
+// Committees returns the number of committees checked.
+func (c *selfCheck) Committees() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.computed)
+}
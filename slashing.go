@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"sort"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// SlashableVote is a pair of attestations by the same validator that breaks
+// the slashing rules, either by voting twice for the same target epoch or by
+// one vote surrounding the other.
+type SlashableVote struct {
+	Validator phase0.ValidatorIndex `json:"validator"`
+	Kind      string                `json:"kind"` // "double" or "surround".
+	First     Vote                  `json:"first"`
+	Second    Vote                  `json:"second"`
+}
+
+// Vote is the attestation data signed by a validator.
+type Vote struct {
+	Slot   phase0.Slot  `json:"slot"`
+	Source phase0.Epoch `json:"source"`
+	Target phase0.Epoch `json:"target"`
+	Root   string       `json:"root"` // Hash tree root of the attestation data.
+}
+
+// scanSlashableVotes looks for double and surround votes by the watched
+// validators among the attestations in blocks whose slot is within the range.
+func scanSlashableVotes(
+	blocks []blockWithRoot,
+	watched map[phase0.ValidatorIndex]bool,
+	fromSlot, toSlot phase0.Slot,
+	validatorAt func(slot phase0.Slot, committee, position int) (phase0.ValidatorIndex, bool),
+) ([]SlashableVote, error) {
+	type signed struct {
+		vote Vote
+		root phase0.Root
+	}
+	votes := map[phase0.ValidatorIndex][]signed{}
+	found := []SlashableVote{}
+	for _, bl := range blocks {
+		for _, att := range bl.Message.Body.Attestations {
+			if att.Data.Slot < fromSlot || att.Data.Slot > toSlot || int(att.Data.Index) >= maxCommitteesPerSlot {
+				continue
+			}
+			var root phase0.Root
+			rootComputed := false
+			for _, i := range att.AggregationBits.BitIndices() {
+				validator, ok := validatorAt(att.Data.Slot, int(att.Data.Index), i)
+				if !ok || !watched[validator] {
+					continue
+				}
+				if !rootComputed {
+					var err error
+					root, err = att.Data.HashTreeRoot()
+					if err != nil {
+						return nil, err
+					}
+					rootComputed = true
+				}
+				v := signed{
+					vote: Vote{
+						Slot:   att.Data.Slot,
+						Source: att.Data.Source.Epoch,
+						Target: att.Data.Target.Epoch,
+						Root:   phase0.Root(root).String(),
+					},
+					root: root,
+				}
+				duplicate := false
+				for _, prev := range votes[validator] {
+					if prev.root == v.root {
+						duplicate = true // The same vote, aggregated again.
+						break
+					}
+					kind := ""
+					switch {
+					case prev.vote.Target == v.vote.Target:
+						kind = "double"
+					case prev.vote.Source < v.vote.Source && v.vote.Target < prev.vote.Target,
+						v.vote.Source < prev.vote.Source && prev.vote.Target < v.vote.Target:
+						kind = "surround"
+					default:
+						continue
+					}
+					log.Printf(
+						"Validator %d cast a %s vote: source %d target %d at slot %d, and source %d target %d at slot %d",
+						validator, kind,
+						prev.vote.Source, prev.vote.Target, prev.vote.Slot,
+						v.vote.Source, v.vote.Target, v.vote.Slot,
+					)
+					found = append(found, SlashableVote{validator, kind, prev.vote, v.vote})
+				}
+				if !duplicate {
+					votes[validator] = append(votes[validator], v)
+				}
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Validator < found[j].Validator })
+	return found, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runStatus tracks the progress of a run, so that operators can check on
+// long backfills remotely through a status page. Its methods are no-ops on
+// a nil runStatus, so that runs without a status page needn't check.
+type runStatus struct {
+	nodes   []*nodeClient
+	started time.Time
+
+	mu       sync.Mutex
+	phase    string
+	progress *runProgress
+}
+
+// Status is a snapshot of the progress of a run.
+type Status struct {
+	Phase   string         `json:"phase"`
+	Elapsed time.Duration  `json:"elapsed"`
+	Percent float64        `json:"percent"`
+	ETA     time.Duration  `json:"eta,omitempty"`
+	Nodes   []NodeActivity `json:"nodes"`
+}
+
+// NodeActivity is the throughput of a Beacon node since the run started.
+type NodeActivity struct {
+	Address           string  `json:"address"`
+	Name              string  `json:"name,omitempty"`
+	Requests          int64   `json:"requests"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	BytesPerSecond    float64 `json:"bytes_per_second"`
+}
+
+func newRunStatus(nodes []*nodeClient) *runStatus {
+	return &runStatus{nodes: nodes, started: time.Now(), phase: "Starting"}
+}
+
+// SetPhase sets the phase of the run shown on the status page.
+func (s *runStatus) SetPhase(phase string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.phase = phase
+	s.mu.Unlock()
+}
+
+// SetProgress sets the block fetching progress that completion and the ETA
+// are derived from.
+func (s *runStatus) SetProgress(progress *runProgress) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.progress = progress
+	s.mu.Unlock()
+}
+
+// Snapshot returns the current status. Completion follows block fetching,
+// which takes up most of a run, and the ETA is extrapolated from it.
+func (s *runStatus) Snapshot() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := time.Since(s.started)
+	status := Status{Phase: s.phase, Elapsed: elapsed.Round(time.Second)}
+	if s.progress != nil {
+		fraction := s.progress.Fraction()
+		status.Percent = fraction * 100
+		if fraction > 0 && fraction < 1 {
+			status.ETA = time.Duration(float64(elapsed) * (1 - fraction) / fraction).Round(time.Second)
+		}
+	}
+	for _, n := range s.nodes {
+		requests := n.requests.Load()
+		status.Nodes = append(status.Nodes, NodeActivity{
+			Address:           redactAddress(n.address),
+			Name:              n.name,
+			Requests:          requests,
+			RequestsPerSecond: float64(requests) / elapsed.Seconds(),
+			BytesPerSecond:    float64(n.bytes.Load()) / elapsed.Seconds(),
+		})
+	}
+	return status
+}
+
+// Serve serves the status page at addr in the background, as HTML at / and
+// as JSON at /status.json.
+func (s *runStatus) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPage.Execute(w, s.Snapshot()); err != nil {
+			log.Printf("Failed to render status page: %s", err)
+		}
+	})
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Snapshot()); err != nil {
+			log.Printf("Failed to write status: %s", err)
+		}
+	})
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("Status page stopped: %s", err)
+		}
+	}()
+	log.Printf("Serving status page at http://%s", listener.Addr())
+	return nil
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"mib": func(bytes float64) float64 { return bytes / (1 << 20) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="5">
+<title>global-epoch-stats</title>
+</head>
+<body>
+<h1>global-epoch-stats</h1>
+<p>{{.Phase}}: {{printf "%.1f" .Percent}}% of blocks fetched, {{.Elapsed}} elapsed{{if .ETA}}, about {{.ETA}} left{{end}}</p>
+<table>
+<tr><th>Node</th><th>Requests</th><th>Requests/s</th><th>MiB/s</th></tr>
+{{range .Nodes}}<tr><td>{{or .Name .Address}}</td><td>{{.Requests}}</td><td>{{printf "%.1f" .RequestsPerSecond}}</td><td>{{printf "%.2f" (mib .BytesPerSecond)}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
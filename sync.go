@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// Altair's reward weight of sync committee participation, out of the weight
+// denominator shared with attestation votes and proposals.
+const (
+	syncRewardWeight  = 2
+	weightDenominator = 64
+)
+
+// SyncStats counts the sync committee duties of the sync validators within an
+// epoch: one for each of their positions in the committee, at every slot with
+// a block. Slots without blocks reward and penalize no one, so they aren't
+// duties.
+type SyncStats struct {
+	Epoch  phase0.Epoch `json:"epoch"`
+	Duties int          `json:"duties"`
+	Missed int          `json:"missed"`
+
+	// LostGwei estimates the rewards forgone and penalties incurred by
+	// missed duties, each of which costs twice a participant's reward.
+	LostGwei phase0.Gwei `json:"lost_gwei"`
+}
+
+func (s *SyncStats) add(o SyncStats) {
+	s.Duties += o.Duties
+	s.Missed += o.Missed
+	s.LostGwei += o.LostGwei
+}
+
+// Rate returns the percentage of duties that were executed.
+func (s SyncStats) Rate() float64 {
+	return float64(s.Duties-s.Missed) / float64(s.Duties) * 100
+}
+
+// syncRewardModel holds the chain configuration sync committee rewards are
+// computed from.
+type syncRewardModel struct {
+	period                    phase0.Epoch // EPOCHS_PER_SYNC_COMMITTEE_PERIOD.
+	committeeSize             uint64
+	effectiveBalanceIncrement uint64
+	maxEffectiveBalance       uint64
+	baseRewardFactor          uint64
+}
+
+func newSyncRewardModel(spec map[string]string) (syncRewardModel, error) {
+	var m syncRewardModel
+	var period uint64
+	for _, v := range []struct {
+		key   string
+		value *uint64
+	}{
+		{"EPOCHS_PER_SYNC_COMMITTEE_PERIOD", &period},
+		{"SYNC_COMMITTEE_SIZE", &m.committeeSize},
+		{"EFFECTIVE_BALANCE_INCREMENT", &m.effectiveBalanceIncrement},
+		{"MAX_EFFECTIVE_BALANCE", &m.maxEffectiveBalance},
+		{"BASE_REWARD_FACTOR", &m.baseRewardFactor},
+	} {
+		value, err := strconv.ParseUint(spec[v.key], 10, 64)
+		if err != nil || value == 0 {
+			return syncRewardModel{}, fmt.Errorf("invalid %s %q", v.key, spec[v.key])
+		}
+		*v.value = value
+	}
+	m.period = phase0.Epoch(period)
+	return m, nil
+}
+
+// ParticipantReward estimates the reward of a sync committee member for a
+// slot, following process_sync_aggregate, given the number of active
+// validators. Their total balance is taken to be the maximum effective
+// balance each, which nearly all validators have.
+func (m syncRewardModel) ParticipantReward(activeValidators int) phase0.Gwei {
+	totalBalance := uint64(activeValidators) * m.maxEffectiveBalance
+	if totalBalance == 0 {
+		return 0
+	}
+	totalIncrements := totalBalance / m.effectiveBalanceIncrement
+	baseRewardPerIncrement := m.effectiveBalanceIncrement * m.baseRewardFactor / integerSquareRoot(totalBalance)
+	totalBaseRewards := baseRewardPerIncrement * totalIncrements
+	maxParticipantRewards := totalBaseRewards * syncRewardWeight / weightDenominator / uint64(slotsPerEpoch)
+	return phase0.Gwei(maxParticipantRewards / m.committeeSize)
+}
+
+// syncCommitteeStats counts the sync committee duties of the sync validators
+// by epoch, from the sync aggregates of canonical blocks at the slots for
+// which include returns true. Committees are given by sync committee period,
+// and activeValidators returns the number of active validators in an epoch
+// to estimate rewards with. Only epochs in which the validators had duties
+// are returned.
+func syncCommitteeStats(
+	blocks []blockWithRoot,
+	committees map[phase0.Epoch][]phase0.ValidatorIndex,
+	validators map[phase0.ValidatorIndex]bool,
+	model syncRewardModel,
+	activeValidators func(phase0.Epoch) int,
+	include func(phase0.Slot) bool,
+) []SyncStats {
+	byEpoch := map[phase0.Epoch]*SyncStats{}
+	for _, bl := range blocks {
+		aggregate := bl.Message.Body.SyncAggregate
+		if !include(bl.Message.Slot) || aggregate == nil {
+			continue
+		}
+		epoch := phase0.Epoch(bl.Message.Slot / slotsPerEpoch)
+		// The aggregate is checked against the committee of the block's own
+		// slot, even at the first slot of a period.
+		committee, ok := committees[epoch/model.period]
+		if !ok {
+			continue
+		}
+		for position, validator := range committee {
+			if !validators[validator] {
+				continue
+			}
+			stats := byEpoch[epoch]
+			if stats == nil {
+				stats = &SyncStats{Epoch: epoch}
+				byEpoch[epoch] = stats
+			}
+			stats.Duties++
+			if !aggregate.SyncCommitteeBits.BitAt(uint64(position)) {
+				stats.Missed++
+			}
+		}
+	}
+	list := make([]SyncStats, 0, len(byEpoch))
+	for epoch, stats := range byEpoch {
+		stats.LostGwei = phase0.Gwei(stats.Missed) * 2 * model.ParticipantReward(activeValidators(epoch))
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Epoch < list[j].Epoch })
+	return list
+}
+
+// SyncPeriodStats holds a sync committee period the range crosses into: the
+// turnover of its committee and the participation in its sync aggregates.
+type SyncPeriodStats struct {
+	Period    phase0.Epoch `json:"period"`
+	FromEpoch phase0.Epoch `json:"from_epoch"` // Of the period's epochs within the range.
+	ToEpoch   phase0.Epoch `json:"to_epoch"`
+	Members   int          `json:"members"` // Distinct validators of the committee.
+
+	// Turnover is unset for the first period of the range.
+	Turnover *SyncTurnover `json:"turnover,omitempty"`
+
+	SyncAggregates SyncAggregateStats `json:"sync_aggregates"`
+}
+
+// SyncTurnover compares a sync committee with the previous period's, by
+// distinct validators.
+type SyncTurnover struct {
+	Stayed int `json:"stayed"`
+	Joined int `json:"joined"`
+	Left   int `json:"left"`
+}
+
+// syncPeriodStats breaks the sync aggregates of epochs down by sync committee
+// period, for the periods of the range from fromEpoch to toEpoch that there
+// are committees for, and compares each committee with the previous period's.
+func syncPeriodStats(
+	epochs []EpochStats,
+	committees map[phase0.Epoch][]phase0.ValidatorIndex,
+	period, fromEpoch, toEpoch phase0.Epoch,
+) []SyncPeriodStats {
+	members := func(committee []phase0.ValidatorIndex) map[phase0.ValidatorIndex]bool {
+		m := make(map[phase0.ValidatorIndex]bool, len(committee))
+		for _, validator := range committee {
+			m[validator] = true
+		}
+		return m
+	}
+	var list []SyncPeriodStats
+	for p := fromEpoch / period; p <= toEpoch/period; p++ {
+		committee, ok := committees[p]
+		if !ok {
+			continue
+		}
+		stats := SyncPeriodStats{Period: p, FromEpoch: p * period, ToEpoch: (p+1)*period - 1}
+		if stats.FromEpoch < fromEpoch {
+			stats.FromEpoch = fromEpoch
+		}
+		if stats.ToEpoch > toEpoch {
+			stats.ToEpoch = toEpoch
+		}
+		current := members(committee)
+		stats.Members = len(current)
+		if previous, ok := committees[p-1]; ok && p > fromEpoch/period {
+			turnover := &SyncTurnover{}
+			before := members(previous)
+			for validator := range current {
+				if before[validator] {
+					turnover.Stayed++
+				} else {
+					turnover.Joined++
+				}
+			}
+			turnover.Left = len(before) - turnover.Stayed
+			stats.Turnover = turnover
+		}
+		for _, e := range epochs {
+			if e.Epoch/period == p {
+				stats.SyncAggregates.add(e.SyncAggregates)
+			}
+		}
+		list = append(list, stats)
+	}
+	return list
+}
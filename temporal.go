@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// TimeBucketStats aggregates the attestations of the epochs that start within
+// a recurring wall-clock bucket, such as an hour of the day, to surface
+// periodic patterns like backup jobs or maintenance windows.
+type TimeBucketStats struct {
+	Bucket       string           `json:"bucket"` // Such as "14:00" or "Mon", in UTC.
+	Epochs       int              `json:"epochs"`
+	Attestations AttestationStats `json:"attestations"`
+}
+
+// newTimeBuckets aggregates epochs by the UTC hour of the day and the day of
+// the week they start in, leaving out buckets without epochs. Days start on
+// Monday.
+func newTimeBuckets(epochs []EpochStats, epochTime func(phase0.Epoch) time.Time) (hours, days []TimeBucketStats) {
+	var byHour [24]TimeBucketStats
+	var byDay [7]TimeBucketStats
+	for _, e := range epochs {
+		t := epochTime(e.Epoch).UTC()
+		hour := &byHour[t.Hour()]
+		hour.Epochs++
+		hour.Attestations.add(e.Attestations)
+		day := &byDay[(t.Weekday()+6)%7]
+		day.Epochs++
+		day.Attestations.add(e.Attestations)
+	}
+	for i, b := range byHour {
+		if b.Epochs > 0 {
+			b.Bucket = fmt.Sprintf("%02d:00", i)
+			hours = append(hours, b)
+		}
+	}
+	for i, b := range byDay {
+		if b.Epochs > 0 {
+			b.Bucket = time.Weekday((i + 1) % 7).String()[:3]
+			days = append(days, b)
+		}
+	}
+	return hours, days
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+)
+
+// transitionSlots is the number of slots at the start of each epoch that are
+// affected by epoch-transition processing.
+const transitionSlots = 2
+
+// significanceLevel is the p-value below which a delta is considered significant.
+const significanceLevel = 0.05
+
+// TransitionStats compares attestations at the start of each epoch, where
+// slow epoch-transition processing typically shows up, against the rest.
+type TransitionStats struct {
+	Boundary AttestationStats `json:"boundary"` // Slot indices 0–1.
+	Rest     AttestationStats `json:"rest"`     // Slot indices from 2 on.
+
+	// PValue is the two-sided p-value of the difference in rates, under a
+	// two-proportion z-test.
+	PValue float64 `json:"p_value"`
+}
+
+func newTransitionStats(slots []AttestationStats) TransitionStats {
+	var t TransitionStats
+	for i, stats := range slots {
+		s := &t.Rest
+		if i < transitionSlots {
+			s = &t.Boundary
+		}
+		s.add(stats)
+	}
+	t.PValue = rateDifferencePValue(t.Boundary, t.Rest)
+	return t
+}
+
+// rateDifferencePValue returns the two-sided p-value of the difference in
+// rates between two sets of duties, under a two-proportion z-test.
+func rateDifferencePValue(a, b AttestationStats) float64 {
+	n1, n2 := float64(a.Assigned), float64(b.Assigned)
+	p1, p2 := float64(a.Executed)/n1, float64(b.Executed)/n2
+	p := float64(a.Executed+b.Executed) / (n1 + n2)
+	se := math.Sqrt(p * (1 - p) * (1/n1 + 1/n2))
+	pValue := 1.0
+	if se > 0 {
+		z := (p1 - p2) / se
+		pValue = math.Erfc(math.Abs(z) / math.Sqrt2)
+	}
+	return pValue
+}
+
+// RateDelta returns the difference in rate between the boundary slots and
+// the rest, in percentage points.
+func (t TransitionStats) RateDelta() float64 {
+	return t.Boundary.Rate() - t.Rest.Rate()
+}
+
+// Significant reports whether the difference in rates is statistically significant.
+func (t TransitionStats) Significant() bool {
+	return t.PValue < significanceLevel
+}
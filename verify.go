@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	apiv1 "github.com/attestantio/go-eth2-client/api/v1"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/altair"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// StateCheck compares the attestations of an epoch, as derived from blocks,
+// against the participation flags the beacon state recorded for it.
+//
+// Small discrepancies are expected: the state only flags attestations that
+// earned at least one reward, so late attestations with a wrong target are
+// counted as executed by blocks but not as participating by the state.
+type StateCheck struct {
+	Epoch              phase0.Epoch `json:"epoch"`
+	Assigned           int          `json:"assigned"`
+	Executed           int          `json:"executed"`
+	StateActive        int          `json:"state_active"`
+	StateParticipating int          `json:"state_participating"`
+}
+
+// Discrepancy returns how many more attestations blocks show as executed
+// than the state shows as participating.
+func (c StateCheck) Discrepancy() int {
+	return c.Executed - c.StateParticipating
+}
+
+// verifyStates checks the block-derived attestations of each finalized epoch
+// against its participation flags. An epoch's flags are final in the state
+// at the last slot of the next epoch, so epochs are only checked once that
+// slot is finalized. States are fetched one at a time, since each can take
+// hundreds of megabytes.
+func verifyStates(ctx context.Context, sched *scheduler, epochs []EpochStats) ([]StateCheck, error) {
+	var finality *apiv1.Finality
+	err := sched.Do(categoryDuties, func(node *nodeClient) error {
+		var err error
+		finality, err = node.Finality(ctx, "head")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch finality: %w", err)
+	}
+
+	var checks []StateCheck
+	for _, epoch := range epochs {
+		if epoch.Epoch+2 > finality.Finalized.Epoch {
+			log.Printf("Skipping state verification of epoch %d, which isn't finalized yet", epoch.Epoch)
+			continue
+		}
+		// Altair translates the participation of the epoch before it into
+		// flags, but phase0 states have none.
+		if epoch.Epoch+1 < altairForkEpoch {
+			log.Printf("Skipping state verification of epoch %d, whose state predates Altair's participation flags", epoch.Epoch)
+			continue
+		}
+		slot := phase0.Slot(epoch.Epoch+2)*slotsPerEpoch - 1
+		var state *spec.VersionedBeaconState
+		err := sched.Do(categoryCommittees, func(node *nodeClient) error {
+			var err error
+			state, err = node.BeaconState(ctx, fmt.Sprint(slot))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch state at slot %d: %w", slot, err)
+		}
+		validators, participation, err := previousEpochParticipation(state)
+		if err != nil {
+			return nil, err
+		}
+
+		check := StateCheck{
+			Epoch:    epoch.Epoch,
+			Assigned: epoch.Attestations.Assigned,
+			Executed: epoch.Attestations.Executed,
+		}
+		for i, v := range validators {
+			if v.ActivationEpoch > epoch.Epoch || v.ExitEpoch <= epoch.Epoch {
+				continue
+			}
+			check.StateActive++
+			if participation[i] != 0 {
+				check.StateParticipating++
+			}
+		}
+		if check.StateActive != check.Assigned || check.Discrepancy() != 0 {
+			log.Printf(
+				"Epoch %d: blocks show %d/%d attestations, but the state shows %d/%d",
+				epoch.Epoch, check.Executed, check.Assigned, check.StateParticipating, check.StateActive,
+			)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func previousEpochParticipation(state *spec.VersionedBeaconState) ([]*phase0.Validator, []altair.ParticipationFlags, error) {
+	switch state.Version {
+	case spec.DataVersionAltair:
+		return state.Altair.Validators, state.Altair.PreviousEpochParticipation, nil
+	case spec.DataVersionBellatrix:
+		return state.Bellatrix.Validators, state.Bellatrix.PreviousEpochParticipation, nil
+	case spec.DataVersionCapella:
+		return state.Capella.Validators, state.Capella.PreviousEpochParticipation, nil
+	case spec.DataVersionDeneb:
+		return state.Deneb.Validators, state.Deneb.PreviousEpochParticipation, nil
+	default:
+		return nil, nil, fmt.Errorf("%s states have no participation flags", state.Version)
+	}
+}